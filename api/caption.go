@@ -0,0 +1,125 @@
+package api
+
+import (
+	"database/sql"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/rathvong/talentmob_server/captions"
+	"github.com/rathvong/talentmob_server/models"
+)
+
+func init() {
+	// caption urls built by models follow the route they are served from
+	models.CaptionPath = strings.TrimSuffix(UrlGetVideoCaption, ":params")
+}
+
+// Caption file sent by the creator of a video
+type captionUpload struct {
+	VideoID  uint64 `json:"video_id"`
+	Language string `json:"language"`
+	Label    string `json:"label"`
+	Content  string `json:"content"`
+}
+
+// HTTP POST - add or replace the captions of a video in a language
+//
+//  VideoID  uint64 `json:"video_id"`
+//  Language string `json:"language"` - en, es, pt-BR
+//  Label    string `json:"label"` - optional, shown in the players track menu
+//  Content  string `json:"content"` - SRT or WebVTT
+//
+func (s *Server) PostVideoCaption(w rest.ResponseWriter, r *rest.Request) {
+	response := models.BaseResponse{}
+	response.Init(w)
+
+	currentUser, err := s.LoginProcess(response, r)
+
+	if err != nil {
+		return
+	}
+
+	var upload captionUpload
+
+	if err := r.DecodeJsonPayload(&upload); err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	if err := models.CheckSanction(s.Db, currentUser.ID, models.SanctionUploadSuspension); err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	video := models.Video{}
+
+	if err := video.GetVideoByID(s.Db, upload.VideoID); err != nil || video.UserID != currentUser.ID {
+		response.SendError(ErrorModelIsNotFound)
+		return
+	}
+
+	caption := models.Caption{VideoID: video.ID, Language: upload.Language, Label: upload.Label}
+
+	if err := caption.Create(s.Db, s.Storage, []byte(upload.Content)); err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	response.SendSuccess(caption)
+}
+
+// WebVTT captions of a video. Players can not send the api
+// token so captions of active videos are public.
+func (s *Server) GetVideoCaption(w rest.ResponseWriter, r *rest.Request) {
+	response := models.BaseResponse{}
+	response.Init(w)
+
+	videoID, err := s.GetVideoIDFromParams(r)
+
+	if err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	values, _ := url.ParseQuery(r.PathParam("params"))
+
+	video := models.Video{}
+
+	if err := video.GetVideoByID(s.Db, videoID); err != nil || !video.IsActive {
+		w.WriteHeader(http.StatusNotFound)
+		response.SendError(ErrorModelIsNotFound)
+		return
+	}
+
+	caption := models.Caption{}
+
+	if err := caption.Get(s.Db, video.ID, values.Get("language")); err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusNotFound)
+			response.SendError(ErrorModelIsNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusInternalServerError)
+		response.SendError(err.Error())
+		return
+	}
+
+	body, _, err := s.Storage.Get(caption.Key)
+
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response.SendError(err.Error())
+		return
+	}
+
+	defer body.Close()
+
+	w.Header().Set("Content-Type", captions.ContentType)
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w.(http.ResponseWriter), body)
+}
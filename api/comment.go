@@ -12,7 +12,7 @@ func (s *Server) GetComments(w rest.ResponseWriter, r *rest.Request) {
 	response := models.BaseResponse{}
 	response.Init(w)
 
-	_, err := s.LoginProcess(response, r)
+	currentUser, err := s.LoginProcess(response, r)
 
 	if err != nil {
 		return
@@ -28,7 +28,7 @@ func (s *Server) GetComments(w rest.ResponseWriter, r *rest.Request) {
 
 	comment := models.Comment{}
 
-	comments, err := comment.GetForVideo(s.Db, videoID, page)
+	comments, err := comment.GetForVideo(s.Db, videoID, currentUser.ID, page)
 
 	if err != nil {
 		response.SendError(err.Error())
@@ -43,7 +43,7 @@ func (s *Server) GetComments2(w rest.ResponseWriter, r *rest.Request) {
 	response := models.BaseResponse{}
 	response.Init(w)
 
-	_, err := s.LoginProcess(response, r)
+	currentUser, err := s.LoginProcess(response, r)
 
 	if err != nil {
 		return
@@ -59,7 +59,7 @@ func (s *Server) GetComments2(w rest.ResponseWriter, r *rest.Request) {
 
 	comment := models.Comment{}
 
-	comments, err := comment.GetForVideo2(s.Db, videoID, page)
+	comments, err := comment.GetForVideo2(s.Db, videoID, currentUser.ID, page)
 
 	if err != nil {
 		response.SendError(err.Error())
@@ -161,6 +161,11 @@ func (s *Server) PostComment(w rest.ResponseWriter, r *rest.Request) {
 
 	comment.UserID = currentUser.ID
 
+	if err := models.CheckSanction(s.Db, currentUser.ID, models.SanctionCommentMute); err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
 	if err := comment.Create(s.Db); err != nil {
 		response.SendError(err.Error())
 		return
@@ -0,0 +1,17 @@
+package api
+
+import (
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/rathvong/talentmob_server/deeplink"
+)
+
+// HTTP GET - apple-app-site-association for ios universal links,
+// served as plain json without the api response wrapper
+func (s *Server) GetAppleAppSiteAssociation(w rest.ResponseWriter, r *rest.Request) {
+	w.WriteJson(deeplink.AppleAssociation())
+}
+
+// HTTP GET - assetlinks.json for android app links
+func (s *Server) GetAssetLinks(w rest.ResponseWriter, r *rest.Request) {
+	w.WriteJson(deeplink.AssetLinks())
+}
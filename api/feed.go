@@ -0,0 +1,28 @@
+package api
+
+import (
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/rathvong/talentmob_server/models"
+)
+
+// HTTP GET - retrieve the activity feed of the users the current user follows
+// params - cursor, leave empty for the first page
+func (s *Server) GetFeed(w rest.ResponseWriter, r *rest.Request) {
+	response := models.BaseResponse{}
+	response.Init(w)
+
+	currentUser, err := s.LoginProcess(response, r)
+
+	if err != nil {
+		return
+	}
+
+	var feed models.Feed
+
+	if err := feed.Get(s.Db, currentUser.ID, s.GetCursorFromParams(r)); err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	response.SendSuccess(feed)
+}
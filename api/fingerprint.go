@@ -0,0 +1,71 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/rathvong/talentmob_server/models"
+)
+
+// Moderator decision on a video flagged as a re-upload
+// extra - {"fingerprint_id": 1, "moderator_id": 1}
+type FingerprintReview struct {
+	FingerprintID uint64 `json:"fingerprint_id"`
+	ModeratorID   uint64 `json:"moderator_id"`
+}
+
+// Videos flagged as re-uploads waiting for a moderator
+// extra - {"page": 1}
+func (st *SystemTaskParams) listFlaggedVideos() {
+	var queue ReportQueue
+
+	if st.Extra != "" {
+		if err := json.Unmarshal([]byte(st.Extra), &queue); err != nil {
+			st.response.SendError(err.Error())
+			return
+		}
+	}
+
+	var fingerprint models.Fingerprint
+
+	fingerprints, err := fingerprint.GetFlagged(st.db, queue.Page)
+
+	if err != nil {
+		st.response.SendError(err.Error())
+		return
+	}
+
+	st.response.SendSuccess(fingerprints)
+}
+
+func (st *SystemTaskParams) reviewFlaggedVideo(approve bool) {
+	review, fingerprint, err := st.getFingerprintReview()
+
+	if err != nil {
+		st.response.SendError(err.Error())
+		return
+	}
+
+	if err := fingerprint.Review(st.db, review.ModeratorID, approve); err != nil {
+		st.response.SendError(err.Error())
+		return
+	}
+
+	st.response.SendSuccess(fingerprint)
+}
+
+func (st *SystemTaskParams) getFingerprintReview() (review FingerprintReview, fingerprint models.Fingerprint, err error) {
+
+	if st.Extra == "" {
+		err = errors.New("missing extra={fingerprint_id, moderator_id}")
+		return
+	}
+
+	if err = json.Unmarshal([]byte(st.Extra), &review); err != nil {
+		return
+	}
+
+	err = fingerprint.Get(st.db, review.FingerprintID)
+
+	return
+}
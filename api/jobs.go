@@ -0,0 +1,188 @@
+package api
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/rathvong/talentmob_server/models"
+	"github.com/rathvong/talentmob_server/transcoder"
+)
+
+// How often the background jobs run.
+// The stats rollup refreshes todays snapshot every hour so the
+// last run of the day leaves a complete snapshot behind.
+const (
+	JobIntervalRollupUserStats       = time.Hour
+	JobIntervalPublishScheduledVideo = time.Minute
+	JobIntervalTranscodeJobs         = 30 * time.Second
+	JobIntervalFingerprints          = 30 * time.Second
+	JobIntervalPurgeTrash            = time.Hour
+)
+
+// Postgres advisory lock keys, only one process runs a job at a
+// time when several web or worker processes are running
+const (
+	jobLockRollupUserStats int64 = 7310 + iota
+	jobLockPublishScheduledVideos
+	jobLockTranscodeJobs
+	jobLockFingerprints
+	jobLockPurgeTrash
+)
+
+// Set TRANSCODE_WORKER to separate when the worker process
+// type is running so the web process does not run the jobs
+const (
+	EnvTranscodeWorker      = "TRANSCODE_WORKER"
+	TranscodeWorkerSeparate = "separate"
+)
+
+// Start the background jobs that run alongside the api
+func (s *Server) startJobs() {
+	// the jobs are left to the worker process when it runs on its own
+	if os.Getenv(EnvTranscodeWorker) == TranscodeWorkerSeparate {
+		return
+	}
+
+	s.runJobs()
+}
+
+// Run the background jobs without the api,
+// used by the worker process type in the Procfile
+func (s *Server) Work() {
+	s.runJobs()
+
+	select {}
+}
+
+// Start every job in the background. A job whose transcoder or
+// storage can not be set up is skipped, the other jobs still run.
+func (s *Server) runJobs() {
+	go s.runEvery(JobIntervalRollupUserStats, s.locked(jobLockRollupUserStats, s.rollupUserStats))
+	go s.runEvery(JobIntervalPublishScheduledVideo, s.locked(jobLockPublishScheduledVideos, s.publishScheduledVideos))
+
+	if err := s.initTranscoder(); err != nil {
+		log.Println("Server.runJobs() transcode jobs are not running, Error -> ", err)
+	} else {
+		go s.runEvery(JobIntervalTranscodeJobs, s.locked(jobLockTranscodeJobs, s.processTranscodeJobs))
+	}
+
+	if err := s.initStorage(); err != nil {
+		log.Println("Server.runJobs() fingerprint and trash jobs are not running, Error -> ", err)
+		return
+	}
+
+	go s.runEvery(JobIntervalFingerprints, s.locked(jobLockFingerprints, s.processFingerprints))
+	go s.runEvery(JobIntervalPurgeTrash, s.locked(jobLockPurgeTrash, s.purgeTrash))
+}
+
+func (s *Server) initTranscoder() (err error) {
+	if s.Transcoder != nil {
+		return
+	}
+
+	s.Transcoder, err = transcoder.New()
+
+	return
+}
+
+// Run a job straight away and then every interval
+func (s *Server) runEvery(interval time.Duration, job func()) {
+	job()
+
+	for range time.Tick(interval) {
+		job()
+	}
+}
+
+// Wrap a job so each run holds its advisory lock
+func (s *Server) locked(lock int64, job func()) func() {
+	return func() {
+		s.runLocked(lock, job)
+	}
+}
+
+// Run a job while holding its advisory lock, the run is skipped
+// when another process is already running the job
+func (s *Server) runLocked(lock int64, job func()) {
+	ctx := context.Background()
+
+	// the lock belongs to the session so one connection is held for the run
+	conn, err := s.Db.Conn(ctx)
+
+	if err != nil {
+		log.Println("Server.runLocked() Conn() Error -> ", err)
+		return
+	}
+
+	defer conn.Close()
+
+	var locked bool
+
+	if err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", lock).Scan(&locked); err != nil {
+		log.Printf("Server.runLocked() lock -> %v Error -> %v", lock, err)
+		return
+	}
+
+	if !locked {
+		return
+	}
+
+	defer func() {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", lock); err != nil {
+			log.Printf("Server.runLocked() unlock -> %v Error -> %v", lock, err)
+		}
+	}()
+
+	job()
+}
+
+// Write todays stats snapshot for every user
+func (s *Server) rollupUserStats() {
+	var stat models.UserStat
+
+	if err := stat.Rollup(s.Db); err != nil {
+		log.Println("Server.rollupUserStats() Error -> ", err)
+	}
+}
+
+// Refresh todays stats snapshot outside of the hourly job
+func (st *SystemTaskParams) rollupUserStats() {
+	var stat models.UserStat
+
+	if err := stat.Rollup(st.db); err != nil {
+		st.response.SendError(err.Error())
+		return
+	}
+
+	st.response.SendSuccess(models.UserStatDay(time.Now()))
+}
+
+// Publish scheduled videos once their time has come
+func (s *Server) publishScheduledVideos() {
+	if err := models.PublishScheduledVideos(s.Db); err != nil {
+		log.Println("Server.publishScheduledVideos() Error -> ", err)
+	}
+}
+
+// Submit queued transcode jobs and poll the running ones
+func (s *Server) processTranscodeJobs() {
+	if err := models.ProcessTranscodeJobs(s.Db, s.Transcoder); err != nil {
+		log.Println("Server.processTranscodeJobs() Error -> ", err)
+	}
+}
+
+// Check pending videos for re-uploads of other users videos
+func (s *Server) processFingerprints() {
+	if err := models.ProcessFingerprints(s.Db, s.Storage); err != nil {
+		log.Println("Server.processFingerprints() Error -> ", err)
+	}
+}
+
+// Hard delete videos that have been in the trash past the retention window
+func (s *Server) purgeTrash() {
+	if err := models.PurgeTrash(s.Db, s.Storage); err != nil {
+		log.Println("Server.purgeTrash() Error -> ", err)
+	}
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"log"
@@ -43,6 +44,7 @@ func (s *Server) UserLogin(w rest.ResponseWriter, r *rest.Request) {
 //	MinutesWatched    uint64 `json:"minutes_watched"`
 //	Points            uint64 `json:"points"`
 //	Password          string `json:"password, omitempty"`
+//	ReferrerCode      string `json:"referrer_code"`
 //
 //
 func (s *Server) UserFacebookLogin(w rest.ResponseWriter, r *rest.Request) {
@@ -98,6 +100,8 @@ func (s *Server) UserFacebookLogin(w rest.ResponseWriter, r *rest.Request) {
 			return
 		}
 
+		models.RegisterReferral(s.Db, user, user.ReferrerCode, user.DeviceID)
+
 		response.SendSuccess(user)
 
 		return
@@ -218,7 +222,7 @@ func (s *Server) UserFacebookLogin(w rest.ResponseWriter, r *rest.Request) {
 //	return
 //}
 
-func (s *Server) createLoginForEmail(email string, deviceID string) (user models.User, err error) {
+func (s *Server) createLoginForEmail(email string, deviceID string, referrerCode string) (user models.User, err error) {
 	if exists, err := user.EmailExists(s.Db, email); exists || err != nil {
 
 		if err != nil {
@@ -271,10 +275,12 @@ func (s *Server) createLoginForEmail(email string, deviceID string) (user models
 		return user, err
 	}
 
+	models.RegisterReferral(s.Db, user, referrerCode, deviceID)
+
 	return user, err
 }
 
-func (s *Server) createLoginForPhone(phone string, deviceID string) (user models.User, err error) {
+func (s *Server) createLoginForPhone(phone string, deviceID string, referrerCode string) (user models.User, err error) {
 
 	ci := models.ContactInformation{}
 
@@ -326,12 +332,15 @@ func (s *Server) createLoginForPhone(phone string, deviceID string) (user models
 		return user, err
 	}
 
+	models.RegisterReferral(s.Db, user, referrerCode, deviceID)
+
 	return
 }
 
 type SocialLogin struct {
 	Verification string `json:"verification"`
 	DeviceID     string `json:"device_id"`
+	ReferrerCode string `json:"referrer_code"`
 }
 
 func (s *Server) UserFirebaseLogin(w rest.ResponseWriter, r *rest.Request) {
@@ -387,10 +396,10 @@ func (s *Server) UserFirebaseLogin(w rest.ResponseWriter, r *rest.Request) {
 
 	switch verification.Verification {
 	case "phone":
-		user, err = s.createLoginForPhone(u.PhoneNumber, verification.DeviceID)
+		user, err = s.createLoginForPhone(u.PhoneNumber, verification.DeviceID, verification.ReferrerCode)
 
 	case "gmail":
-		user, err = s.createLoginForEmail(u.Email, verification.DeviceID)
+		user, err = s.createLoginForEmail(u.Email, verification.DeviceID, verification.ReferrerCode)
 
 	default:
 		response.SendError(ErrorActionIsNotSupported)
@@ -497,6 +506,11 @@ func (s *Server) GetVideo(w rest.ResponseWriter, r *rest.Request) {
 		return
 	}
 
+	if !video.IsPublished() {
+		response.SendError(sql.ErrNoRows.Error())
+		return
+	}
+
 	if err := user.GetUser(s.Db, video.UserID); err != nil {
 		response.SendError(err.Error())
 		return
@@ -0,0 +1,250 @@
+package api
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/rathvong/talentmob_server/models"
+)
+
+// Perform tasks for playlists
+// create - extra {"title": "Best singers this month", "description": "...", "is_public": true}
+// update - id, extra {"title": "...", "description": "...", "is_public": false}
+// delete, get, follow, unfollow - id
+// add, remove - id, extra video_id
+// reorder - id, extra [3, 1, 2] every video id in the new order
+func (tp *TaskParams) HandlePlaylistTasks() {
+	if tp.Action == taskAction.create {
+		tp.performPlaylistCreate()
+		return
+	}
+
+	if tp.ID == 0 {
+		tp.response.SendError(ErrorMissingID)
+		return
+	}
+
+	var playlist models.Playlist
+
+	if err := playlist.Get(tp.db, tp.ID, tp.currentUser.ID); err != nil {
+		tp.response.SendError(err.Error())
+		return
+	}
+
+	switch tp.Action {
+	case taskAction.get:
+		tp.response.SendSuccess(playlist)
+	case taskAction.follow:
+		tp.performPlaylistFollow(&playlist, true)
+	case taskAction.unfollow:
+		tp.performPlaylistFollow(&playlist, false)
+	case taskAction.update, taskAction.delete, taskAction.add, taskAction.remove, taskAction.reorder:
+		if playlist.UserID != tp.currentUser.ID {
+			tp.response.SendError(ErrorUnauthorizedAction)
+			return
+		}
+
+		tp.performPlaylistEdit(&playlist)
+	default:
+		tp.response.SendError(ErrorActionIsNotSupported)
+	}
+}
+
+func (tp *TaskParams) performPlaylistCreate() {
+	if tp.Extra == "" {
+		tp.response.SendError(ErrorMissingExtra)
+		return
+	}
+
+	var playlist models.Playlist
+
+	if err := json.Unmarshal([]byte(tp.Extra), &playlist); err != nil {
+		tp.response.SendError(err.Error())
+		return
+	}
+
+	playlist.UserID = tp.currentUser.ID
+
+	if err := playlist.Create(tp.db); err != nil {
+		tp.response.SendError(err.Error())
+		return
+	}
+
+	tp.performPlaylistGet(playlist.ID)
+}
+
+// Owner changes to a playlist
+func (tp *TaskParams) performPlaylistEdit(playlist *models.Playlist) {
+	var err error
+
+	if tp.Extra == "" && tp.Action != taskAction.delete {
+		tp.response.SendError(ErrorMissingExtra)
+		return
+	}
+
+	switch tp.Action {
+	case taskAction.update:
+		var update models.Playlist
+
+		if err = json.Unmarshal([]byte(tp.Extra), &update); err != nil {
+			break
+		}
+
+		if update.Title != "" {
+			playlist.Title = update.Title
+		}
+
+		playlist.Description = update.Description
+		playlist.IsPublic = update.IsPublic
+
+		err = playlist.Update(tp.db)
+	case taskAction.delete:
+		if err = playlist.SoftDelete(tp.db); err == nil {
+			tp.response.SendSuccess("playlist deleted")
+			return
+		}
+	case taskAction.add, taskAction.remove:
+		var videoID uint64
+
+		if videoID, err = strconv.ParseUint(tp.Extra, 10, 64); err != nil {
+			break
+		}
+
+		if tp.Action == taskAction.add {
+			err = playlist.AddVideo(tp.db, videoID)
+		} else {
+			err = playlist.RemoveVideo(tp.db, videoID)
+		}
+	case taskAction.reorder:
+		var videoIDs []uint64
+
+		if err = json.Unmarshal([]byte(tp.Extra), &videoIDs); err != nil {
+			break
+		}
+
+		err = playlist.Reorder(tp.db, videoIDs)
+	}
+
+	if err != nil {
+		tp.response.SendError(err.Error())
+		return
+	}
+
+	tp.performPlaylistGet(playlist.ID)
+}
+
+func (tp *TaskParams) performPlaylistFollow(playlist *models.Playlist, follow bool) {
+	if err := playlist.Follow(tp.db, tp.currentUser.ID, follow); err != nil {
+		tp.response.SendError(err.Error())
+		return
+	}
+
+	tp.response.SendSuccess(playlist)
+}
+
+func (tp *TaskParams) performPlaylistGet(id uint64) {
+	var playlist models.Playlist
+
+	if err := playlist.Get(tp.db, id, tp.currentUser.ID); err != nil {
+		tp.response.SendError(err.Error())
+		return
+	}
+
+	tp.response.SendSuccess(playlist)
+}
+
+// HTTP GET - retrieve the playlists of a user, private playlists
+// are only included for the current user
+// params - user_id, page
+func (s *Server) GetPlaylists(w rest.ResponseWriter, r *rest.Request) {
+	response := models.BaseResponse{}
+	response.Init(w)
+
+	currentUser, err := s.LoginProcess(response, r)
+
+	if err != nil {
+		return
+	}
+
+	page := s.GetPageFromParams(r)
+	userID, err := s.GetUserIDFromParams(r)
+
+	if err != nil || userID == 0 {
+		userID = currentUser.ID
+	}
+
+	var playlist models.Playlist
+
+	playlists, err := playlist.GetForUser(s.Db, userID, currentUser.ID, page)
+
+	if err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	response.SendSuccess(playlists)
+}
+
+// HTTP GET - retrieve the playlists the current user follows
+// params - page
+func (s *Server) GetFollowingPlaylists(w rest.ResponseWriter, r *rest.Request) {
+	response := models.BaseResponse{}
+	response.Init(w)
+
+	currentUser, err := s.LoginProcess(response, r)
+
+	if err != nil {
+		return
+	}
+
+	page := s.GetPageFromParams(r)
+
+	var playlist models.Playlist
+
+	playlists, err := playlist.GetFollowing(s.Db, currentUser.ID, page)
+
+	if err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	response.SendSuccess(playlists)
+}
+
+// HTTP GET - retrieve the videos of a playlist in order
+// params - playlist_id, page
+func (s *Server) GetPlaylistVideos(w rest.ResponseWriter, r *rest.Request) {
+	response := models.BaseResponse{}
+	response.Init(w)
+
+	currentUser, err := s.LoginProcess(response, r)
+
+	if err != nil {
+		return
+	}
+
+	page := s.GetPageFromParams(r)
+	playlistID, err := s.GetPlaylistIDFromParams(r)
+
+	if err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	var playlist models.Playlist
+
+	if err := playlist.Get(s.Db, playlistID, currentUser.ID); err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	videos, err := playlist.GetVideos(s.Db, currentUser.ID, page)
+
+	if err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	response.SendSuccess(videos)
+}
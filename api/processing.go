@@ -0,0 +1,52 @@
+package api
+
+import (
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/rathvong/talentmob_server/models"
+)
+
+// Processing status of a video. The jobs and error reason
+// are only shown to the creator of the video.
+func (s *Server) GetVideoProcessing(w rest.ResponseWriter, r *rest.Request) {
+	response := models.BaseResponse{}
+	response.Init(w)
+
+	currentUser, err := s.LoginProcess(response, r)
+
+	if err != nil {
+		return
+	}
+
+	videoID, err := s.GetVideoIDFromParams(r)
+
+	if err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	video := models.Video{}
+
+	if err := video.GetVideoByID(s.Db, videoID); err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	if !video.IsActive && video.UserID != currentUser.ID {
+		response.SendError(ErrorModelIsNotFound)
+		return
+	}
+
+	processing := models.VideoProcessing{}
+
+	if err := processing.Get(s.Db, video); err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	if video.UserID != currentUser.ID {
+		processing.Jobs = nil
+		processing.Error = ""
+	}
+
+	response.SendSuccess(processing)
+}
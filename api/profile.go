@@ -284,6 +284,47 @@ func (s *Server) GetStats(w rest.ResponseWriter, r *rest.Request) {
 	response.SendSuccess(stats)
 }
 
+// HTTP GET - retrieve a users daily stats with the change from day to day
+// params - user_id, days (7, 30 or 90)
+func (s *Server) GetStatsHistory(w rest.ResponseWriter, r *rest.Request) {
+	response := models.BaseResponse{}
+	response.Init(w)
+
+	currentUser, err := s.LoginProcess(response, r)
+
+	if err != nil {
+		return
+	}
+
+	userID, err := s.GetUserIDFromParams(r)
+
+	if err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	if userID == 0 {
+		userID = currentUser.ID
+	}
+
+	days := s.GetDaysFromParams(r)
+
+	if days == 0 {
+		days = models.UserStatRanges[0]
+	}
+
+	var stat models.UserStat
+
+	series, err := stat.GetSeries(s.Db, userID, days)
+
+	if err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	response.SendSuccess(series)
+}
+
 // HTTP POST - update user items
 
 func (s *Server) PostUpdateUser(w rest.ResponseWriter, r *rest.Request) {
@@ -453,3 +494,29 @@ func (s *Server) GetRelationships2(w rest.ResponseWriter, r *rest.Request) {
 	response.SendSuccess(relationships)
 
 }
+
+// HTTP GET - retrieve the users the current user has referred
+// params - page
+func (s *Server) GetReferrals(w rest.ResponseWriter, r *rest.Request) {
+	response := models.BaseResponse{}
+	response.Init(w)
+
+	currentUser, err := s.LoginProcess(response, r)
+
+	if err != nil {
+		return
+	}
+
+	page := s.GetPageFromParams(r)
+
+	var referral models.Referral
+
+	referrals, err := referral.GetForReferrer(s.Db, currentUser.ID, page)
+
+	if err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	response.SendSuccess(referrals)
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/rathvong/talentmob_server/models"
+)
+
+// HTTP POST - report a video, comment or profile
+// body - {"object_type": "video", "object_id": 1, "reason": "spam", "details": "..."}
+func (s *Server) PostReport(w rest.ResponseWriter, r *rest.Request) {
+	response := models.BaseResponse{}
+	response.Init(w)
+
+	currentUser, err := s.LoginProcess(response, r)
+
+	if err != nil {
+		return
+	}
+
+	var report models.Report
+
+	if err := r.DecodeJsonPayload(&report); err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	report.ReporterID = currentUser.ID
+
+	if err := report.Create(s.Db); err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	response.SendSuccess(report)
+}
+
+// Moderation queue of reports
+// extra - {"status": "pending", "page": 1}
+type ReportQueue struct {
+	Status string `json:"status"`
+	Page   int    `json:"page"`
+}
+
+// Moderator action on a report
+// extra - {"report_id": 1, "moderator_id": 1, "resolution": "takedown", "note": "..."}
+type ReportReview struct {
+	ReportID    uint64 `json:"report_id"`
+	ModeratorID uint64 `json:"moderator_id"`
+	Resolution  string `json:"resolution"`
+	Note        string `json:"note"`
+}
+
+func (st *SystemTaskParams) listReports() {
+	var queue ReportQueue
+
+	if st.Extra != "" {
+		if err := json.Unmarshal([]byte(st.Extra), &queue); err != nil {
+			st.response.SendError(err.Error())
+			return
+		}
+	}
+
+	var report models.Report
+
+	reports, err := report.GetQueue(st.db, queue.Status, queue.Page)
+
+	if err != nil {
+		st.response.SendError(err.Error())
+		return
+	}
+
+	st.response.SendSuccess(reports)
+}
+
+func (st *SystemTaskParams) claimReport() {
+	review, report, err := st.getReportReview()
+
+	if err != nil {
+		st.response.SendError(err.Error())
+		return
+	}
+
+	if err := report.Claim(st.db, review.ModeratorID); err != nil {
+		st.response.SendError(err.Error())
+		return
+	}
+
+	st.response.SendSuccess(report)
+}
+
+func (st *SystemTaskParams) resolveReport() {
+	review, report, err := st.getReportReview()
+
+	if err != nil {
+		st.response.SendError(err.Error())
+		return
+	}
+
+	if err := report.Resolve(st.db, review.ModeratorID, review.Resolution, review.Note); err != nil {
+		st.response.SendError(err.Error())
+		return
+	}
+
+	st.response.SendSuccess(report)
+}
+
+func (st *SystemTaskParams) getReportReview() (review ReportReview, report models.Report, err error) {
+
+	if st.Extra == "" {
+		err = errors.New("missing extra={report_id, moderator_id, resolution, note}")
+		return
+	}
+
+	if err = json.Unmarshal([]byte(st.Extra), &review); err != nil {
+		return
+	}
+
+	err = report.Get(st.db, review.ReportID)
+
+	return
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/rathvong/talentmob_server/models"
+)
+
+// Sanctions placed on a user
+// extra - {"user_id": 1, "page": 1}
+type SanctionHistory struct {
+	UserID uint64 `json:"user_id"`
+	Page   int    `json:"page"`
+}
+
+// Place a sanction on a user and notify them of it, shadowbans are
+// not announced. Leaving out hours makes the sanction permanent
+// extra - {"user_id": 1, "moderator_id": 2, "type": "comment_mute", "reason": "spam", "hours": 72}
+func (st *SystemTaskParams) issueSanction() {
+
+	if st.Extra == "" {
+		st.response.SendError("missing extra={user_id, moderator_id, type, reason, hours}")
+		return
+	}
+
+	var sanction models.Sanction
+
+	if err := json.Unmarshal([]byte(st.Extra), &sanction); err != nil {
+		st.response.SendError(err.Error())
+		return
+	}
+
+	if err := sanction.Create(st.db); err != nil {
+		st.response.SendError(err.Error())
+		return
+	}
+
+	if sanction.ModeratorID != 0 && sanction.Type != models.SanctionShadowban {
+		if err := models.Notify(st.db, sanction.ModeratorID, sanction.UserID, models.VERB_SANCTIONED, sanction.ID, models.OBJECT_SANCTION); err != nil {
+			log.Println("SystemTaskParams.issueSanction() Notify() Error -> ", err)
+		}
+	}
+
+	st.response.SendSuccess(sanction)
+}
+
+// Lift a sanction before it expires
+// extra - {"sanction_id": 1}
+func (st *SystemTaskParams) revokeSanction() {
+
+	if st.Extra == "" {
+		st.response.SendError("missing extra={sanction_id}")
+		return
+	}
+
+	var params struct {
+		SanctionID uint64 `json:"sanction_id"`
+	}
+
+	if err := json.Unmarshal([]byte(st.Extra), &params); err != nil {
+		st.response.SendError(err.Error())
+		return
+	}
+
+	var sanction models.Sanction
+
+	if err := sanction.Get(st.db, params.SanctionID); err != nil {
+		st.response.SendError(err.Error())
+		return
+	}
+
+	if err := sanction.Revoke(st.db); err != nil {
+		st.response.SendError(err.Error())
+		return
+	}
+
+	st.response.SendSuccess(sanction)
+}
+
+func (st *SystemTaskParams) listSanctions() {
+	var history SanctionHistory
+
+	if st.Extra == "" {
+		st.response.SendError("missing extra={user_id, page}")
+		return
+	}
+
+	if err := json.Unmarshal([]byte(st.Extra), &history); err != nil {
+		st.response.SendError(err.Error())
+		return
+	}
+
+	var sanction models.Sanction
+
+	sanctions, err := sanction.GetForUser(st.db, history.UserID, history.Page)
+
+	if err != nil {
+		st.response.SendError(err.Error())
+		return
+	}
+
+	st.response.SendSuccess(sanctions)
+}
@@ -2,16 +2,21 @@ package api
 
 import (
 	"log"
+	"net"
 	"net/http"
+	"strings"
 
 	"github.com/ant0ine/go-json-rest/rest"
 
 	"errors"
 	"net/url"
 	"os"
+	"strconv"
 
 	"github.com/rathvong/talentmob_server/models"
+	"github.com/rathvong/talentmob_server/storage"
 	"github.com/rathvong/talentmob_server/system"
+	"github.com/rathvong/talentmob_server/transcoder"
 	"github.com/rathvong/util"
 )
 
@@ -43,6 +48,12 @@ const (
 	UrlGetUserFavouriteVideos  = "/api/" + Version + "/u/videos/favourite/:params"
 	UrlGetUserImportedVideos2  = "/api/" + "2" + "/u/videos/imported/:params"
 	UrlGetUserFavouriteVideos2 = "/api/" + "2" + "/u/videos/favourite/:params"
+	UrlGetUserDrafts           = "/api/" + Version + "/u/videos/drafts/:params"
+	UrlGetUserTrash            = "/api/" + Version + "/u/videos/trash/:params"
+
+	UrlGetUserPlaylists          = "/api/" + Version + "/u/playlists/:params"
+	UrlGetUserFollowingPlaylists = "/api/" + Version + "/u/playlists/following/:params"
+	UrlGetPlaylistVideos         = "/api/" + Version + "/playlist/videos/:params"
 
 	UrlGetUserProfile  = "/api/" + Version + "/u/:params"
 	UrlGetUserProfile2 = "/api/" + "2" + "/u/:params"
@@ -50,9 +61,10 @@ const (
 	UrlGetRelationship  = "/api/" + Version + "/u/relationships/:params"
 	UrlGetRelationship2 = "/api/" + "2" + "/u/relationships/:params"
 
-	UrlGetStats     = "/api/" + Version + "/u/stats/:params"
-	UrlGetTimeLine  = "/api/" + Version + "/time-line/:params"
-	UrlGetTimeLine2 = "/api/" + "2" + "/time-line/:params"
+	UrlGetStats        = "/api/" + Version + "/u/stats/:params"
+	UrlGetStatsHistory = "/api/" + Version + "/u/stats/history/:params"
+	UrlGetTimeLine     = "/api/" + Version + "/time-line/:params"
+	UrlGetTimeLine2    = "/api/" + "2" + "/time-line/:params"
 
 	UrlGetHistory      = "/api/" + Version + "/history/:params"
 	UrlGetLeaderBoard  = "/api/" + Version + "/leaderboard/:params"
@@ -64,6 +76,10 @@ const (
 	UrlGetEvents  = "/api/" + Version + "/events/:params"
 	UrlGetEvents2 = "/api/" + "2" + "/events/:params"
 
+	UrlPostUploadURL             = "/api/" + Version + "/upload/url"
+	UrlPostUploadSession         = "/api/" + Version + "/upload/session"
+	UrlPostUploadSessionFinalize = "/api/" + Version + "/upload/session/finalize"
+
 	UrlPostVideo  = "/api/" + Version + "/video"
 	UrlPostVideo2 = "/api/" + "2" + "/video"
 
@@ -76,6 +92,15 @@ const (
 	UrlGetUpVotedUsersOnVideo  = "/api/" + Version + "/video/upvote/:params"
 	UrlGetUpVotedUsersOnVideo2 = "/api/" + "2" + "/video/upvote/:params"
 
+	UrlGetVideoResponses = "/api/" + Version + "/video/responses/:params"
+
+	UrlGetVideoProcessing = "/api/" + Version + "/video/processing/:params"
+
+	UrlGetVideoStream = "/api/" + Version + "/video/stream/:params"
+
+	UrlPostVideoCaption = "/api/" + Version + "/video/caption"
+	UrlGetVideoCaption  = "/api/" + Version + "/video/caption/:params"
+
 	UrlGetComments  = "/api/" + Version + "/comments/:params"
 	UrlGetComments2 = "/api/" + "2" + "/comments/:params"
 
@@ -99,6 +124,26 @@ const (
 
 	UrlGetTrendingEvents = "/api/" + Version + "/events/trending/:params"
 
+	UrlPostVerification = "/api/" + Version + "/u/verification"
+	UrlGetVerifications = "/api/" + Version + "/u/verification/:params"
+
+	UrlGetReferrals = "/api/" + Version + "/u/referrals/:params"
+
+	UrlGetFeed = "/api/" + Version + "/feed/:params"
+
+	UrlPostReport = "/api/" + Version + "/report"
+
+	UrlPostShare        = "/api/" + Version + "/share"
+	UrlPostShareInstall = "/api/" + Version + "/share/install"
+	UrlGetShares        = "/api/" + Version + "/u/shares/:params"
+	UrlGetShareRedirect = "/s/:code"
+
+	UrlPostWatchSession = "/api/" + Version + "/watch"
+
+	UrlGetAppleAppSiteAssociation          = "/apple-app-site-association"
+	UrlGetWellKnownAppleAppSiteAssociation = "/.well-known/apple-app-site-association"
+	UrlGetAssetLinks                       = "/.well-known/assetlinks.json"
+
 	DefaultAddressPort = "8080"
 )
 
@@ -106,7 +151,20 @@ const (
 // will hold a reference to database
 // for all DB calls
 type Server struct {
-	Db *system.DB
+	Db         *system.DB
+	Transcoder transcoder.Transcoder
+	Storage    storage.Storage
+}
+
+// Create the object store set in the environment
+func (s *Server) initStorage() (err error) {
+	if s.Storage != nil {
+		return
+	}
+
+	s.Storage, err = storage.New()
+
+	return
 }
 
 // The address port used to connect to REST service
@@ -144,6 +202,11 @@ func (s *Server) Serve() {
 		rest.Get(UrlGetUserFavouriteVideos, s.GetFavouriteVideos),
 		rest.Get(UrlGetUserImportedVideos2, s.GetImportedVideos2),
 		rest.Get(UrlGetUserFavouriteVideos2, s.GetFavouriteVideos2),
+		rest.Get(UrlGetUserDrafts, s.GetDrafts),
+		rest.Get(UrlGetUserTrash, s.GetTrash),
+		rest.Get(UrlGetUserPlaylists, s.GetPlaylists),
+		rest.Get(UrlGetUserFollowingPlaylists, s.GetFollowingPlaylists),
+		rest.Get(UrlGetPlaylistVideos, s.GetPlaylistVideos),
 
 		rest.Get(UrlGetUserProfile, s.GetProfile),
 		rest.Get(UrlGetUserProfile2, s.GetProfile2),
@@ -184,8 +247,17 @@ func (s *Server) Serve() {
 		//	rest.Post(UrlPostUserInstagramLogin, s.LoginWithInstagram),
 		rest.Get(UrlGetUpVotedUsersOnVideo, s.GetUpVotedUsersOnVideo),
 		rest.Get(UrlGetUpVotedUsersOnVideo2, s.GetUpVotedUsersOnVideo2),
+		rest.Get(UrlGetVideoResponses, s.GetVideoResponses),
+		rest.Get(UrlGetVideoProcessing, s.GetVideoProcessing),
+		rest.Get(UrlGetVideoStream, s.GetVideoStream),
+		rest.Post(UrlPostVideoCaption, s.PostVideoCaption),
+		rest.Get(UrlGetVideoCaption, s.GetVideoCaption),
+		rest.Post(UrlPostUploadURL, s.PostUploadURL),
+		rest.Post(UrlPostUploadSession, s.PostUploadSession),
+		rest.Post(UrlPostUploadSessionFinalize, s.PostUploadSessionFinalize),
 
 		rest.Get(UrlGetStats, s.GetStats),
+		rest.Get(UrlGetStatsHistory, s.GetStatsHistory),
 		rest.Post(UrlPostElasticTranscoding, s.PostElasticTranscoding),
 		rest.Post(UrlPostTransaction, s.PostTransaction),
 		rest.Get(UrlGetTransactions, s.GetTransactions),
@@ -194,6 +266,26 @@ func (s *Server) Serve() {
 		rest.Get(UrlGetNotifications, s.GetNotifications),
 
 		rest.Get(UrlGetTrendingEvents, s.GetTrendingEvents),
+
+		rest.Post(UrlPostVerification, s.PostVerification),
+		rest.Get(UrlGetVerifications, s.GetVerifications),
+
+		rest.Get(UrlGetReferrals, s.GetReferrals),
+
+		rest.Get(UrlGetFeed, s.GetFeed),
+
+		rest.Post(UrlPostReport, s.PostReport),
+
+		rest.Post(UrlPostShare, s.PostShare),
+		rest.Post(UrlPostShareInstall, s.PostShareInstall),
+		rest.Get(UrlGetShares, s.GetShares),
+		rest.Get(UrlGetShareRedirect, s.GetShareRedirect),
+
+		rest.Post(UrlPostWatchSession, s.PostWatchSession),
+
+		rest.Get(UrlGetAppleAppSiteAssociation, s.GetAppleAppSiteAssociation),
+		rest.Get(UrlGetWellKnownAppleAppSiteAssociation, s.GetAppleAppSiteAssociation),
+		rest.Get(UrlGetAssetLinks, s.GetAssetLinks),
 	)
 
 	if err != nil {
@@ -202,8 +294,19 @@ func (s *Server) Serve() {
 
 	service.SetApp(router)
 
+	s.startJobs()
+
+	if err := s.initStorage(); err != nil {
+		log.Fatal(err)
+	}
+
 	//***** Handle API
 	http.Handle(UrlMakeHandle, service.MakeHandler())
+
+	// presigned urls for the local store are served by the api
+	if local, ok := s.Storage.(*storage.Local); ok {
+		http.Handle(storage.LocalURLPath, local)
+	}
 	log.Fatal(http.ListenAndServe(s.getAddressPort(), nil))
 
 }
@@ -254,6 +357,10 @@ func (s *Server) AuthenticateHeaderForUser(r *rest.Request) (isAuthenticated boo
 		return false, user, errors.New("user is not active")
 	}
 
+	if err = models.CheckSanction(s.Db, user.ID, models.SanctionBan); err != nil {
+		return false, user, err
+	}
+
 	if err = user.Bio.Get(s.Db, user.ID); err != nil {
 		return
 	}
@@ -290,6 +397,28 @@ func (s *Server) LoginProcess(response models.BaseResponse, r *rest.Request) (cu
 	return
 }
 
+// Address of the client. The Heroku router appends the address it
+// received the request from to X-Forwarded-For, so only the last entry
+// can be trusted, earlier entries are sent by the client. Set
+// TRUST_PROXY to false when the server is not behind a router.
+func (s *Server) GetIPAddress(r *rest.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" && os.Getenv("TRUST_PROXY") != "false" {
+		entries := strings.Split(forwarded, ",")
+
+		if address := strings.TrimSpace(entries[len(entries)-1]); address != "" {
+			return address
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
 // todo: Update Page params request by data structure
 //  func (s *Server) ParamsString(r *rest.Request, key string) (param string)
 //  func (s *Server) ParamsUint(r *rest.Request, key string) (param uint)
@@ -346,6 +475,21 @@ func (s *Server) GetEventIDFromParams(r *rest.Request) (eventID uint64, err erro
 
 }
 
+// parse for rendition in params
+func (s *Server) GetRenditionFromParams(r *rest.Request) string {
+	params := r.PathParam("params")
+	values, _ := url.ParseQuery(params)
+
+	return values.Get("rendition")
+}
+
+func (s *Server) GetPlaylistIDFromParams(r *rest.Request) (playlistID uint64, err error) {
+	params := r.PathParam("params")
+	values, _ := url.ParseQuery(params)
+
+	return util.ConvertToUint64(values.Get("playlist_id"))
+}
+
 // parse query  in params
 func (s *Server) GetQueryFromParams(r *rest.Request) (param string) {
 	params := r.PathParam("params")
@@ -356,6 +500,26 @@ func (s *Server) GetQueryFromParams(r *rest.Request) (param string) {
 	return
 }
 
+// parse number of days in params
+func (s *Server) GetDaysFromParams(r *rest.Request) (days int) {
+	params := r.PathParam("params")
+	values, _ := url.ParseQuery(params)
+
+	days, _ = strconv.Atoi(values.Get("days"))
+
+	return
+}
+
+// parse cursor in params
+func (s *Server) GetCursorFromParams(r *rest.Request) (param string) {
+	params := r.PathParam("params")
+	values, _ := url.ParseQuery(params)
+
+	param = values.Get("cursor")
+
+	return
+}
+
 func (s *Server) GetQueryTypeFromParams(r *rest.Request) (param string) {
 	params := r.PathParam("params")
 	values, _ := url.ParseQuery(params)
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/rathvong/talentmob_server/models"
+)
+
+// Share link a new account was signed up from, reported by the app
+// once the account is logged in
+// body - {"code": "aBc23dEf45"}
+type ShareInstall struct {
+	Code string `json:"code"`
+}
+
+// HTTP POST - mint a share code for a video
+// body - {"video_id": 1, "channel": "whatsapp"}
+func (s *Server) PostShare(w rest.ResponseWriter, r *rest.Request) {
+	response := models.BaseResponse{}
+	response.Init(w)
+
+	currentUser, err := s.LoginProcess(response, r)
+
+	if err != nil {
+		return
+	}
+
+	var share models.Share
+
+	if err := r.DecodeJsonPayload(&share); err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	share.UserID = currentUser.ID
+
+	if err := share.Create(s.Db); err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	response.SendSuccess(share)
+}
+
+// HTTP GET - share codes minted by the current user with their stats
+func (s *Server) GetShares(w rest.ResponseWriter, r *rest.Request) {
+	response := models.BaseResponse{}
+	response.Init(w)
+
+	currentUser, err := s.LoginProcess(response, r)
+
+	if err != nil {
+		return
+	}
+
+	page := s.GetPageFromParams(r)
+
+	var share models.Share
+
+	shares, err := share.GetForUser(s.Db, currentUser.ID, page)
+
+	if err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	response.SendSuccess(shares)
+}
+
+// HTTP GET - public share link, counts the click once per address and
+// redirects to the shared video. Unknown codes are sent
+// to the landing page so a link never breaks.
+func (s *Server) GetShareRedirect(w rest.ResponseWriter, r *rest.Request) {
+	location := models.ShareLandingAddress
+
+	var share models.Share
+
+	if err := share.Click(s.Db, r.PathParam("code"), s.GetIPAddress(r)); err == nil {
+		location = fmt.Sprintf("%v/%v?share=%v", models.ShareLandingAddress, share.VideoID, share.Code)
+	}
+
+	w.Header().Set("Location", location)
+	w.WriteHeader(http.StatusFound)
+}
+
+// HTTP POST - record a new account signed up from a share link,
+// the device is taken from the session of the current user
+// body - {"code": "aBc23dEf45"}
+func (s *Server) PostShareInstall(w rest.ResponseWriter, r *rest.Request) {
+	response := models.BaseResponse{}
+	response.Init(w)
+
+	currentUser, err := s.LoginProcess(response, r)
+
+	if err != nil {
+		return
+	}
+
+	var install ShareInstall
+
+	if err := r.DecodeJsonPayload(&install); err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	var share models.Share
+
+	if err := share.Install(s.Db, install.Code, currentUser, currentUser.Api.DeviceID); err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	response.SendSuccess(install)
+}
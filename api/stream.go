@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/rathvong/talentmob_server/models"
+)
+
+func init() {
+	// urls built by models follow the route they are served from
+	models.StreamPath = strings.TrimSuffix(UrlGetVideoStream, ":params")
+}
+
+// HLS playlists of a video, the master playlist or one rendition when
+// rendition is set in the params. Players can not send the api token
+// so the playlists are public, only active videos are served.
+func (s *Server) GetVideoStream(w rest.ResponseWriter, r *rest.Request) {
+	response := models.BaseResponse{}
+	response.Init(w)
+
+	videoID, err := s.GetVideoIDFromParams(r)
+
+	if err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	video := models.Video{}
+
+	if err := video.GetVideoByID(s.Db, videoID); err != nil || !video.IsActive || video.StreamURL == "" {
+		w.WriteHeader(http.StatusNotFound)
+		response.SendError(ErrorModelIsNotFound)
+		return
+	}
+
+	var playlist string
+
+	if rendition := s.GetRenditionFromParams(r); rendition != "" {
+		playlist, err = models.RenditionPlaylist(s.Db, s.Storage, video.ID, rendition)
+	} else {
+		playlist, err = models.MasterPlaylist(s.Db, video.ID)
+	}
+
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		response.SendError(err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.Header().Set("Cache-Control", "private, max-age=60")
+	w.WriteHeader(http.StatusOK)
+	w.(http.ResponseWriter).Write([]byte(playlist))
+}
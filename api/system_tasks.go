@@ -5,30 +5,16 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"os"
+	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/ant0ine/go-json-rest/rest"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/elastictranscoder"
 	"github.com/rathvong/scheduler"
 	"github.com/rathvong/talentmob_server/models"
+	"github.com/rathvong/talentmob_server/sns"
 	"github.com/rathvong/talentmob_server/system"
-)
-
-var (
-	aws_access_key_id     = os.Getenv("AWS_ACCESS_KEY")
-	aws_secret_access_key = os.Getenv("AWS_SECRET_KEY")
-)
-
-var (
-	presetID          = "1530091735460-a9qb9y"
-	transcodedPreset  = "1529819336285-0bgk6m"
-	waterMarkInputKey = "large_watermark.png"
-	waterMarkPresetId = "BottomRight"
+	"github.com/rathvong/talentmob_server/transcoder"
 )
 
 var SystemTaskType = SystemTaskTypes{
@@ -38,22 +24,20 @@ var SystemTaskType = SystemTaskTypes{
 	TranscodeWithWatermarkVideo:     "transcode_with_watermark_video",
 	TranscodeAllVideos:              "transcode_all_videos",
 	TranscodeVideo:                  "transcode_video",
-}
-
-var transcodingAllWithWatermarkRunning bool
-
-var transcodingAllRunning bool
-
-func initTranscoder() *elastictranscoder.ElasticTranscoder {
-	creds := credentials.NewStaticCredentials(aws_access_key_id, aws_secret_access_key, "")
-
-	sess, err := session.NewSession(aws.NewConfig().WithCredentials(creds).WithRegion("us-west-2"))
-
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	return elastictranscoder.New(sess)
+	ListVerifications:               "list_verifications",
+	ApproveVerification:             "approve_verification",
+	RejectVerification:              "reject_verification",
+	RevokeVerification:              "revoke_verification",
+	RollupUserStats:                 "rollup_user_stats",
+	ListReports:                     "list_reports",
+	ClaimReport:                     "claim_report",
+	ResolveReport:                   "resolve_report",
+	IssueSanction:                   "issue_sanction",
+	RevokeSanction:                  "revoke_sanction",
+	ListSanctions:                   "list_sanctions",
+	ListFlaggedVideos:               "list_flagged_videos",
+	ApproveFlaggedVideo:             "approve_flagged_video",
+	RejectFlaggedVideo:              "reject_flagged_video",
 }
 
 type SystemTaskTypes struct {
@@ -63,6 +47,20 @@ type SystemTaskTypes struct {
 	TranscodeWithWatermarkVideo     string
 	TranscodeVideo                  string
 	TranscodeAllVideos              string
+	ListVerifications               string
+	ApproveVerification             string
+	RejectVerification              string
+	RevokeVerification              string
+	RollupUserStats                 string
+	ListReports                     string
+	ClaimReport                     string
+	ResolveReport                   string
+	IssueSanction                   string
+	RevokeSanction                  string
+	ListSanctions                   string
+	ListFlaggedVideos               string
+	ApproveFlaggedVideo             string
+	RejectFlaggedVideo              string
 }
 
 type SystemTaskParams struct {
@@ -116,6 +114,34 @@ func (st *SystemTaskParams) validateTasks() (err error) {
 		st.transcodeVideo()
 	case SystemTaskType.TranscodeAllVideos:
 		st.transcodeAllVideos()
+	case SystemTaskType.ListVerifications:
+		st.listVerifications()
+	case SystemTaskType.ApproveVerification:
+		st.reviewVerification(models.VerificationStatusApproved)
+	case SystemTaskType.RejectVerification:
+		st.reviewVerification(models.VerificationStatusRejected)
+	case SystemTaskType.RevokeVerification:
+		st.reviewVerification(models.VerificationStatusRevoked)
+	case SystemTaskType.RollupUserStats:
+		st.rollupUserStats()
+	case SystemTaskType.ListReports:
+		st.listReports()
+	case SystemTaskType.ClaimReport:
+		st.claimReport()
+	case SystemTaskType.ResolveReport:
+		st.resolveReport()
+	case SystemTaskType.IssueSanction:
+		st.issueSanction()
+	case SystemTaskType.RevokeSanction:
+		st.revokeSanction()
+	case SystemTaskType.ListSanctions:
+		st.listSanctions()
+	case SystemTaskType.ListFlaggedVideos:
+		st.listFlaggedVideos()
+	case SystemTaskType.ApproveFlaggedVideo:
+		st.reviewFlaggedVideo(true)
+	case SystemTaskType.RejectFlaggedVideo:
+		st.reviewFlaggedVideo(false)
 
 	default:
 		return errors.New(ErrorActionIsNotSupported + fmt.Sprintf(" Task Available: %+v", SystemTaskType))
@@ -155,188 +181,27 @@ func (st *SystemTaskParams) addPointsToUsers() {
 	st.response.SendSuccess("update finished.")
 }
 
+// Queue a watermark job for a video, the transcode worker submits it
 func (st *SystemTaskParams) transcodeWithWatermarkVideo() {
-
-	if st.Extra == "" {
-		st.response.SendError("missing extra={video_id}")
-		return
-	}
-
-	videoID, err := strconv.Atoi(st.Extra)
-	if err != nil {
-		st.response.SendError(err.Error())
-		return
-	}
-
-	var video models.Video
-
-	if err := video.GetVideoByID(st.db, uint64(videoID)); err != nil {
-		st.response.SendError(err.Error())
-		return
-	}
-
-	log.Printf("transcoding video: %+v\n ", video)
-	et := initTranscoder()
-
-	outputKey := video.Key + ".mp4"
-	thumbnailPattern := video.Key + "-{count}"
-
-	waterMark := &elastictranscoder.JobWatermark{InputKey: &waterMarkInputKey, PresetWatermarkId: &waterMarkPresetId}
-
-	params := &elastictranscoder.CreateJobInput{
-		Input: &elastictranscoder.JobInput{
-			AspectRatio: aws.String("auto"),
-			Container:   aws.String("auto"),
-			FrameRate:   aws.String("auto"),
-			Interlaced:  aws.String("auto"),
-			Key:         aws.String(video.Key), // the "filename" in S3
-			Resolution:  aws.String("auto"),
-		},
-		PipelineId: aws.String("1528550420987-fmmf1s"), // Pipeline can be created via console
-		Output: &elastictranscoder.CreateJobOutput{
-			Key:              aws.String(outputKey),
-			PresetId:         aws.String(presetID), // Generic 1080p H.264
-			Rotate:           aws.String("auto"),
-			ThumbnailPattern: aws.String(thumbnailPattern),
-			Watermarks:       []*elastictranscoder.JobWatermark{waterMark},
-		},
-	}
-
-	if err := params.Validate(); err != nil {
-		st.response.SendError(err.Error())
-		return
-	}
-
-	res, err := et.CreateJob(params)
-
-	if err != nil {
-		st.response.SendError(err.Error())
-		return
-	}
-
-	log.Printf("Job Response: %v\n", res.Job)
-
-	var trancoded = models.Transcoded{
-		VideoID:                video.ID,
-		TranscodedWatermarkKey: outputKey,
-		TranscodedThumbnailKey: thumbnailPattern,
-		TranscodedKey:          outputKey,
-	}
-
-	if exists, err := trancoded.Exists(st.db, video.ID); err != nil || exists {
-
-		if err != nil {
-			st.response.SendError(err.Error())
-			return
-		}
-
-		st.response.SendSuccess("Transcoding Job has started")
-		return
-	}
-
-	if err := trancoded.Create(st.db); err != nil {
-		log.Printf("Transcode All: video_id: %v Error %v", video.ID, err)
-		st.response.SendError(err.Error())
-	}
-
-	st.response.SendSuccess("Transcoding Job has started")
+	st.queueTranscodeJob(models.TranscodeJobKindWatermark)
 }
 
+// Queue a watermark job for every active video
 func (st *SystemTaskParams) transcodeWithWatermarkAllVideos() {
-	log.Println("Transcode all: start")
-	var t models.Transcoded
-
-	if transcodingAllWithWatermarkRunning {
-		st.response.SendError("job is already in progress")
-		return
-	}
-
-	videos, err := t.GetAllVideos(st.db)
-
-	if err != nil {
-		st.response.SendError(err.Error())
-		return
-	}
-
-	log.Printf("Number of videos to transcode: %d", len(videos))
-
-	transcodingAllWithWatermarkRunning = true
-
-	et := initTranscoder()
-
-	go func() {
-
-		for _, video := range videos {
-
-			log.Printf("transcoding video: %+v\n ", video)
-			outputKey := video.Key + ".mp4"
-			thumbnailPattern := video.Key + "-{count}"
-
-			waterMark := &elastictranscoder.JobWatermark{InputKey: &waterMarkInputKey, PresetWatermarkId: &waterMarkPresetId}
-
-			params := &elastictranscoder.CreateJobInput{
-				Input: &elastictranscoder.JobInput{
-					AspectRatio: aws.String("auto"),
-					Container:   aws.String("auto"),
-					FrameRate:   aws.String("auto"),
-					Interlaced:  aws.String("auto"),
-					Key:         aws.String(video.Key), // the "filename" in S3
-					Resolution:  aws.String("auto"),
-				},
-				PipelineId: aws.String("1528550420987-fmmf1s"), // Pipeline can be created via console
-				Output: &elastictranscoder.CreateJobOutput{
-					Key:              aws.String(outputKey),
-					PresetId:         aws.String(presetID), // Generic 1080p H.264
-					Rotate:           aws.String("auto"),
-					ThumbnailPattern: aws.String(thumbnailPattern),
-					Watermarks:       []*elastictranscoder.JobWatermark{waterMark},
-				},
-			}
-
-			if err := params.Validate(); err != nil {
-				continue
-			}
-
-			res, err := et.CreateJob(params)
-
-			if err != nil {
-				log.Println("Failed to create job: ", err)
-				continue
-			}
-
-			log.Printf("Job Response: %v\n", res.Job)
-
-			var trancoded = models.Transcoded{
-				VideoID:                video.ID,
-				TranscodedWatermarkKey: outputKey,
-				TranscodedThumbnailKey: thumbnailPattern,
-				TranscodedKey:          outputKey,
-			}
-
-			if exists, err := trancoded.Exists(st.db, video.ID); err != nil || exists {
-
-				if err != nil {
-					log.Print(err)
-					continue
-				}
-
-				continue
-			}
-
-			if err := trancoded.Create(st.db); err != nil {
-				log.Printf("Transcode All: video_id: %v Error %v", video.ID, err)
-			}
-
-			st.response.SendSuccess("Transcoding Job has started")
-		}
+	st.queueTranscodeJobsForAllVideos(models.TranscodeJobKindWatermark)
+}
 
-		transcodingAllWithWatermarkRunning = false
-	}()
+// Queue a transcode job for a video, the transcode worker submits it
+func (st *SystemTaskParams) transcodeVideo() {
+	st.queueTranscodeJob(models.TranscodeJobKindTranscode)
+}
 
-	st.response.SendSuccess("Transcoding Job has started")
+// Queue a transcode job for every active video
+func (st *SystemTaskParams) transcodeAllVideos() {
+	st.queueTranscodeJobsForAllVideos(models.TranscodeJobKindTranscode)
 }
 
-func (st *SystemTaskParams) transcodeVideo() {
+func (st *SystemTaskParams) queueTranscodeJob(kind string) {
 
 	if st.Extra == "" {
 		st.response.SendError("missing extra={video_id}")
@@ -356,169 +221,34 @@ func (st *SystemTaskParams) transcodeVideo() {
 		return
 	}
 
-	log.Printf("transcoding video: %+v\n ", video)
-	et := initTranscoder()
+	job := models.TranscodeJob{VideoID: video.ID, Kind: kind, InputKey: video.Key}
 
-	outputKey := video.Key + ".mp4"
-	thumbnailPattern := video.Key + "-{count}"
-
-	params := &elastictranscoder.CreateJobInput{
-		Input: &elastictranscoder.JobInput{
-			AspectRatio: aws.String("auto"),
-			Container:   aws.String("auto"),
-			FrameRate:   aws.String("auto"),
-			Interlaced:  aws.String("auto"),
-			Key:         aws.String(video.Key), // the "filename" in S3
-			Resolution:  aws.String("auto"),
-		},
-		PipelineId: aws.String("1529303979535-ru9lk4"), // Pipeline can be created via console
-		Output: &elastictranscoder.CreateJobOutput{
-			Key:              aws.String(outputKey),
-			PresetId:         aws.String(transcodedPreset), // Generic 1080p H.264
-			Rotate:           aws.String("auto"),
-			ThumbnailPattern: aws.String(thumbnailPattern),
-		},
-	}
-
-	if err := params.Validate(); err != nil {
-		st.response.SendError(err.Error())
-		return
-	}
-
-	res, err := et.CreateJob(params)
-
-	if err != nil {
-		st.response.SendError(err.Error())
-		return
-	}
-
-	log.Printf("Job Response: %v\n", res.Job)
-
-	var trancoded = models.Transcoded{
-		VideoID:                video.ID,
-		TranscodedWatermarkKey: outputKey,
-		TranscodedThumbnailKey: thumbnailPattern,
-		TranscodedKey:          outputKey,
-	}
-
-	if exists, err := trancoded.Exists(st.db, video.ID); err != nil || exists {
-
-		if err != nil {
-			st.response.SendError(err.Error())
-			return
-		}
-
-		st.response.SendSuccess("Transcoding Job has started")
-		return
-	}
-
-	if err := trancoded.Create(st.db); err != nil {
-		log.Printf("Transcode All: video_id: %v Error %v", video.ID, err)
+	if err := job.Create(st.db); err != nil {
 		st.response.SendError(err.Error())
 		return
 	}
 
-	st.response.SendSuccess("Transcoding Job has started")
+	st.response.SendSuccess("Transcoding Job has been queued")
 }
 
-func (st *SystemTaskParams) transcodeAllVideos() {
-	log.Println("Transcode all: start")
-	var t models.Transcoded
-
-	if transcodingAllRunning {
-		st.response.SendError("job is already in progress")
-		return
-	}
-
-	videos, err := t.GetAllVideos(st.db)
+func (st *SystemTaskParams) queueTranscodeJobsForAllVideos(kind string) {
 
-	if err != nil {
+	if err := models.QueueTranscodeJobsForAllVideos(st.db, kind); err != nil {
 		st.response.SendError(err.Error())
 		return
 	}
 
-	log.Printf("Number of videos to transcode: %d", len(videos))
-
-	transcodingAllRunning = true
-
-	et := initTranscoder()
-
-	go func() {
-
-		for _, video := range videos {
-
-			log.Printf("transcoding video: %+v\n ", video)
-
-			outputKey := video.Key + ".mp4"
-			thumbnailPattern := video.Key + "-{count}"
-
-			params := &elastictranscoder.CreateJobInput{
-				Input: &elastictranscoder.JobInput{
-					AspectRatio: aws.String("auto"),
-					Container:   aws.String("auto"),
-					FrameRate:   aws.String("auto"),
-					Interlaced:  aws.String("auto"),
-					Key:         aws.String(video.Key), // the "filename" in S3
-					Resolution:  aws.String("auto"),
-				},
-				PipelineId: aws.String("1529303979535-ru9lk4"), // Pipeline can be created via console
-				Output: &elastictranscoder.CreateJobOutput{
-					Key:              aws.String(outputKey),
-					PresetId:         aws.String(transcodedPreset), // Generic 1080p H.264
-					Rotate:           aws.String("auto"),
-					ThumbnailPattern: aws.String(thumbnailPattern),
-				},
-			}
-
-			if err := params.Validate(); err != nil {
-				continue
-			}
-
-			res, err := et.CreateJob(params)
-
-			if err != nil {
-				log.Println("Failed to create job: ", err)
-				continue
-			}
-
-			log.Printf("Job Response: %v\n", res.Job)
-
-			var trancoded = models.Transcoded{
-				VideoID:                video.ID,
-				TranscodedWatermarkKey: outputKey,
-				TranscodedThumbnailKey: thumbnailPattern,
-				TranscodedKey:          outputKey,
-			}
-
-			if exists, err := trancoded.Exists(st.db, video.ID); err != nil || exists {
-
-				if err != nil {
-					log.Print(err)
-					continue
-				}
-
-				continue
-			}
-
-			if err := trancoded.Create(st.db); err != nil {
-				log.Printf("Transcode All: video_id: %v Error %v", video.ID, err)
-			}
-
-		}
-
-		transcodingAllRunning = false
-	}()
-
-	st.response.SendSuccess("Transcoding Job has started")
+	st.response.SendSuccess("Transcoding Jobs have been queued")
 }
 
+// Notification sent by Elastic Transcoder in the Message of an SNS notification
 type ElasticTranscoderResponse struct {
-	State      string `json:"state"`
-	Version    string `json:"version"`
-	JobID      string `json:"jobId"`
-	PipelineID string `json:"pipelineId"`
-	Input      Input  `json:"input"`
-	Outputs    string `json:"output"`
+	State      string   `json:"state"`
+	Version    string   `json:"version"`
+	JobID      string   `json:"jobId"`
+	PipelineID string   `json:"pipelineId"`
+	Input      Input    `json:"input"`
+	Outputs    []Output `json:"outputs"`
 }
 
 type Input struct {
@@ -527,7 +257,7 @@ type Input struct {
 
 type Output struct {
 	ID               string `json:"id"`
-	PresetID         string `json:"presedId"`
+	PresetID         string `json:"presetId"`
 	Key              string `json:"key"`
 	ThumbnailPattern string `json:"thumbnailPattern"`
 	Rotate           string `json:"rotate"`
@@ -535,47 +265,118 @@ type Output struct {
 	Duration         int    `json:"duration"`
 }
 
+// Verifies the SNS messages posted to PostElasticTranscoding
+var snsVerifier = sns.NewVerifier()
+
+// Handle the SNS messages for the Elastic Transcoder topic. Every message
+// must be signed by SNS for a topic listed in SNS_TOPIC_ARNS, nothing is
+// accepted when it is unset. Subscriptions to those topics are confirmed
+// automatically and a message id is only processed once.
 func (s *Server) PostElasticTranscoding(w rest.ResponseWriter, r *rest.Request) {
 
-	var er ElasticTranscoderResponse
-	var en ElasticTranscoderNotification
+	var message sns.Message
 	response := models.BaseResponse{}
 
 	response.Init(w)
 
-	if err := r.DecodeJsonPayload(&er); err != nil {
+	if err := r.DecodeJsonPayload(&message); err != nil {
 		log.Println("PostElasticTransoding() Error: ", err)
+		w.WriteHeader(http.StatusBadRequest)
 		response.SendError(err.Error())
 		return
 	}
 
-	if err := en.SetResponse(er); err != nil {
-		log.Println("PostElasticTransoding() Error: ", err)
-
+	if err := snsVerifier.Verify(&message); err != nil {
+		log.Printf("PostElasticTransoding() message_id: %v Verify() Error: %v", message.MessageID, err)
+		w.WriteHeader(http.StatusForbidden)
 		response.SendError(err.Error())
 		return
 	}
 
-	var transcoded models.Transcoded
+	record := models.SNSMessage{MessageID: message.MessageID, TopicArn: message.TopicArn, Type: message.Type}
 
-	if err := transcoded.GetByTranscodedKey(s.Db, en.Key); err != nil {
-		log.Println("PostElasticTransoding() Error: ", err)
+	created, err := record.Create(s.Db)
 
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
 		response.SendError(err.Error())
 		return
 	}
 
-	en.TranscodedID = transcoded.ID
+	if !created {
+		response.SendSuccess("message has already been received")
+		return
+	}
+
+	switch message.Type {
+	case sns.TypeSubscriptionConfirmation:
+		err = snsVerifier.ConfirmSubscription(&message)
+	case sns.TypeNotification:
+		var en ElasticTranscoderNotification
 
-	if err := en.Create(s.Db); err != nil {
-		log.Println("PostElasticTransoding() Error: ", err)
+		if en, err = s.handleElasticTranscoderNotification(message); err == nil {
+			response.SendSuccess(en)
+			return
+		}
+	}
+
+	if err != nil {
+		log.Printf("PostElasticTransoding() message_id: %v Error: %v", message.MessageID, err)
+
+		// let SNS send the message again
+		record.Delete(s.Db)
 
+		w.WriteHeader(http.StatusInternalServerError)
 		response.SendError(err.Error())
 		return
 	}
 
-	response.SendSuccess(en)
+	response.SendSuccess(message.Type)
+}
+
+// Move the job named in a notification to its new state and record
+// the notification, the job updates the Transcoded completed flags
+func (s *Server) handleElasticTranscoderNotification(message sns.Message) (en ElasticTranscoderNotification, err error) {
+
+	var er ElasticTranscoderResponse
 
+	if err = json.Unmarshal([]byte(message.Message), &er); err != nil {
+		return
+	}
+
+	if err = en.SetResponse(er); err != nil {
+		return
+	}
+
+	status := transcoder.Status{
+		State:    transcoder.ElasticState(er.State),
+		Duration: int64(en.Duration),
+		Detail:   en.Status,
+	}
+
+	job, err := models.ApplyTranscodeStatus(s.Db, en.JobID, status)
+
+	if err != nil && err != models.ErrorTranscodeJobTransition {
+		return
+	}
+
+	// hls outputs are named after their rendition and have no transcoded row
+	if job.Kind != models.TranscodeJobKindHLS {
+		var transcoded models.Transcoded
+
+		if err = transcoded.GetByTranscodedKey(s.Db, en.Key); err != nil {
+			return
+		}
+
+		en.TranscodedID = transcoded.ID
+	}
+
+	// a late notification for a job that has moved on is still recorded,
+	// it is only recorded once the job is updated so a retry from SNS
+	// does not leave a duplicate row
+	err = en.Create(s.Db)
+
+	return
 }
 
 type ElasticTranscoderNotification struct {
@@ -586,6 +387,7 @@ type ElasticTranscoderNotification struct {
 	Key          string `json:"key"`
 	State        string `json:"state"`
 	Status       string `json:"status"`
+	Duration     int    `json:"duration"`
 	IsActive     bool   `json:"is_active"`
 }
 
@@ -594,17 +396,14 @@ func (e *ElasticTranscoderNotification) SetResponse(r ElasticTranscoderResponse)
 	e.IsActive = true
 	e.PipelineID = r.PipelineID
 
-	var outputs []Output
-
-	outputs = make([]Output, 0)
-
-	if err := json.Unmarshal([]byte(r.Outputs), &outputs); err != nil {
-		return err
+	if len(r.Outputs) == 0 {
+		return e.Errors(models.ErrorMissingValue, "outputs")
 	}
 
-	e.Key = outputs[0].Key
+	e.Key = r.Outputs[0].Key
 	e.State = r.State
-	e.Status = outputs[0].Status
+	e.Status = r.Outputs[0].Status
+	e.Duration = r.Outputs[0].Duration
 
 	return nil
 }
@@ -613,13 +412,13 @@ func (e *ElasticTranscoderNotification) queryCreate() string {
 	return `INSERT INTO elastic_transcoder_notifications 
 						(job_id, transcoded_id, pipeline_id, key, state, status, is_active, created_at, updated_at)
 						VALUES
-						($1, $2, $3, $4, $5, $6, $7, $8, $9)
+						($1, NULLIF($2, 0), $3, $4, $5, $6, $7, $8, $9)
 						RETURNING id`
 }
 
 func (e *ElasticTranscoderNotification) queryUpdate() string {
 	return `UPDATE elastic_transcoder_notifications SET 
-			transcoded_id = $2,
+			transcoded_id = NULLIF($2, 0),
 			pipeline_id = $3,
 			key = $4,
 			state = $5,
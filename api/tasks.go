@@ -1,6 +1,7 @@
 package api
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -41,6 +42,12 @@ type TaskAction struct {
 	get         string
 	top         string
 	add         string
+	history     string
+	publish     string
+	schedule    string
+	restore     string
+	remove      string
+	reorder     string
 }
 
 // register values for each action field
@@ -61,6 +68,12 @@ var taskAction = TaskAction{
 	get:         "get",
 	top:         "top",
 	add:         "add",
+	history:     "history",
+	publish:     "publish",
+	schedule:    "schedule",
+	restore:     "restore",
+	remove:      "remove",
+	reorder:     "reorder",
 }
 
 // Handle what type of models tasks can be performed on
@@ -79,6 +92,7 @@ type TaskModel struct {
 	relationshipFans   string
 	relationshipFollow string
 	payout             string
+	playlist           string
 }
 
 // register values for each model field
@@ -97,6 +111,7 @@ var taskModel = TaskModel{
 	relationshipFans:   "fans",
 	relationshipFollow: "following",
 	payout:             "payout",
+	playlist:           "playlist",
 }
 
 // Will handle all requests from user
@@ -108,6 +123,7 @@ type TaskParams struct {
 	response    *models.BaseResponse
 	currentUser *models.User
 	db          *system.DB
+	ipAddress   string
 }
 
 // HTTP POST - Handle all micro services to update simple models
@@ -138,6 +154,7 @@ func (s *Server) PostPerformTask(w rest.ResponseWriter, r *rest.Request) {
 	}
 
 	params.Init(&response, &currentUser, s.Db)
+	params.ipAddress = s.GetIPAddress(r)
 	params.HandleTasks()
 
 }
@@ -195,6 +212,8 @@ func (tp *TaskParams) HandleTasks() {
 		tp.HandleFollowingTask()
 	case taskModel.payout:
 		tp.HandlePayoutTask()
+	case taskModel.playlist:
+		tp.HandlePlaylistTasks()
 	default:
 		tp.response.SendError(ErrorModelIsNotFound)
 	}
@@ -684,10 +703,19 @@ func (tp *TaskParams) HandleVideoTasks() {
 	case taskAction.downvote:
 		tp.performVideoDownvote()
 	case taskAction.update:
+		tp.performVideoUpdate()
 	case taskAction.delete:
 		tp.performVideoDelete()
 	case taskAction.get:
 		tp.performVideoGet()
+	case taskAction.history:
+		tp.performVideoEditHistory()
+	case taskAction.publish:
+		tp.performVideoPublish()
+	case taskAction.schedule:
+		tp.performVideoSchedule()
+	case taskAction.restore:
+		tp.performVideoRestore()
 	default:
 		tp.response.SendError(ErrorActionIsNotSupported)
 	}
@@ -705,6 +733,11 @@ func (tp *TaskParams) performVideoGet() {
 		return
 	}
 
+	if video.UserID != tp.currentUser.ID && (!video.IsPublished() || models.IsShadowbanned(tp.db, video.UserID)) {
+		tp.response.SendError(sql.ErrNoRows.Error())
+		return
+	}
+
 	if video.IsUpvoted, err = vote.HasUpVoted(tp.db, tp.currentUser.ID, video.ID); err != nil {
 		return
 	}
@@ -722,7 +755,75 @@ func (tp *TaskParams) performVideoGet() {
 	tp.response.SendSuccess(video)
 }
 
-func (tp *TaskParams) performVideoDelete() {
+// Edit the title, categories or thumbnail of a video
+// extra - {"title": "...", "categories": "#singing#music", "thumbnail": "..."}
+func (tp *TaskParams) performVideoUpdate() {
+	if tp.Extra == "" {
+		tp.response.SendError(ErrorMissingExtra)
+		return
+	}
+
+	var edit models.VideoEdit
+
+	if err := json.Unmarshal([]byte(tp.Extra), &edit); err != nil {
+		tp.response.SendError(err.Error())
+		return
+	}
+
+	video := models.Video{}
+
+	if err := video.GetVideoByID(tp.db, tp.ID); err != nil {
+		tp.response.SendError(err.Error())
+		return
+	}
+
+	if tp.currentUser.ID != video.UserID || (!video.IsActive && video.IsPublished()) {
+		tp.response.SendError(ErrorUnauthorizedAction)
+		return
+	}
+
+	edit.UserID = tp.currentUser.ID
+
+	if err := video.Edit(tp.db, &edit); err != nil {
+		tp.response.SendError(err.Error())
+		return
+	}
+
+	tp.performVideoGet()
+}
+
+// Retrieve the edit history of a video
+// extra - page
+func (tp *TaskParams) performVideoEditHistory() {
+	page := util.ConvertPageParamsToInt(tp.Extra)
+
+	var video models.Video
+
+	if err := video.GetVideoByID(tp.db, tp.ID); err != nil {
+		tp.response.SendError(err.Error())
+		return
+	}
+
+	// only the owner sees the history of a video no one else can see
+	if video.UserID != tp.currentUser.ID && (!video.IsPublished() || !video.IsActive || models.IsShadowbanned(tp.db, video.UserID)) {
+		tp.response.SendError(sql.ErrNoRows.Error())
+		return
+	}
+
+	var edit models.VideoEdit
+
+	edits, err := edit.GetForVideo(tp.db, tp.ID, page)
+
+	if err != nil {
+		tp.response.SendError(err.Error())
+		return
+	}
+
+	tp.response.SendSuccess(edits)
+}
+
+// Publish a draft or scheduled video straight away
+func (tp *TaskParams) performVideoPublish() {
 	video := models.Video{}
 
 	if err := video.GetVideoByID(tp.db, tp.ID); err != nil {
@@ -735,38 +836,109 @@ func (tp *TaskParams) performVideoDelete() {
 		return
 	}
 
-	if err := video.SoftDelete(tp.db); err != nil {
+	if err := models.CheckSanction(tp.db, tp.currentUser.ID, models.SanctionUploadSuspension); err != nil {
 		tp.response.SendError(err.Error())
 		return
 	}
 
-	competition := models.Competitor{}
-	event := models.Event{}
+	if err := video.Publish(tp.db); err != nil {
+		tp.response.SendError(err.Error())
+		return
+	}
 
-	if err := competition.GetByVideoID(tp.db, video.ID); err != nil {
-		log.Println(err)
+	tp.performVideoGet()
+}
 
+// Schedule a draft to be published or move it back to drafts
+// extra - {"status": "scheduled", "publish_at": "2018-01-01T09:00:00-08:00"}
+func (tp *TaskParams) performVideoSchedule() {
+	if tp.Extra == "" {
+		tp.response.SendError(ErrorMissingExtra)
+		return
+	}
+
+	var schedule models.Video
+
+	if err := json.Unmarshal([]byte(tp.Extra), &schedule); err != nil {
+		tp.response.SendError(err.Error())
+		return
 	}
 
-	if err := event.Get(tp.db, competition.EventID); err != nil {
-		log.Println(err)
+	video := models.Video{}
+
+	if err := video.GetVideoByID(tp.db, tp.ID); err != nil {
+		tp.response.SendError(err.Error())
+		return
+	}
+
+	if tp.currentUser.ID != video.UserID {
+		tp.response.SendError(ErrorUnauthorizedAction)
+		return
+	}
+
+	if err := video.Schedule(tp.db, schedule.Status, schedule.PublishAt); err != nil {
+		tp.response.SendError(err.Error())
+		return
+	}
+
+	tp.performVideoGet()
+}
+
+func (tp *TaskParams) performVideoDelete() {
+	video := models.Video{}
+
+	if err := video.GetVideoByID(tp.db, tp.ID); err != nil {
+		tp.response.SendError(err.Error())
+		return
+	}
 
+	if tp.currentUser.ID != video.UserID {
+		tp.response.SendError(ErrorUnauthorizedAction)
+		return
 	}
 
-	event.CompetitorsCount--
+	// drafts never entered a competition
+	if !video.IsPublished() {
+		if err := video.DeleteDraft(tp.db); err != nil {
+			tp.response.SendError(err.Error())
+			return
+		}
 
-	if err := event.Update(tp.db); err != nil {
-		log.Println(err)
+		tp.response.SendSuccess("video deleted")
+		return
+	}
 
+	// the video leaves its competitions and can be restored from the trash
+	if err := video.Trash(tp.db); err != nil {
+		tp.response.SendError(err.Error())
+		return
 	}
 
 	tp.response.SendSuccess("video deleted")
 }
 
+// Take a video out of the trash
+func (tp *TaskParams) performVideoRestore() {
+	video := models.Video{}
+	video.ID = tp.ID
+
+	if err := video.Restore(tp.db, tp.currentUser.ID); err != nil {
+		tp.response.SendError(err.Error())
+		return
+	}
+
+	tp.performVideoGet()
+}
+
 // Add an upvote for a user to a video
 func (tp *TaskParams) performVideoUpvote() {
 	vote := models.Vote{}
 
+	if err := models.CheckSanction(tp.db, tp.currentUser.ID, models.SanctionVotingSuspension); err != nil {
+		tp.response.SendError(err.Error())
+		return
+	}
+
 	if exists, err := vote.Exists(tp.db, tp.currentUser.ID, tp.ID); exists || err != nil {
 		if err == nil {
 			err = vote.Errors(models.ErrorExists, "id")
@@ -853,6 +1025,11 @@ func (tp *TaskParams) performVideoUpvote() {
 func (tp *TaskParams) performVideoDownvote() {
 	vote := models.Vote{}
 
+	if err := models.CheckSanction(tp.db, tp.currentUser.ID, models.SanctionVotingSuspension); err != nil {
+		tp.response.SendError(err.Error())
+		return
+	}
+
 	if exists, err := vote.Exists(tp.db, tp.currentUser.ID, tp.ID); exists || err != nil {
 		if err == nil {
 			err = vote.Errors(models.ErrorExists, "id")
@@ -1241,6 +1418,8 @@ func (tp *TaskParams) performCreateView() {
 
 	view.UserID = tp.currentUser.ID
 	view.VideoID = tp.ID
+	view.DeviceID = tp.currentUser.Api.DeviceID
+	view.IPAddress = tp.ipAddress
 
 	if err := view.Create(tp.db); err != nil {
 		tp.response.SendError(err.Error())
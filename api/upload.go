@@ -24,6 +24,9 @@ import (
 //  Thumbnail  string `json:"thumbnail"`
 //  Key        string `json:"key"`
 //  Title      string `json:"title"`
+//  Status     string `json:"status"` - draft or scheduled to publish later
+//  PublishAt  string `json:"publish_at"` - required when scheduled
+//  ReplyToVideoID uint64 `json:"reply_to_video_id"` - optional video this responds to
 //
 func (s *Server) PostVideo(w rest.ResponseWriter, r *rest.Request) {
 	response := models.BaseResponse{}
@@ -43,6 +46,22 @@ func (s *Server) PostVideo(w rest.ResponseWriter, r *rest.Request) {
 	}
 
 	video.UserID = currentUser.ID
+
+	if err := models.CheckSanction(s.Db, currentUser.ID, models.SanctionUploadSuspension); err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	if err := models.CheckUploadKey(s.Db, s.Storage, currentUser.ID, video.Key, models.UploadKindVideo); err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	if err := models.CheckUploadKey(s.Db, s.Storage, currentUser.ID, video.Thumbnail, models.UploadKindThumbnail); err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
 	if err := video.CreateForWeeklyEvents(s.Db); err != nil {
 		response.SendError(err.Error())
 		return
@@ -84,6 +103,22 @@ func (s *Server) PostVideo2(w rest.ResponseWriter, r *rest.Request) {
 	}
 
 	video.UserID = currentUser.ID
+
+	if err := models.CheckSanction(s.Db, currentUser.ID, models.SanctionUploadSuspension); err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	if err := models.CheckUploadKey(s.Db, s.Storage, currentUser.ID, video.Key, models.UploadKindVideo); err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	if err := models.CheckUploadKey(s.Db, s.Storage, currentUser.ID, video.Thumbnail, models.UploadKindThumbnail); err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
 	if err := video.Create(s.Db); err != nil {
 		response.SendError(err.Error())
 		return
@@ -228,3 +263,213 @@ var Client = &http.Client{
 		TLSHandshakeTimeout: 5 * time.Second,
 	},
 }
+
+// HTTP GET - retrieve the current users drafts and scheduled videos
+// params - page
+func (s *Server) GetDrafts(w rest.ResponseWriter, r *rest.Request) {
+	response := models.BaseResponse{}
+	response.Init(w)
+
+	currentUser, err := s.LoginProcess(response, r)
+
+	if err != nil {
+		return
+	}
+
+	page := s.GetPageFromParams(r)
+
+	video := models.Video{}
+	videos, err := video.GetDrafts(s.Db, currentUser.ID, page)
+
+	if err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	response.SendSuccess(videos)
+}
+
+// HTTP GET - retrieve the videos the current user deleted and can still restore
+// params - page
+func (s *Server) GetTrash(w rest.ResponseWriter, r *rest.Request) {
+	response := models.BaseResponse{}
+	response.Init(w)
+
+	currentUser, err := s.LoginProcess(response, r)
+
+	if err != nil {
+		return
+	}
+
+	page := s.GetPageFromParams(r)
+
+	video := models.Video{}
+	videos, err := video.GetTrash(s.Db, currentUser.ID, page)
+
+	if err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	response.SendSuccess(videos)
+}
+
+// HTTP GET - retrieve the responses to a video, most voted first
+// params - video_id, page
+func (s *Server) GetVideoResponses(w rest.ResponseWriter, r *rest.Request) {
+	response := models.BaseResponse{}
+	response.Init(w)
+
+	currentUser, err := s.LoginProcess(response, r)
+
+	if err != nil {
+		return
+	}
+
+	page := s.GetPageFromParams(r)
+	videoID, err := s.GetVideoIDFromParams(r)
+
+	if err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	video := models.Video{}
+	videos, err := video.GetResponses(s.Db, videoID, currentUser.ID, page)
+
+	if err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	response.SendSuccess(videos)
+}
+
+// HTTP POST - presign a url to upload a video or thumbnail to storage
+//
+//  Kind        string `json:"kind"` - video or thumbnail
+//  ContentType string `json:"content_type"`
+//
+func (s *Server) PostUploadURL(w rest.ResponseWriter, r *rest.Request) {
+	response := models.BaseResponse{}
+	response.Init(w)
+
+	currentUser, err := s.LoginProcess(response, r)
+
+	if err != nil {
+		return
+	}
+
+	upload := models.UploadURL{}
+
+	if err := r.DecodeJsonPayload(&upload); err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	if err := models.CheckSanction(s.Db, currentUser.ID, models.SanctionUploadSuspension); err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	if err := upload.Create(s.Storage, currentUser.ID); err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	response.SendSuccess(upload)
+}
+
+// HTTP POST - open an upload session for a video and presign its upload urls
+//
+//  VideoContentType     string  `json:"video_content_type"`
+//  VideoSize            int64   `json:"video_size"` - bytes
+//  ThumbnailContentType string  `json:"thumbnail_content_type"` - optional
+//  ThumbnailSize        int64   `json:"thumbnail_size"` - optional
+//  Duration             float64 `json:"duration"` - seconds
+//
+func (s *Server) PostUploadSession(w rest.ResponseWriter, r *rest.Request) {
+	response := models.BaseResponse{}
+	response.Init(w)
+
+	currentUser, err := s.LoginProcess(response, r)
+
+	if err != nil {
+		return
+	}
+
+	session := models.UploadSession{}
+
+	if err := r.DecodeJsonPayload(&session); err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	if err := models.CheckSanction(s.Db, currentUser.ID, models.SanctionUploadSuspension); err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	session.UserID = currentUser.ID
+
+	if err := session.Create(s.Db, s.Storage); err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	response.SendSuccess(session)
+}
+
+// Video details sent to finalize an upload session
+type uploadSessionFinalize struct {
+	UploadSessionID uint64       `json:"upload_session_id"`
+	Video           models.Video `json:"video"`
+}
+
+// HTTP POST - create the video for an upload session once its files are uploaded
+//
+//  UploadSessionID uint64       `json:"upload_session_id"`
+//  Video           models.Video `json:"video"` - same fields as PostVideo without key and thumbnail
+//
+func (s *Server) PostUploadSessionFinalize(w rest.ResponseWriter, r *rest.Request) {
+	response := models.BaseResponse{}
+	response.Init(w)
+
+	currentUser, err := s.LoginProcess(response, r)
+
+	if err != nil {
+		return
+	}
+
+	var finalize uploadSessionFinalize
+
+	if err := r.DecodeJsonPayload(&finalize); err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	if err := models.CheckSanction(s.Db, currentUser.ID, models.SanctionUploadSuspension); err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	session := models.UploadSession{}
+	session.ID = finalize.UploadSessionID
+	session.UserID = currentUser.ID
+
+	video := finalize.Video
+
+	if err := session.Finalize(s.Db, s.Storage, &video); err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	if currentUser.AccountType != models.ACCOUNT_TYPE_TALENT {
+		currentUser.AccountType = models.ACCOUNT_TYPE_TALENT
+		if err := currentUser.Update(s.Db); err != nil {
+			log.Println("PostUploadSessionFinalize() Update AccountType ", err)
+		}
+	}
+
+	response.SendSuccess(video)
+}
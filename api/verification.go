@@ -0,0 +1,162 @@
+package api
+
+import (
+	"encoding/json"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/rathvong/talentmob_server/models"
+)
+
+// Verification status returned to a talent
+type VerificationStatus struct {
+	IsVerified    bool                         `json:"verified"`
+	Verifications []models.Verification        `json:"verifications"`
+	History       []models.VerificationHistory `json:"history"`
+}
+
+// HTTP POST - talent submits a verification request with evidence links
+// body - {"evidence_links": ["https://..."], "note": "..."}
+func (s *Server) PostVerification(w rest.ResponseWriter, r *rest.Request) {
+	response := models.BaseResponse{}
+	response.Init(w)
+
+	currentUser, err := s.LoginProcess(response, r)
+
+	if err != nil {
+		return
+	}
+
+	if currentUser.AccountType != models.ACCOUNT_TYPE_TALENT {
+		response.SendError("only talent can request verification")
+		return
+	}
+
+	if currentUser.IsVerified {
+		response.SendError("user is already verified")
+		return
+	}
+
+	var verification models.Verification
+
+	if err := r.DecodeJsonPayload(&verification); err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	verification.UserID = currentUser.ID
+
+	if err := verification.Create(s.Db); err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	response.SendSuccess(verification)
+}
+
+// HTTP GET - retrieve the current users verification requests and history
+// params - page
+func (s *Server) GetVerifications(w rest.ResponseWriter, r *rest.Request) {
+	response := models.BaseResponse{}
+	response.Init(w)
+
+	currentUser, err := s.LoginProcess(response, r)
+
+	if err != nil {
+		return
+	}
+
+	page := s.GetPageFromParams(r)
+
+	var verification models.Verification
+	var status VerificationStatus
+
+	status.IsVerified = currentUser.IsVerified
+
+	if status.Verifications, err = verification.GetForUser(s.Db, currentUser.ID, page); err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	if status.History, err = verification.GetHistory(s.Db, currentUser.ID); err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	response.SendSuccess(status)
+}
+
+// Moderator review of a verification request
+// extra - {"verification_id": 1, "note": "..."}
+type VerificationReview struct {
+	VerificationID uint64 `json:"verification_id"`
+	Note           string `json:"note"`
+}
+
+// Moderation queue of verification requests
+// extra - {"status": "pending", "page": 1}
+type VerificationQueue struct {
+	Status string `json:"status"`
+	Page   int    `json:"page"`
+}
+
+func (st *SystemTaskParams) listVerifications() {
+	var queue VerificationQueue
+
+	if st.Extra != "" {
+		if err := json.Unmarshal([]byte(st.Extra), &queue); err != nil {
+			st.response.SendError(err.Error())
+			return
+		}
+	}
+
+	var verification models.Verification
+
+	verifications, err := verification.GetByStatus(st.db, queue.Status, queue.Page)
+
+	if err != nil {
+		st.response.SendError(err.Error())
+		return
+	}
+
+	st.response.SendSuccess(verifications)
+}
+
+func (st *SystemTaskParams) reviewVerification(status string) {
+
+	if st.Extra == "" {
+		st.response.SendError("missing extra={verification_id, note}")
+		return
+	}
+
+	var review VerificationReview
+
+	if err := json.Unmarshal([]byte(st.Extra), &review); err != nil {
+		st.response.SendError(err.Error())
+		return
+	}
+
+	var verification models.Verification
+
+	if err := verification.Get(st.db, review.VerificationID); err != nil {
+		st.response.SendError(err.Error())
+		return
+	}
+
+	var err error
+
+	switch status {
+	case models.VerificationStatusApproved:
+		err = verification.Approve(st.db, review.Note)
+	case models.VerificationStatusRejected:
+		err = verification.Reject(st.db, review.Note)
+	case models.VerificationStatusRevoked:
+		err = verification.Revoke(st.db, review.Note)
+	}
+
+	if err != nil {
+		st.response.SendError(err.Error())
+		return
+	}
+
+	st.response.SendSuccess(verification)
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"log"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/rathvong/talentmob_server/models"
+)
+
+// HTTP POST - report time spent watching a video. Without an id a new
+// session is started, heartbeats and the final report send the session id
+// with the total seconds watched so far. The view of the video is
+// qualified once it has been watched long enough.
+// body - {"id": 0, "video_id": 1, "watched_seconds": 12.5, "completion": 40, "is_finished": false}
+func (s *Server) PostWatchSession(w rest.ResponseWriter, r *rest.Request) {
+	response := models.BaseResponse{}
+	response.Init(w)
+
+	currentUser, err := s.LoginProcess(response, r)
+
+	if err != nil {
+		return
+	}
+
+	var session models.WatchSession
+
+	if err := r.DecodeJsonPayload(&session); err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	session.UserID = currentUser.ID
+
+	if session.ID == 0 {
+		err = session.Create(s.Db)
+	} else {
+		err = session.Report(s.Db)
+	}
+
+	if err != nil {
+		response.SendError(err.Error())
+		return
+	}
+
+	view := models.View{}
+	view.UserID = currentUser.ID
+	view.VideoID = session.VideoID
+	view.DeviceID = currentUser.Api.DeviceID
+	view.IPAddress = s.GetIPAddress(r)
+
+	if err := view.Qualify(s.Db, session.WatchedSeconds); err != nil {
+		log.Println("PostWatchSession() View.Qualify() Error -> ", err)
+	}
+
+	response.SendSuccess(session)
+}
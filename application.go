@@ -13,6 +13,9 @@ const (
 	HEROKU_ENVIRONMENT_DATABASE_URL = "DATABASE_URL"
 )
 
+// Process type that runs the worker instead of the api
+const ProcessWorker = "worker"
+
 // Initialized database url set in environment
 var (
 	//AWS DB URL
@@ -28,6 +31,12 @@ func main() {
 
 	server := api.Server{Db: db}
 
+	// talentmob_server worker only runs the transcode queue
+	if len(os.Args) > 1 && os.Args[1] == ProcessWorker {
+		server.Work()
+		return
+	}
+
 	server.Serve()
 
 }
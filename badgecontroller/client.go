@@ -288,7 +288,7 @@ func (b *BadgeHandler) handleVideoBadges() (*Achievement, error) {
 
 			var count uint64
 
-			qry := fmt.Sprintf("SELECT COUNT(*) FROM views WHERE video_id = %d", b.objectID)
+			qry := fmt.Sprintf("SELECT COUNT(*) FROM views WHERE video_id = %d AND status = 'qualified'", b.objectID)
 			err := b.db.QueryRow(qry).Scan(&count)
 
 			if err != nil {
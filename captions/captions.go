@@ -0,0 +1,241 @@
+package captions
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats captions can be uploaded in, they are always stored as WebVTT
+const (
+	FormatVTT = "vtt"
+	FormatSRT = "srt"
+)
+
+// Content type of the normalized captions
+const ContentType = "text/vtt"
+
+var (
+	ErrorEmpty            = errors.New("captions have no cues")
+	ErrorInvalidTimestamp = errors.New("caption timestamp is not valid")
+	ErrorInvalidCue       = errors.New("caption cue is not valid")
+	ErrorCueOrder         = errors.New("caption cues are not in order")
+)
+
+// 00:01.000, 01:02:03.456 or 01:02:03,456 for SRT
+var timestamp = regexp.MustCompile(`^(?:(\d{1,3}):)?(\d{2}):(\d{2})[.,](\d{3})$`)
+
+// Markup kept in the normalized captions, anything else is stripped
+var tag = regexp.MustCompile(`</?([a-zA-Z]*)[^>]*>`)
+
+var keptTags = map[string]bool{"b": true, "i": true, "u": true}
+
+// A caption shown between Start and End
+type Cue struct {
+	Start    time.Duration
+	End      time.Duration
+	Settings string
+	Text     string
+}
+
+// Captions of one language for a video
+type Track struct {
+	Format string
+	Cues   []Cue
+}
+
+// Parse WebVTT or SRT captions. SRT is detected by the missing
+// WEBVTT header, both are checked the same way.
+func Parse(data []byte) (track Track, err error) {
+	text := string(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	text = strings.Replace(text, "\r", "\n", -1)
+
+	blocks := strings.Split(strings.TrimSpace(text), "\n\n")
+
+	track.Format = FormatSRT
+
+	if strings.HasPrefix(blocks[0], "WEBVTT") {
+		track.Format = FormatVTT
+		blocks = blocks[1:]
+	}
+
+	for _, block := range blocks {
+		block = strings.Trim(block, "\n")
+
+		if block == "" || isVTTMetadata(track.Format, block) {
+			continue
+		}
+
+		cue, err := parseCue(block)
+
+		if err != nil {
+			return track, err
+		}
+
+		// SRT positions are not WebVTT cue settings
+		if track.Format == FormatSRT {
+			cue.Settings = ""
+		}
+
+		if n := len(track.Cues); n > 0 && cue.Start < track.Cues[n-1].Start {
+			return track, ErrorCueOrder
+		}
+
+		track.Cues = append(track.Cues, cue)
+	}
+
+	if len(track.Cues) == 0 {
+		return track, ErrorEmpty
+	}
+
+	return
+}
+
+// Comment, style and region blocks carry no cues
+func isVTTMetadata(format string, block string) bool {
+	if format != FormatVTT {
+		return false
+	}
+
+	for _, prefix := range []string{"NOTE", "STYLE", "REGION"} {
+		if block == prefix || strings.HasPrefix(block, prefix+" ") || strings.HasPrefix(block, prefix+"\n") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// A cue is an optional identifier, the timings and one or more lines of text
+func parseCue(block string) (cue Cue, err error) {
+	lines := strings.Split(block, "\n")
+
+	if !strings.Contains(lines[0], "-->") {
+		lines = lines[1:]
+	}
+
+	if len(lines) < 2 {
+		return cue, ErrorInvalidCue
+	}
+
+	timing := strings.SplitN(lines[0], "-->", 2)
+
+	if len(timing) != 2 {
+		return cue, ErrorInvalidCue
+	}
+
+	if cue.Start, err = parseTimestamp(strings.TrimSpace(timing[0])); err != nil {
+		return
+	}
+
+	end := strings.Fields(timing[1])
+
+	if len(end) == 0 {
+		return cue, ErrorInvalidTimestamp
+	}
+
+	if cue.End, err = parseTimestamp(end[0]); err != nil {
+		return
+	}
+
+	if cue.End <= cue.Start {
+		return cue, ErrorInvalidTimestamp
+	}
+
+	cue.Settings = strings.Join(end[1:], " ")
+
+	var text []string
+
+	for _, line := range lines[1:] {
+		if strings.Contains(line, "-->") {
+			return cue, ErrorInvalidCue
+		}
+
+		text = append(text, strings.TrimSpace(stripTags(line, keptTags)))
+	}
+
+	cue.Text = strings.TrimSpace(strings.Join(text, "\n"))
+
+	if cue.Text == "" {
+		return cue, ErrorInvalidCue
+	}
+
+	return
+}
+
+func parseTimestamp(value string) (d time.Duration, err error) {
+	match := timestamp.FindStringSubmatch(value)
+
+	if match == nil {
+		return 0, ErrorInvalidTimestamp
+	}
+
+	hours, _ := strconv.Atoi(match[1])
+	minutes, _ := strconv.Atoi(match[2])
+	seconds, _ := strconv.Atoi(match[3])
+	millis, _ := strconv.Atoi(match[4])
+
+	if minutes > 59 || seconds > 59 {
+		return 0, ErrorInvalidTimestamp
+	}
+
+	d = time.Duration(hours)*time.Hour +
+		time.Duration(minutes)*time.Minute +
+		time.Duration(seconds)*time.Second +
+		time.Duration(millis)*time.Millisecond
+
+	return
+}
+
+func formatTimestamp(d time.Duration) string {
+	millis := d / time.Millisecond
+
+	return fmt.Sprintf("%02d:%02d:%02d.%03d",
+		millis/3600000, millis/60000%60, millis/1000%60, millis%1000)
+}
+
+// Remove the tags not in keep, a nil keep removes every tag
+func stripTags(text string, keep map[string]bool) string {
+	return tag.ReplaceAllStringFunc(text, func(t string) string {
+		if keep[strings.ToLower(tag.FindStringSubmatch(t)[1])] {
+			return strings.ToLower(t)
+		}
+
+		return ""
+	})
+}
+
+// The track written as WebVTT
+func (t Track) VTT() []byte {
+	var b bytes.Buffer
+
+	b.WriteString("WEBVTT\n")
+
+	for _, cue := range t.Cues {
+		fmt.Fprintf(&b, "\n%s --> %s", formatTimestamp(cue.Start), formatTimestamp(cue.End))
+
+		if cue.Settings != "" {
+			b.WriteString(" " + cue.Settings)
+		}
+
+		b.WriteString("\n" + cue.Text + "\n")
+	}
+
+	return b.Bytes()
+}
+
+// Plain text of every cue for the search index
+func (t Track) Text() string {
+	text := make([]string, 0, len(t.Cues))
+
+	for _, cue := range t.Cues {
+		text = append(text, strings.Replace(stripTags(cue.Text, nil), "\n", " ", -1))
+	}
+
+	return strings.Join(text, " ")
+}
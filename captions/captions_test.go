@@ -0,0 +1,77 @@
+package captions
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse_SRT(t *testing.T) {
+	srt := "\xef\xbb\xbf1\r\n00:00:01,000 --> 00:00:02,500\r\n<i>Hello</i>\r\n<font color=\"red\">world</font>\r\n\r\n2\r\n00:00:03,000 --> 00:00:04,000 X1:10 X2:20\r\nSecond line\r\n"
+
+	track, err := Parse([]byte(srt))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if track.Format != FormatSRT || len(track.Cues) != 2 {
+		t.Fatalf("unexpected track %+v", track)
+	}
+
+	if cue := track.Cues[0]; cue.Start != time.Second || cue.End != 2500*time.Millisecond || cue.Text != "<i>Hello</i>\nworld" {
+		t.Errorf("unexpected cue %+v", cue)
+	}
+
+	expected := "WEBVTT\n\n00:00:01.000 --> 00:00:02.500\n<i>Hello</i>\nworld\n\n00:00:03.000 --> 00:00:04.000\nSecond line\n"
+
+	if vtt := string(track.VTT()); vtt != expected {
+		t.Errorf("unexpected vtt %q", vtt)
+	}
+
+	if text := track.Text(); text != "Hello world Second line" {
+		t.Errorf("unexpected text %q", text)
+	}
+}
+
+func TestParse_VTT(t *testing.T) {
+	vtt := "WEBVTT - lyrics\n\nNOTE written by hand\n\nSTYLE\n::cue { color: white }\n\nintro\n01:02.000 --> 01:03.000 align:start\n<v Singer>La la la\n"
+
+	track, err := Parse([]byte(vtt))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if track.Format != FormatVTT || len(track.Cues) != 1 {
+		t.Fatalf("unexpected track %+v", track)
+	}
+
+	cue := track.Cues[0]
+
+	if cue.Start != 62*time.Second || cue.Settings != "align:start" || cue.Text != "La la la" {
+		t.Errorf("unexpected cue %+v", cue)
+	}
+
+	if !strings.Contains(string(track.VTT()), "00:01:02.000 --> 00:01:03.000 align:start\n") {
+		t.Errorf("unexpected vtt %q", track.VTT())
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := map[string]error{
+		"":                              ErrorEmpty,
+		"WEBVTT\n\nNOTE nothing here\n": ErrorEmpty,
+		"1\n00:00:01,000 --> 00:00:01,000\nHello\n":                            ErrorInvalidTimestamp,
+		"1\n00:00:01 --> 00:00:02\nHello\n":                                    ErrorInvalidTimestamp,
+		"1\n00:00:01,000 --> 00:00:02,000\n":                                   ErrorInvalidCue,
+		"just some text\nwithout timings\n":                                    ErrorInvalidCue,
+		"WEBVTT\n\n00:05.000 --> 00:06.000\nb\n\n00:01.000 --> 00:02.000\na\n": ErrorCueOrder,
+	}
+
+	for input, expected := range tests {
+		if _, err := Parse([]byte(input)); err != expected {
+			t.Errorf("Parse(%q) error %v expected %v", input, err, expected)
+		}
+	}
+}
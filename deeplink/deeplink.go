@@ -0,0 +1,178 @@
+package deeplink
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Object types links can be built for, these match
+// the object types used by notifications
+const (
+	ObjectUser         = "user"
+	ObjectVideo        = "video"
+	ObjectComment      = "comment"
+	ObjectEvent        = "event"
+	ObjectEventRanking = "event_ranking"
+	ObjectCompetition  = "competition"
+	ObjectReport       = "report"
+	ObjectSanction     = "sanction"
+)
+
+const (
+	DefaultScheme             = "talentmob"
+	DefaultHost               = "www.talentmob.com"
+	DefaultAppleAppID         = "TALENTMOB.com.talentmob.talentmob"
+	DefaultAndroidPackageName = "com.talentmob.talentmob"
+)
+
+var (
+	// Custom url scheme registered by the apps, set with DEEP_LINK_SCHEME
+	Scheme = envOrDefault("DEEP_LINK_SCHEME", DefaultScheme)
+
+	// Domain serving universal and app links, set with DEEP_LINK_HOST
+	Host = envOrDefault("DEEP_LINK_HOST", DefaultHost)
+
+	// Team and bundle id of the ios app, set with APPLE_APP_ID
+	AppleAppID = envOrDefault("APPLE_APP_ID", DefaultAppleAppID)
+
+	// Package of the android app, set with ANDROID_PACKAGE_NAME
+	AndroidPackageName = envOrDefault("ANDROID_PACKAGE_NAME", DefaultAndroidPackageName)
+
+	// Comma separated SHA256 fingerprints of the android signing
+	// certificates, set with ANDROID_CERT_FINGERPRINTS
+	AndroidCertFingerprints = splitList(os.Getenv("ANDROID_CERT_FINGERPRINTS"))
+
+	ErrorUnknownObject = errors.New("no deep link for object type")
+	ErrorMissingID     = errors.New("deep link is missing an object id")
+)
+
+// Path of each object in the apps. The leaderboard links
+// take participants to the leaderboard they placed on.
+var objectPaths = map[string]string{
+	ObjectUser:         "/u/%d",
+	ObjectVideo:        "/video/%d",
+	ObjectComment:      "/comment/%d",
+	ObjectEvent:        "/event/%d",
+	ObjectEventRanking: "/leaderboard/rankings/%d",
+	ObjectCompetition:  "/leaderboard/competitors/%d",
+	ObjectReport:       "/report/%d",
+	ObjectSanction:     "/sanction/%d",
+}
+
+// Canonical links to an object. The app link opens the app directly
+// while the universal link falls back to the website when the app
+// is not installed.
+type Link struct {
+	AppLink       string `json:"app_link"`
+	UniversalLink string `json:"universal_link"`
+}
+
+func envOrDefault(key string, value string) string {
+	if env := os.Getenv(key); env != "" {
+		return env
+	}
+
+	return value
+}
+
+func splitList(value string) (list []string) {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return
+}
+
+// Build the links for an object
+func Build(objectType string, id uint64) (link Link, err error) {
+
+	path, ok := objectPaths[objectType]
+
+	if !ok {
+		return link, ErrorUnknownObject
+	}
+
+	if id == 0 {
+		return link, ErrorMissingID
+	}
+
+	path = fmt.Sprintf(path, id)
+
+	link.AppLink = Scheme + ":/" + path
+	link.UniversalLink = "https://" + Host + path
+
+	return
+}
+
+// Paths the apps open from universal links
+func paths() (list []string) {
+	for _, path := range objectPaths {
+		list = append(list, strings.Replace(path, "%d", "*", 1))
+	}
+
+	sort.Strings(list)
+
+	return
+}
+
+// apple-app-site-association format
+type AppleAppSiteAssociation struct {
+	AppLinks AppleAppLinks `json:"applinks"`
+}
+
+type AppleAppLinks struct {
+	Apps    []string            `json:"apps"`
+	Details []AppleAppLinkPaths `json:"details"`
+}
+
+type AppleAppLinkPaths struct {
+	AppID string   `json:"appID"`
+	Paths []string `json:"paths"`
+}
+
+// Build the apple-app-site-association file for universal links
+func AppleAssociation() (association AppleAppSiteAssociation) {
+	association.AppLinks.Apps = []string{}
+	association.AppLinks.Details = []AppleAppLinkPaths{
+		{AppID: AppleAppID, Paths: paths()},
+	}
+
+	return
+}
+
+// assetlinks.json format
+type AssetLink struct {
+	Relation []string        `json:"relation"`
+	Target   AssetLinkTarget `json:"target"`
+}
+
+type AssetLinkTarget struct {
+	Namespace              string   `json:"namespace"`
+	PackageName            string   `json:"package_name"`
+	SHA256CertFingerprints []string `json:"sha256_cert_fingerprints"`
+}
+
+// Build the assetlinks.json file for android app links
+func AssetLinks() (links []AssetLink) {
+	fingerprints := AndroidCertFingerprints
+
+	if fingerprints == nil {
+		fingerprints = []string{}
+	}
+
+	return []AssetLink{
+		{
+			Relation: []string{"delegate_permission/common.handle_all_urls"},
+			Target: AssetLinkTarget{
+				Namespace:              "android_app",
+				PackageName:            AndroidPackageName,
+				SHA256CertFingerprints: fingerprints,
+			},
+		},
+	}
+}
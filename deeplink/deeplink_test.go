@@ -0,0 +1,119 @@
+package deeplink
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Use the default links whatever the environment sets
+func useDefaults(t *testing.T) {
+	scheme, host, appID, packageName := Scheme, Host, AppleAppID, AndroidPackageName
+
+	Scheme, Host, AppleAppID, AndroidPackageName = DefaultScheme, DefaultHost, DefaultAppleAppID, DefaultAndroidPackageName
+
+	t.Cleanup(func() {
+		Scheme, Host, AppleAppID, AndroidPackageName = scheme, host, appID, packageName
+	})
+}
+
+func TestBuild(t *testing.T) {
+	useDefaults(t)
+
+	tests := []struct {
+		objectType string
+		id         uint64
+		appLink    string
+		universal  string
+		err        error
+	}{
+		{ObjectUser, 1, "talentmob://u/1", "https://www.talentmob.com/u/1", nil},
+		{ObjectVideo, 42, "talentmob://video/42", "https://www.talentmob.com/video/42", nil},
+		{ObjectComment, 7, "talentmob://comment/7", "https://www.talentmob.com/comment/7", nil},
+		{ObjectEvent, 3, "talentmob://event/3", "https://www.talentmob.com/event/3", nil},
+		{ObjectEventRanking, 5, "talentmob://leaderboard/rankings/5", "https://www.talentmob.com/leaderboard/rankings/5", nil},
+		{ObjectCompetition, 9, "talentmob://leaderboard/competitors/9", "https://www.talentmob.com/leaderboard/competitors/9", nil},
+		{ObjectReport, 11, "talentmob://report/11", "https://www.talentmob.com/report/11", nil},
+		{ObjectSanction, 12, "talentmob://sanction/12", "https://www.talentmob.com/sanction/12", nil},
+		{"playlist", 1, "", "", ErrorUnknownObject},
+		{ObjectVideo, 0, "", "", ErrorMissingID},
+	}
+
+	for _, test := range tests {
+		link, err := Build(test.objectType, test.id)
+
+		if err != test.err {
+			t.Errorf("Build(%v, %v) expected error %v got %v", test.objectType, test.id, test.err, err)
+			continue
+		}
+
+		if link.AppLink != test.appLink || link.UniversalLink != test.universal {
+			t.Errorf("Build(%v, %v) got %+v", test.objectType, test.id, link)
+		}
+	}
+}
+
+func TestAppleAssociation(t *testing.T) {
+	useDefaults(t)
+
+	association := AppleAssociation()
+
+	if len(association.AppLinks.Apps) != 0 {
+		t.Errorf("expected no apps got %v", association.AppLinks.Apps)
+	}
+
+	if len(association.AppLinks.Details) != 1 || association.AppLinks.Details[0].AppID != DefaultAppleAppID {
+		t.Fatalf("unexpected details %+v", association.AppLinks.Details)
+	}
+
+	expected := []string{
+		"/comment/*",
+		"/event/*",
+		"/leaderboard/competitors/*",
+		"/leaderboard/rankings/*",
+		"/report/*",
+		"/sanction/*",
+		"/u/*",
+		"/video/*",
+	}
+
+	if paths := association.AppLinks.Details[0].Paths; !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected paths %v got %v", expected, paths)
+	}
+}
+
+func TestAssetLinks(t *testing.T) {
+	useDefaults(t)
+
+	links := AssetLinks()
+
+	if len(links) != 1 {
+		t.Fatalf("expected one link got %v", len(links))
+	}
+
+	target := links[0].Target
+
+	if target.Namespace != "android_app" || target.PackageName != DefaultAndroidPackageName {
+		t.Errorf("unexpected target %+v", target)
+	}
+
+	if target.SHA256CertFingerprints == nil {
+		t.Error("fingerprints should be an empty list so the json is not null")
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected []string
+	}{
+		{"", nil},
+		{"AB:CD", []string{"AB:CD"}},
+		{" AB:CD , EF:01 ,", []string{"AB:CD", "EF:01"}},
+	}
+
+	for _, test := range tests {
+		if list := splitList(test.value); !reflect.DeepEqual(list, test.expected) {
+			t.Errorf("splitList(%q) expected %v got %v", test.value, test.expected, list)
+		}
+	}
+}
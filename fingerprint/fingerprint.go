@@ -0,0 +1,100 @@
+package fingerprint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"io"
+
+	// decoders for the thumbnails written by the transcoder and uploaded by clients
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// Size the image is reduced to before hashing. Each row is one
+// pixel wider than the hash so neighbours can be compared.
+const (
+	hashWidth  = 9
+	hashHeight = 8
+)
+
+// SHA-256 of a file, identical files have the same hash
+func FileHash(r io.Reader) (string, error) {
+	h := sha256.New()
+
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Perceptual hash of an encoded JPEG or PNG image
+func DecodeImageHash(r io.Reader) (uint64, error) {
+	img, _, err := image.Decode(r)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return ImageHash(img), nil
+}
+
+// Difference hash of an image. The image is shrunk to 9x8 grey
+// pixels and each bit records if a pixel is brighter than the one
+// to its right, so re-encoded or resized copies hash the same or
+// only a few bits apart.
+func ImageHash(img image.Image) (hash uint64) {
+	pixels := shrink(img)
+
+	for y := 0; y < hashHeight; y++ {
+		for x := 0; x < hashWidth-1; x++ {
+			hash <<= 1
+
+			if pixels[y][x] > pixels[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+
+	return
+}
+
+// Number of bits two hashes differ by
+func Distance(a uint64, b uint64) (distance int) {
+	for x := a ^ b; x != 0; x &= x - 1 {
+		distance++
+	}
+
+	return
+}
+
+// Average brightness of each cell of a hashWidth x hashHeight grid
+func shrink(img image.Image) (pixels [hashHeight][hashWidth]float64) {
+	bounds := img.Bounds()
+
+	var counts [hashHeight][hashWidth]float64
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		cy := (y - bounds.Min.Y) * hashHeight / bounds.Dy()
+
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			cx := (x - bounds.Min.X) * hashWidth / bounds.Dx()
+
+			r, g, b, _ := img.At(x, y).RGBA()
+
+			pixels[cy][cx] += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+			counts[cy][cx]++
+		}
+	}
+
+	for y := range pixels {
+		for x := range pixels[y] {
+			if counts[y][x] > 0 {
+				pixels[y][x] /= counts[y][x]
+			}
+		}
+	}
+
+	return
+}
@@ -0,0 +1,106 @@
+package fingerprint
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// A horizontal gradient with a bright square in the middle
+func testImage(width int, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := uint8(x * 200 / width)
+
+			if x > width/3 && x < width*2/3 && y > height/3 && y < height*2/3 {
+				v = 255
+			}
+
+			img.Set(x, y, color.RGBA{v, v, v, 255})
+		}
+	}
+
+	return img
+}
+
+func TestFileHash(t *testing.T) {
+	a, err := FileHash(strings.NewReader("video"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := FileHash(strings.NewReader("video"))
+	c, _ := FileHash(strings.NewReader("other video"))
+
+	if a != b || a == c || len(a) != 64 {
+		t.Errorf("unexpected hashes %v %v %v", a, b, c)
+	}
+}
+
+func TestImageHash_ResizedAndReencoded(t *testing.T) {
+	original := ImageHash(testImage(640, 360))
+
+	var buf bytes.Buffer
+
+	if err := jpeg.Encode(&buf, testImage(320, 180), &jpeg.Options{Quality: 40}); err != nil {
+		t.Fatal(err)
+	}
+
+	copied, err := DecodeImageHash(&buf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d := Distance(original, copied); d > 4 {
+		t.Errorf("copy is %d bits from the original", d)
+	}
+}
+
+func TestImageHash_DifferentImages(t *testing.T) {
+	flipped := image.NewRGBA(image.Rect(0, 0, 640, 360))
+	src := testImage(640, 360)
+
+	for y := 0; y < 360; y++ {
+		for x := 0; x < 640; x++ {
+			flipped.Set(639-x, y, src.At(x, y))
+		}
+	}
+
+	var buf bytes.Buffer
+
+	if err := png.Encode(&buf, flipped); err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := DecodeImageHash(&buf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d := Distance(ImageHash(src), hash); d < 20 {
+		t.Errorf("different images are only %d bits apart", d)
+	}
+}
+
+func TestDistance(t *testing.T) {
+	if d := Distance(0, 0); d != 0 {
+		t.Errorf("expected 0 got %d", d)
+	}
+
+	if d := Distance(0xff, 0x0f); d != 4 {
+		t.Errorf("expected 4 got %d", d)
+	}
+
+	if d := Distance(0, ^uint64(0)); d != 64 {
+		t.Errorf("expected 64 got %d", d)
+	}
+}
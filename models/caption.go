@@ -0,0 +1,336 @@
+package models
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/rathvong/talentmob_server/captions"
+	"github.com/rathvong/talentmob_server/storage"
+	"github.com/rathvong/talentmob_server/system"
+)
+
+// Largest caption file in bytes
+const CaptionMaxBytes = 512 << 10
+
+// BCP 47 language tags such as en, es or pt-BR
+var captionLanguage = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})?$`)
+
+// Path of the caption route, set by the api from its routes
+var CaptionPath string
+
+// A caption track of a video in one language. Uploads in SRT or
+// WebVTT are stored as WebVTT, Text is kept for the search index.
+type Caption struct {
+	BaseModel
+	VideoID      uint64 `json:"video_id"`
+	Language     string `json:"language"`
+	Label        string `json:"label"`
+	SourceFormat string `json:"source_format"`
+	Key          string `json:"-"`
+	Text         string `json:"-"`
+	URL          string `json:"url"`
+}
+
+func (c *Caption) queryUpsert() (qry string) {
+	return `INSERT INTO captions
+						(video_id,
+						language,
+						label,
+						source_format,
+						key,
+						text,
+						created_at,
+						updated_at)
+				VALUES
+						($1, $2, $3, $4, $5, $6, $7, $8)
+				ON CONFLICT (video_id, language) DO UPDATE SET
+						label = EXCLUDED.label,
+						source_format = EXCLUDED.source_format,
+						key = EXCLUDED.key,
+						text = EXCLUDED.text,
+						updated_at = EXCLUDED.updated_at
+				RETURNING id, created_at`
+}
+
+// Writing videos.meta runs videos_search_trigger which
+// rebuilds it with the caption text
+func (c *Caption) queryReindexVideo() (qry string) {
+	return `UPDATE videos SET meta = NULL WHERE id = $1`
+}
+
+func (c *Caption) queryGetForVideo() (qry string) {
+	return `SELECT	id,
+					video_id,
+					language,
+					label,
+					source_format,
+					key,
+					created_at,
+					updated_at
+			FROM captions
+			WHERE video_id = $1
+			ORDER BY language ASC`
+}
+
+func (c *Caption) queryGetForVideos() (qry string) {
+	return `SELECT	id,
+					video_id,
+					language,
+					label,
+					source_format,
+					key,
+					created_at,
+					updated_at
+			FROM captions
+			WHERE video_id = ANY($1)
+			ORDER BY video_id ASC, language ASC`
+}
+
+func (c *Caption) queryGet() (qry string) {
+	return `SELECT	id,
+					video_id,
+					language,
+					label,
+					source_format,
+					key,
+					created_at,
+					updated_at
+			FROM captions
+			WHERE video_id = $1
+			AND language = $2`
+}
+
+func (c *Caption) validateCreate(data []byte) (err error) {
+
+	if c.VideoID == 0 {
+		return c.Errors(ErrorMissingValue, "video_id")
+	}
+
+	if !captionLanguage.MatchString(c.Language) {
+		return c.Errors(ErrorIncorrectValue, "language")
+	}
+
+	if len(data) == 0 {
+		return c.Errors(ErrorMissingValue, "content")
+	}
+
+	if len(data) > CaptionMaxBytes {
+		return c.Errors(ErrorIncorrectValue, "content")
+	}
+
+	return
+}
+
+// Storage key of the normalized captions
+func captionKey(videoID uint64, language string) string {
+	return fmt.Sprintf("captions/%d/%s.vtt", videoID, language)
+}
+
+// Validate SRT or WebVTT captions, store them as WebVTT and index
+// their text. Uploading a language again replaces its track.
+func (c *Caption) Create(db *system.DB, store storage.Storage, data []byte) (err error) {
+
+	if err = c.validateCreate(data); err != nil {
+		return
+	}
+
+	track, err := captions.Parse(data)
+
+	if err != nil {
+		return
+	}
+
+	if c.Label == "" {
+		c.Label = c.Language
+	}
+
+	c.SourceFormat = track.Format
+	c.Key = captionKey(c.VideoID, c.Language)
+	c.Text = track.Text()
+	c.UpdatedAt = time.Now()
+
+	if err = store.Put(c.Key, bytes.NewReader(track.VTT()), captions.ContentType); err != nil {
+		log.Printf("Caption.Create() key -> %v Put() Error -> %v", c.Key, err)
+		return
+	}
+
+	tx, err := db.Begin()
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			tx.Rollback()
+			return
+		}
+	}()
+
+	if err != nil {
+		log.Println("Caption.Create() Begin() Error -> ", err)
+		return
+	}
+
+	err = tx.QueryRow(c.queryUpsert(),
+		c.VideoID,
+		c.Language,
+		c.Label,
+		c.SourceFormat,
+		c.Key,
+		c.Text,
+		c.UpdatedAt,
+		c.UpdatedAt,
+	).Scan(&c.ID, &c.CreatedAt)
+
+	if err != nil {
+		log.Printf("Caption.Create() video_id -> %v QueryRow() -> %v Error -> %v", c.VideoID, c.queryUpsert(), err)
+		return
+	}
+
+	if _, err = tx.Exec(c.queryReindexVideo(), c.VideoID); err != nil {
+		log.Printf("Caption.Create() video_id -> %v Exec() -> %v Error -> %v", c.VideoID, c.queryReindexVideo(), err)
+		return
+	}
+
+	c.setURL()
+
+	return
+}
+
+// Captions are served by the api so players can load them without a token
+func (c *Caption) setURL() {
+	values := url.Values{}
+	values.Set("video_id", fmt.Sprint(c.VideoID))
+	values.Set("language", c.Language)
+
+	c.URL = APIBaseURL + CaptionPath + values.Encode()
+}
+
+func (c *Caption) parseRows(rows *sql.Rows) (tracks []Caption, err error) {
+
+	defer rows.Close()
+
+	for rows.Next() {
+		caption := Caption{}
+
+		err = rows.Scan(
+			&caption.ID,
+			&caption.VideoID,
+			&caption.Language,
+			&caption.Label,
+			&caption.SourceFormat,
+			&caption.Key,
+			&caption.CreatedAt,
+			&caption.UpdatedAt,
+		)
+
+		if err != nil {
+			log.Println("Caption.parseRows() Error -> ", err)
+			return
+		}
+
+		caption.setURL()
+
+		tracks = append(tracks, caption)
+	}
+
+	return
+}
+
+// Retrieve the caption tracks of a video
+func (c *Caption) GetForVideo(db *system.DB, videoID uint64) (tracks []Caption, err error) {
+
+	rows, err := db.Query(c.queryGetForVideo(), videoID)
+
+	if err != nil {
+		log.Printf("Caption.GetForVideo() video_id -> %v Query() -> %v Error -> %v", videoID, c.queryGetForVideo(), err)
+		return
+	}
+
+	return c.parseRows(rows)
+}
+
+// Retrieve the caption track of a video in a language
+func (c *Caption) Get(db *system.DB, videoID uint64, language string) (err error) {
+
+	err = db.QueryRow(c.queryGet(), videoID, language).Scan(
+		&c.ID,
+		&c.VideoID,
+		&c.Language,
+		&c.Label,
+		&c.SourceFormat,
+		&c.Key,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+	)
+
+	if err != nil {
+		log.Printf("Caption.Get() video_id -> %v language -> %v QueryRow() -> %v Error -> %v", videoID, language, c.queryGet(), err)
+		return
+	}
+
+	c.setURL()
+
+	return
+}
+
+// Set the caption tracks listed with a video
+func (v *Video) SetCaptions(db *system.DB) (err error) {
+	var c Caption
+
+	v.Captions, err = c.GetForVideo(db, v.ID)
+
+	if v.Captions == nil {
+		v.Captions = make([]Caption, 0)
+	}
+
+	return
+}
+
+// Set the caption tracks of a page of videos in one query
+func SetCaptionsForVideos(db *system.DB, videos []Video) (err error) {
+
+	if len(videos) == 0 {
+		return
+	}
+
+	var c Caption
+
+	ids := make([]int64, len(videos))
+
+	for i := range videos {
+		videos[i].Captions = make([]Caption, 0)
+		ids[i] = int64(videos[i].ID)
+	}
+
+	rows, err := db.Query(c.queryGetForVideos(), pq.Array(ids))
+
+	if err != nil {
+		log.Printf("SetCaptionsForVideos() Query() -> %v Error -> %v", c.queryGetForVideos(), err)
+		return
+	}
+
+	tracks, err := c.parseRows(rows)
+
+	if err != nil {
+		return
+	}
+
+	for _, track := range tracks {
+		for i := range videos {
+			if videos[i].ID == track.VideoID {
+				videos[i].Captions = append(videos[i].Captions, track)
+			}
+		}
+	}
+
+	return
+}
@@ -6,7 +6,6 @@ import (
 	"github.com/rathvong/talentmob_server/system"
 	"log"
 	"math/rand"
-	"strings"
 	"time"
 )
 
@@ -233,21 +232,19 @@ func (c *Category) validateUpdateErrors() (err error) {
 // convert tags from video creating and saves it into the database
 func (c *Category) CreateNewCategoriesFromTags(db *system.DB, tags string, video Video) {
 
-	array := strings.Split(tags, "#")
-
-	for _, tag := range array {
-		exists, err := c.ExistsByTag(db, tag)
+	// the same tags the edit path removes with ParseTags
+	for _, title := range ParseTags(tags) {
+		exists, err := c.ExistsByTag(db, title)
 
 		if err != nil {
 			continue
 		}
 
 		var category Category
-		var title = strings.ToLower(tag)
 
 		if exists {
 
-			if err = category.GetByTitle(db, tag); err != nil {
+			if err = category.GetByTitle(db, title); err != nil {
 				continue
 			}
 
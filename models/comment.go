@@ -67,6 +67,7 @@ func (c *Comment) queryGetByVideo() (qry string) {
 			FROM comments
 			WHERE video_id = $1
 			AND is_active = true
+			AND (user_id = $4 OR NOT is_shadowbanned(user_id))
 			ORDER BY created_at DESC
 			LIMIT $2
 			OFFSET $3`
@@ -193,12 +194,12 @@ func (c *Comment) Get(db *system.DB, commentID uint64) (err error) {
 	return
 }
 
-func (c *Comment) GetForVideo(db *system.DB, videoID uint64, page int) (comments []Comment, err error) {
+func (c *Comment) GetForVideo(db *system.DB, videoID uint64, currentUserID uint64, page int) (comments []Comment, err error) {
 	if videoID == 0 {
 		return comments, c.Errors(ErrorMissingValue, "videoID")
 	}
 
-	rows, err := db.Query(c.queryGetByVideo(), videoID, LimitQueryPerRequest, OffSet(page))
+	rows, err := db.Query(c.queryGetByVideo(), videoID, LimitQueryPerRequest, OffSet(page), currentUserID)
 
 	defer rows.Close()
 
@@ -210,7 +211,7 @@ func (c *Comment) GetForVideo(db *system.DB, videoID uint64, page int) (comments
 	return c.parseRows(db, rows)
 }
 
-func (c *Comment) GetForVideo2(db *system.DB, videoID uint64, page int) (comments []Comment, err error) {
+func (c *Comment) GetForVideo2(db *system.DB, videoID uint64, currentUserID uint64, page int) (comments []Comment, err error) {
 	if videoID == 0 {
 		return comments, c.Errors(ErrorMissingValue, "videoID")
 	}
@@ -229,18 +230,21 @@ func (c *Comment) GetForVideo2(db *system.DB, videoID uint64, page int) (comment
 				users.name,
 				users.account_type,
 				users.created_at,
-				users.updated_at
+				users.updated_at,
+				users.verified,
+				users.verified_at
 			FROM comments
 			INNER JOIN users
 			ON users.id = comments.user_id
 			AND users.is_active = true
 			WHERE comments.video_id = $1
 			AND comments.is_active = true
+			AND (comments.user_id = $4 OR NOT is_shadowbanned(comments.user_id))
 			ORDER BY comments.created_at DESC
 			LIMIT $2
 			OFFSET $3`
 
-	rows, err := db.Query(qry, videoID, LimitQueryPerRequest, OffSet(page))
+	rows, err := db.Query(qry, videoID, LimitQueryPerRequest, OffSet(page), currentUserID)
 
 	defer rows.Close()
 
@@ -324,6 +328,8 @@ func (c *Comment) parseRows2(db *system.DB, rows *sql.Rows) (comments []Comment,
 			&comment.Publisher.AccountType,
 			&comment.Publisher.CreatedAt,
 			&comment.Publisher.UpdatedAt,
+			&comment.Publisher.IsVerified,
+			&comment.Publisher.VerifiedAt,
 		)
 
 		if err != nil {
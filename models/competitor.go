@@ -140,6 +140,7 @@ func (c *Competitor) queryGetVideosByCompetitionDate() (qry string) {
 				videos.is_active = true
 			AND	competitors.is_active = true
 			AND competitors.event_id = $1
+			AND (videos.user_id = $2 OR NOT is_shadowbanned(videos.user_id))
 
 			ORDER BY competitors.event_id, competitors.up_votes DESC, competitors.down_votes ASC
 			LIMIT $3
@@ -234,13 +235,46 @@ func (c *Competitor) addToWeeklyEvent(db *system.DB) (err error) {
 	return
 }
 
+// Videos flagged as re-uploads stay out until a moderator approves them
 func (c *Competitor) RegisterForWeeklyEvent(db *system.DB, video Video) (err error) {
+
+	if err = CheckFingerprint(db, video.ID); err != nil {
+		return
+	}
+
 	c.UserID = video.UserID
 	c.VideoID = video.ID
 
 	return c.CreateForWeeklyEvent(db)
 }
 
+// Register a video in this weeks event and, like Video.Create always
+// has, also in the event it was uploaded for
+func (c *Competitor) RegisterForEvents(db *system.DB, video Video) (err error) {
+
+	if err = CheckFingerprint(db, video.ID); err != nil {
+		return
+	}
+
+	err = c.RegisterForWeeklyEvent(db, video)
+
+	if video.EventID == 0 {
+		return
+	}
+
+	// the event entry does not depend on the weekly one
+	if err != nil {
+		log.Println("Competitor.RegisterForEvents() RegisterForWeeklyEvent() Error -> ", err)
+	}
+
+	compete := Competitor{}
+	compete.UserID = video.UserID
+	compete.VideoID = video.ID
+	compete.EventID = video.EventID
+
+	return compete.Create(db)
+}
+
 func (c *Competitor) CreateForWeeklyEvent(db *system.DB) (err error) {
 
 	if err = c.addToWeeklyEvent(db); err != nil {
@@ -488,6 +522,8 @@ func (c *Competitor) GetHistory2(db *system.DB, eventID uint64, userID uint64, l
 	users.account_type,
 	users.created_at,
 	users.updated_at,
+	users.verified,
+	users.verified_at,
 	(SELECT EXISTS(SELECT 1 FROM relationships WHERE followed_id = competitors.user_id AND follower_id = $2 AND is_active = true)),
 	boosts.id,
 	boosts.user_id,
@@ -511,6 +547,7 @@ WHERE
 videos.is_active = true
 AND	competitors.is_active = true
 AND competitors.event_id = $1
+AND (videos.user_id = $2 OR NOT is_shadowbanned(videos.user_id))
 
 ORDER BY competitors.event_id, competitors.up_votes DESC, competitors.down_votes ASC
 LIMIT $3
@@ -566,6 +603,8 @@ func (c *Competitor) parseRows2(db *system.DB, userID uint64, rows *sql.Rows) (v
 			&video.Publisher.AccountType,
 			&video.Publisher.CreatedAt,
 			&video.Publisher.UpdatedAt,
+			&video.Publisher.IsVerified,
+			&video.Publisher.VerifiedAt,
 			&video.Publisher.IsFollowing,
 			&boostID,
 			&boostUserID,
@@ -622,6 +661,8 @@ func (c *Competitor) parseRows2(db *system.DB, userID uint64, rows *sql.Rows) (v
 		videos = append(videos, video)
 	}
 
+	setVideoListDetails(db, videos)
+
 	return
 }
 
@@ -671,6 +712,8 @@ func (c *Competitor) parseRows(db *system.DB, userID uint64, rows *sql.Rows) (vi
 		videos = append(videos, video)
 	}
 
+	setVideoListDetails(db, videos)
+
 	return
 }
 
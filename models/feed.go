@@ -0,0 +1,257 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rathvong/talentmob_server/system"
+)
+
+const (
+	VERB_ACHIEVED = "achieved"
+	OBJECT_BADGE  = "badge"
+)
+
+// Layout used to keep the full precision of a feed
+// entry timestamp inside a cursor
+const feedCursorLayout = "2006-01-02 15:04:05.999999"
+
+var errFeedCursor = errors.New("incorrect value for cursor")
+
+// An entry in a users following feed.
+// Repeated activities by the same user, of the same kind and on
+// the same day are collapsed into a single entry. The object
+// fields describe the most recent activity and Count holds
+// how many activities were collapsed.
+type FeedEntry struct {
+	Actor      ProfileUser `json:"actor"`
+	Verb       string      `json:"verb"`
+	ObjectType string      `json:"object_type"`
+	ObjectID   uint64      `json:"object_id"`
+	Title      string      `json:"title"`
+	Image      string      `json:"image"`
+	Count      int         `json:"count"`
+	CreatedAt  time.Time   `json:"created_at"`
+}
+
+// A page of the following feed, NextCursor is empty
+// when there are no more entries to load
+type Feed struct {
+	Entries    []FeedEntry `json:"entries"`
+	NextCursor string      `json:"next_cursor"`
+}
+
+// SQL query to build the feed on read from the activities of every
+// user the current user follows. Entries are keyed by
+// (created_at, actor_id, verb) so the cursor can resume from the
+// last entry of the previous page.
+func (f *Feed) queryGet() (qry string) {
+	return `WITH following AS (
+				SELECT followed_id
+				FROM relationships
+				WHERE follower_id = $1
+				AND is_active = true
+			), activities AS (
+				SELECT	videos.user_id as actor_id,
+						'imported' as verb,
+						'video' as object_type,
+						videos.id as object_id,
+						videos.title as title,
+						videos.thumbnail as image,
+						videos.created_at
+				FROM videos
+				INNER JOIN following
+				ON following.followed_id = videos.user_id
+				WHERE videos.is_active = true
+
+				UNION ALL
+
+				SELECT	competitors.user_id,
+						'joined',
+						'event',
+						events.id,
+						events.title,
+						'',
+						competitors.created_at
+				FROM competitors
+				INNER JOIN following
+				ON following.followed_id = competitors.user_id
+				INNER JOIN events
+				ON events.id = competitors.event_id
+				AND events.event_type != 'leaderboard'
+				WHERE competitors.is_active = true
+
+				UNION ALL
+
+				SELECT	event_rankings.user_id,
+						'won',
+						'event_ranking',
+						event_rankings.id,
+						event_rankings.video_title,
+						event_rankings.video_thumbnail,
+						event_rankings.created_at
+				FROM event_rankings
+				INNER JOIN following
+				ON following.followed_id = event_rankings.user_id
+				WHERE event_rankings.is_active = true
+				AND event_rankings.pay_out > 0
+
+				UNION ALL
+
+				SELECT	achievements.user_id,
+						'achieved',
+						'badge',
+						badges.id,
+						badges.title,
+						badges.icon,
+						achievements.created_at
+				FROM achievements
+				INNER JOIN following
+				ON following.followed_id = achievements.user_id
+				INNER JOIN badges
+				ON badges.id = achievements.badge_id
+				WHERE achievements.is_active = true
+			), entries AS (
+				SELECT	actor_id,
+						verb,
+						MAX(created_at) as created_at,
+						COUNT(*) as count,
+						(array_agg(object_type ORDER BY created_at DESC))[1] as object_type,
+						(array_agg(object_id ORDER BY created_at DESC))[1] as object_id,
+						(array_agg(title ORDER BY created_at DESC))[1] as title,
+						(array_agg(image ORDER BY created_at DESC))[1] as image
+				FROM activities
+				GROUP BY actor_id, verb, date_trunc('day', created_at)
+			)
+			SELECT	entries.verb,
+					entries.object_type,
+					entries.object_id,
+					entries.title,
+					entries.image,
+					entries.count,
+					entries.created_at,
+					users.id,
+					users.avatar,
+					users.name,
+					users.account_type,
+					users.created_at,
+					users.updated_at,
+					users.verified,
+					users.verified_at
+			FROM entries
+			INNER JOIN users
+			ON users.id = entries.actor_id
+			AND users.is_active = true
+			AND NOT is_shadowbanned(users.id)
+			WHERE $2::timestamp IS NULL
+			OR (entries.created_at, entries.actor_id, entries.verb) < ($2::timestamp, $3::integer, $4::text)
+			ORDER BY entries.created_at DESC, entries.actor_id DESC, entries.verb DESC
+			LIMIT $5`
+}
+
+// Retrieve a page of the following feed for a user.
+// Pass an empty cursor to load the first page.
+func (f *Feed) Get(db *system.DB, userID uint64, cursor string) (err error) {
+
+	if userID == 0 {
+		return errors.New("missing value for user_id")
+	}
+
+	var createdAt sql.NullString
+	var actorID uint64
+	var verb string
+
+	if cursor != "" {
+		var at string
+
+		if at, actorID, verb, err = decodeFeedCursor(cursor); err != nil {
+			return
+		}
+
+		createdAt.String = at
+		createdAt.Valid = true
+	}
+
+	rows, err := db.Query(f.queryGet(), userID, createdAt, actorID, verb, LimitQueryPerRequest)
+
+	if err != nil {
+		log.Printf("Feed.Get() user_id -> %v Query() -> %v Error -> %v", userID, f.queryGet(), err)
+		return
+	}
+
+	defer rows.Close()
+
+	f.Entries = make([]FeedEntry, 0)
+	f.NextCursor = ""
+
+	for rows.Next() {
+		entry := FeedEntry{}
+
+		err = rows.Scan(
+			&entry.Verb,
+			&entry.ObjectType,
+			&entry.ObjectID,
+			&entry.Title,
+			&entry.Image,
+			&entry.Count,
+			&entry.CreatedAt,
+			&entry.Actor.ID,
+			&entry.Actor.Avatar,
+			&entry.Actor.Name,
+			&entry.Actor.AccountType,
+			&entry.Actor.CreatedAt,
+			&entry.Actor.UpdatedAt,
+			&entry.Actor.IsVerified,
+			&entry.Actor.VerifiedAt,
+		)
+
+		if err != nil {
+			log.Println("Feed.Get() Error -> ", err)
+			return
+		}
+
+		f.Entries = append(f.Entries, entry)
+	}
+
+	if len(f.Entries) == LimitQueryPerRequest {
+		last := f.Entries[len(f.Entries)-1]
+		f.NextCursor = encodeFeedCursor(last.CreatedAt, last.Actor.ID, last.Verb)
+	}
+
+	return
+}
+
+func encodeFeedCursor(createdAt time.Time, actorID uint64, verb string) string {
+	raw := fmt.Sprintf("%s|%d|%s", createdAt.Format(feedCursorLayout), actorID, verb)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeFeedCursor(cursor string) (createdAt string, actorID uint64, verb string, err error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+
+	if err != nil {
+		return "", 0, "", errFeedCursor
+	}
+
+	parts := strings.SplitN(string(raw), "|", 3)
+
+	if len(parts) != 3 {
+		return "", 0, "", errFeedCursor
+	}
+
+	if _, err = time.Parse(feedCursorLayout, parts[0]); err != nil {
+		return "", 0, "", errFeedCursor
+	}
+
+	if actorID, err = strconv.ParseUint(parts[1], 10, 64); err != nil {
+		return "", 0, "", errFeedCursor
+	}
+
+	return parts[0], actorID, parts[2], nil
+}
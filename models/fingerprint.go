@@ -0,0 +1,661 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/rathvong/talentmob_server/fingerprint"
+	"github.com/rathvong/talentmob_server/storage"
+	"github.com/rathvong/talentmob_server/system"
+)
+
+// States of a video fingerprint. Pending and flagged videos are kept
+// out of the weekly competition until they are cleared or approved.
+// A checking video has been claimed by the worker.
+const (
+	FingerprintPending  = "pending"
+	FingerprintChecking = "checking"
+	FingerprintClear    = "clear"
+	FingerprintFlagged  = "flagged"
+	FingerprintApproved = "approved"
+	FingerprintRejected = "rejected"
+)
+
+// How a flagged video matched an earlier upload
+const (
+	FingerprintMatchExact = "exact"
+	FingerprintMatchNear  = "near"
+)
+
+const (
+	// Videos that can not be read after this many tries are flagged for review
+	FingerprintMaxAttempts = 3
+
+	// Videos fingerprinted in one run of the worker
+	fingerprintBatchSize = 10
+
+	// A claimed video is left alone by other workers for this long
+	fingerprintClaimFor = 10 * time.Minute
+
+	// Near matches are looked up by the thumbnail_bands of a hash,
+	// which only finds hashes up to this many bits apart
+	fingerprintMaxNearDistance = 7
+)
+
+// Largest number of bits two thumbnail hashes can differ by and still
+// count as the same video, set with FINGERPRINT_NEAR_DISTANCE
+var FingerprintNearDistance = fingerprintDistance(os.Getenv("FINGERPRINT_NEAR_DISTANCE"), 6)
+
+var (
+	ErrorVideoUnderReview      = errors.New("video is waiting for a duplicate review")
+	ErrorFingerprintNotFlagged = errors.New("fingerprint is not flagged for review")
+)
+
+func fingerprintDistance(value string, fallback int) int {
+	if distance, err := strconv.Atoi(value); err == nil && distance >= 0 {
+		if distance > fingerprintMaxNearDistance {
+			return fingerprintMaxNearDistance
+		}
+
+		return distance
+	}
+
+	return fallback
+}
+
+// Content fingerprint of a video. FileHash catches exact re-uploads,
+// ThumbnailHash is a perceptual hash of the first extracted thumbnail
+// that catches re-encoded copies.
+type Fingerprint struct {
+	BaseModel
+	VideoID       uint64     `json:"video_id"`
+	UserID        uint64     `json:"user_id"`
+	Status        string     `json:"status"`
+	FileHash      string     `json:"file_hash"`
+	ThumbnailHash *int64     `json:"thumbnail_hash"`
+	MatchVideoID  uint64     `json:"match_video_id"`
+	MatchUserID   uint64     `json:"match_user_id"`
+	MatchType     string     `json:"match_type"`
+	Distance      int        `json:"distance"`
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"last_error"`
+	ReviewedBy    uint64     `json:"reviewed_by"`
+	ReviewedAt    *time.Time `json:"reviewed_at"`
+	videoKey      string
+	thumbnailKey  string
+}
+
+const fingerprintColumns = `video_fingerprints.id,
+					video_fingerprints.video_id,
+					video_fingerprints.user_id,
+					video_fingerprints.status,
+					video_fingerprints.file_hash,
+					video_fingerprints.thumbnail_hash,
+					COALESCE(video_fingerprints.match_video_id, 0),
+					video_fingerprints.match_user_id,
+					video_fingerprints.match_type,
+					video_fingerprints.distance,
+					video_fingerprints.attempts,
+					video_fingerprints.last_error,
+					video_fingerprints.reviewed_by,
+					video_fingerprints.reviewed_at,
+					video_fingerprints.created_at,
+					video_fingerprints.updated_at`
+
+func (f *Fingerprint) queryCreate() (qry string) {
+	return `INSERT INTO video_fingerprints
+						(video_id,
+						user_id,
+						status,
+						created_at,
+						updated_at)
+				VALUES
+						($1, $2, $3, $4, $4)
+				ON CONFLICT (video_id) DO NOTHING`
+}
+
+// Take the next pending video whose transcode has finished so its
+// thumbnails exist, videos locked or claimed by another worker are
+// skipped until the claim runs out
+func (f *Fingerprint) queryNextPending() (qry string) {
+	return `SELECT ` + fingerprintColumns + `,
+					videos.key,
+					videos.thumbnail
+			FROM video_fingerprints
+			INNER JOIN videos
+			ON videos.id = video_fingerprints.video_id
+			WHERE (video_fingerprints.status = 'pending'
+				OR (video_fingerprints.status = 'checking' AND video_fingerprints.updated_at <= $1))
+			AND NOT EXISTS(SELECT 1 FROM transcode_jobs
+							WHERE transcode_jobs.video_id = video_fingerprints.video_id
+							AND transcode_jobs.kind = 'transcode'
+							AND transcode_jobs.state NOT IN ('completed', 'error'))
+			ORDER BY video_fingerprints.id ASC
+			LIMIT 1
+			FOR UPDATE OF video_fingerprints SKIP LOCKED`
+}
+
+// Earliest upload by another user with the same file
+func (f *Fingerprint) queryExactMatch() (qry string) {
+	return `SELECT	video_id,
+					user_id
+			FROM video_fingerprints
+			WHERE file_hash = $1
+			AND video_id < $2
+			AND user_id <> $3
+			AND status <> 'rejected'
+			ORDER BY video_id ASC
+			LIMIT 1`
+}
+
+// Closest earlier upload by another user with a similar thumbnail,
+// only hashes sharing a band are compared
+func (f *Fingerprint) queryNearMatch() (qry string) {
+	return `SELECT	video_id,
+					user_id,
+					distance
+			FROM (SELECT	video_id,
+							user_id,
+							length(replace((thumbnail_hash # $1)::bit(64)::text, '0', '')) AS distance
+					FROM video_fingerprints
+					WHERE thumbnail_hash IS NOT NULL
+					AND thumbnail_bands(thumbnail_hash) && thumbnail_bands($1)
+					AND video_id < $2
+					AND user_id <> $3
+					AND status <> 'rejected') matches
+			WHERE distance <= $4
+			ORDER BY distance ASC, video_id ASC
+			LIMIT 1`
+}
+
+func (f *Fingerprint) querySave() (qry string) {
+	return `UPDATE video_fingerprints SET
+						status = $2,
+						file_hash = $3,
+						thumbnail_hash = $4,
+						match_video_id = NULLIF($5, 0),
+						match_user_id = $6,
+						match_type = $7,
+						distance = $8,
+						attempts = $9,
+						last_error = $10,
+						updated_at = $11
+				WHERE id = $1`
+}
+
+func (f *Fingerprint) queryReview() (qry string) {
+	return `UPDATE video_fingerprints SET
+						status = $2,
+						reviewed_by = $3,
+						reviewed_at = $4,
+						updated_at = $4
+				WHERE id = $1
+				AND status = 'flagged'`
+}
+
+func (f *Fingerprint) queryGet() (qry string) {
+	return `SELECT ` + fingerprintColumns + `
+			FROM video_fingerprints
+			WHERE id = $1`
+}
+
+func (f *Fingerprint) queryGetForUpdate() (qry string) {
+	return `SELECT ` + fingerprintColumns + `
+			FROM video_fingerprints
+			WHERE id = $1
+			FOR UPDATE`
+}
+
+func (f *Fingerprint) queryEventForVideo() (qry string) {
+	return `SELECT COALESCE(event_id, 0) FROM videos WHERE id = $1`
+}
+
+func (f *Fingerprint) queryStatusForVideo() (qry string) {
+	return `SELECT status FROM video_fingerprints WHERE video_id = $1`
+}
+
+func (f *Fingerprint) queryGetFlagged() (qry string) {
+	return `SELECT ` + fingerprintColumns + `
+			FROM video_fingerprints
+			WHERE status = 'flagged'
+			ORDER BY updated_at ASC
+			LIMIT $1
+			OFFSET $2`
+}
+
+func (f *Fingerprint) scan(row interface {
+	Scan(dest ...interface{}) error
+}, extra ...interface{}) (err error) {
+	dest := []interface{}{
+		&f.ID,
+		&f.VideoID,
+		&f.UserID,
+		&f.Status,
+		&f.FileHash,
+		&f.ThumbnailHash,
+		&f.MatchVideoID,
+		&f.MatchUserID,
+		&f.MatchType,
+		&f.Distance,
+		&f.Attempts,
+		&f.LastError,
+		&f.ReviewedBy,
+		&f.ReviewedAt,
+		&f.CreatedAt,
+		&f.UpdatedAt,
+	}
+
+	return row.Scan(append(dest, extra...)...)
+}
+
+// Queue a published video to be fingerprinted by the worker
+func QueueFingerprint(db *system.DB, video Video) (err error) {
+	var f Fingerprint
+
+	if video.ID == 0 {
+		return f.Errors(ErrorMissingID, "video_id")
+	}
+
+	if _, err = db.Exec(f.queryCreate(), video.ID, video.UserID, FingerprintPending, time.Now()); err != nil {
+		log.Printf("QueueFingerprint() video_id -> %v Exec() -> %v Error -> %v", video.ID, f.queryCreate(), err)
+	}
+
+	return
+}
+
+// Check a video can enter the weekly competition. Videos published
+// before fingerprinting was added have no fingerprint and are allowed.
+func CheckFingerprint(db *system.DB, videoID uint64) (err error) {
+	var f Fingerprint
+
+	err = db.QueryRow(f.queryStatusForVideo(), videoID).Scan(&f.Status)
+
+	if err == sql.ErrNoRows {
+		return nil
+	}
+
+	if err != nil {
+		log.Printf("CheckFingerprint() video_id -> %v QueryRow() -> %v Error -> %v", videoID, f.queryStatusForVideo(), err)
+		return
+	}
+
+	if f.Status != FingerprintClear && f.Status != FingerprintApproved {
+		return ErrorVideoUnderReview
+	}
+
+	return
+}
+
+// Hash the uploaded file and a thumbnail of the video
+func (f *Fingerprint) compute(store storage.Storage) (err error) {
+	body, _, err := store.Get(f.videoKey)
+
+	if err != nil {
+		return
+	}
+
+	f.FileHash, err = fingerprint.FileHash(body)
+	body.Close()
+
+	if err != nil {
+		return
+	}
+
+	f.ThumbnailHash = nil
+
+	for _, key := range f.thumbnailKeys() {
+		body, _, err := store.Get(key)
+
+		if err != nil {
+			continue
+		}
+
+		hash, err := fingerprint.DecodeImageHash(body)
+		body.Close()
+
+		if err != nil {
+			log.Printf("Fingerprint.compute() key -> %v DecodeImageHash() Error -> %v", key, err)
+			continue
+		}
+
+		value := int64(hash)
+		f.ThumbnailHash = &value
+		break
+	}
+
+	return nil
+}
+
+// Thumbnails extracted by the transcode job are preferred over the
+// uploaded thumbnail, which the uploader picks and can alter
+func (f *Fingerprint) thumbnailKeys() (keys []string) {
+	keys = []string{f.videoKey + "-00001.png", f.videoKey + "-00001.jpg"}
+
+	if f.thumbnailKey != "" {
+		keys = append(keys, f.thumbnailKey)
+	}
+
+	return
+}
+
+// Look for an earlier upload by another user with the same content
+func (f *Fingerprint) match(tx *sql.Tx) (err error) {
+	f.MatchVideoID = 0
+	f.MatchUserID = 0
+	f.MatchType = ""
+	f.Distance = 0
+
+	err = tx.QueryRow(f.queryExactMatch(), f.FileHash, f.VideoID, f.UserID).Scan(&f.MatchVideoID, &f.MatchUserID)
+
+	if err == nil {
+		f.MatchType = FingerprintMatchExact
+		return
+	}
+
+	if err != sql.ErrNoRows {
+		log.Printf("Fingerprint.match() video_id -> %v QueryRow() -> %v Error -> %v", f.VideoID, f.queryExactMatch(), err)
+		return
+	}
+
+	err = nil
+
+	if f.ThumbnailHash == nil {
+		return
+	}
+
+	err = tx.QueryRow(f.queryNearMatch(), *f.ThumbnailHash, f.VideoID, f.UserID, FingerprintNearDistance).Scan(&f.MatchVideoID, &f.MatchUserID, &f.Distance)
+
+	if err == nil {
+		f.MatchType = FingerprintMatchNear
+		return
+	}
+
+	if err != sql.ErrNoRows {
+		log.Printf("Fingerprint.match() video_id -> %v QueryRow() -> %v Error -> %v", f.VideoID, f.queryNearMatch(), err)
+		return
+	}
+
+	return nil
+}
+
+func (f *Fingerprint) save(tx *sql.Tx) (err error) {
+	f.UpdatedAt = time.Now()
+
+	_, err = tx.Exec(f.querySave(),
+		f.ID,
+		f.Status,
+		f.FileHash,
+		f.ThumbnailHash,
+		f.MatchVideoID,
+		f.MatchUserID,
+		f.MatchType,
+		f.Distance,
+		f.Attempts,
+		f.LastError,
+		f.UpdatedAt,
+	)
+
+	if err != nil {
+		log.Printf("Fingerprint.save() id -> %v Exec() -> %v Error -> %v", f.ID, f.querySave(), err)
+	}
+
+	return
+}
+
+// Fingerprint the next pending video and flag it if it matches an
+// earlier upload by someone else. The video is claimed and committed
+// before it is downloaded so no lock is held during the download.
+// Returns false when there was nothing to fingerprint.
+func (f *Fingerprint) processNext(db *system.DB, store storage.Storage) (found bool, err error) {
+
+	if found, err = f.claimNext(db); !found || err != nil {
+		return
+	}
+
+	computeErr := f.compute(store)
+
+	if computeErr != nil {
+		log.Printf("Fingerprint.processNext() id -> %v compute() Error -> %v", f.ID, computeErr)
+	}
+
+	err = f.saveCheck(db, computeErr)
+
+	return
+}
+
+// Claim the next pending video and count the attempt
+func (f *Fingerprint) claimNext(db *system.DB) (found bool, err error) {
+
+	tx, err := db.Begin()
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			tx.Rollback()
+			return
+		}
+	}()
+
+	if err != nil {
+		log.Println("Fingerprint.claimNext() Begin() Error -> ", err)
+		return
+	}
+
+	if err = f.scan(tx.QueryRow(f.queryNextPending(), time.Now().Add(-fingerprintClaimFor)), &f.videoKey, &f.thumbnailKey); err != nil {
+		if err == sql.ErrNoRows {
+			err = nil
+			return
+		}
+
+		log.Printf("Fingerprint.claimNext() QueryRow() -> %v Error -> %v", f.queryNextPending(), err)
+		return
+	}
+
+	found = true
+
+	f.Attempts++
+	f.Status = FingerprintChecking
+
+	err = f.save(tx)
+
+	return
+}
+
+// Match and save a claimed video once it has been hashed. Nothing
+// is saved when the claim ran out and another worker took the video.
+func (f *Fingerprint) saveCheck(db *system.DB, computeErr error) (err error) {
+
+	tx, err := db.Begin()
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			tx.Rollback()
+			return
+		}
+
+		f.afterCheck(db)
+	}()
+
+	if err != nil {
+		log.Println("Fingerprint.saveCheck() Begin() Error -> ", err)
+		return
+	}
+
+	var claimed Fingerprint
+
+	if err = claimed.scan(tx.QueryRow(f.queryGetForUpdate(), f.ID)); err != nil {
+		log.Printf("Fingerprint.saveCheck() id -> %v QueryRow() -> %v Error -> %v", f.ID, f.queryGetForUpdate(), err)
+		return
+	}
+
+	if claimed.Status != FingerprintChecking || claimed.Attempts != f.Attempts {
+		log.Printf("Fingerprint.saveCheck() id -> %v claim lost", f.ID)
+		f.Status = claimed.Status
+		return
+	}
+
+	if computeErr != nil {
+		f.LastError = computeErr.Error()
+		f.Status = FingerprintPending
+
+		// a video that can not be read is left for a moderator
+		if f.Attempts >= FingerprintMaxAttempts {
+			f.Status = FingerprintFlagged
+		}
+
+		return f.save(tx)
+	}
+
+	if err = f.match(tx); err != nil {
+		return
+	}
+
+	f.Status = FingerprintClear
+	f.LastError = ""
+
+	if f.MatchType != "" {
+		f.Status = FingerprintFlagged
+	}
+
+	return f.save(tx)
+}
+
+// Register cleared videos in this weeks competition and the event they
+// were uploaded for, and tell the creator of the original when a copy
+// has been flagged
+func (f *Fingerprint) afterCheck(db *system.DB) {
+
+	switch f.Status {
+	case FingerprintClear, FingerprintApproved:
+		video := Video{BaseModel: BaseModel{ID: f.VideoID}, UserID: f.UserID}
+
+		if err := db.QueryRow(f.queryEventForVideo(), f.VideoID).Scan(&video.EventID); err != nil {
+			log.Printf("Fingerprint.afterCheck() video_id -> %v QueryRow() -> %v Error -> %v", f.VideoID, f.queryEventForVideo(), err)
+			return
+		}
+
+		compete := Competitor{}
+
+		if err := compete.RegisterForEvents(db, video); err != nil {
+			log.Println("Fingerprint.afterCheck() RegisterForEvents() Error -> ", err)
+		}
+	case FingerprintFlagged:
+		if f.MatchUserID == 0 {
+			return
+		}
+
+		if err := Notify(db, f.UserID, f.MatchUserID, VERB_REUPLOADED, f.VideoID, OBJECT_VIDEO); err != nil {
+			log.Println("Fingerprint.afterCheck() Notify() Error -> ", err)
+		}
+	}
+}
+
+// Retrieve a fingerprint
+func (f *Fingerprint) Get(db *system.DB, id uint64) (err error) {
+
+	if err = f.scan(db.QueryRow(f.queryGet(), id)); err != nil {
+		log.Printf("Fingerprint.Get() id -> %v QueryRow() -> %v Error -> %v", id, f.queryGet(), err)
+	}
+
+	return
+}
+
+// Flagged videos waiting for a moderator, oldest first
+func (f *Fingerprint) GetFlagged(db *system.DB, page int) (fingerprints []Fingerprint, err error) {
+
+	rows, err := db.Query(f.queryGetFlagged(), LimitQueryPerRequest, OffSet(page))
+
+	if err != nil {
+		log.Printf("Fingerprint.GetFlagged() Query() -> %v Error -> %v", f.queryGetFlagged(), err)
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		fingerprint := Fingerprint{}
+
+		if err = fingerprint.scan(rows); err != nil {
+			log.Println("Fingerprint.GetFlagged() Error -> ", err)
+			return
+		}
+
+		fingerprints = append(fingerprints, fingerprint)
+	}
+
+	return
+}
+
+// A moderator approves a flagged video, which enters this weeks
+// competition, or rejects it and it stays out
+func (f *Fingerprint) Review(db *system.DB, moderatorID uint64, approve bool) (err error) {
+
+	if f.ID == 0 {
+		return f.Errors(ErrorMissingID, "id")
+	}
+
+	if moderatorID == 0 {
+		return f.Errors(ErrorMissingValue, "moderator_id")
+	}
+
+	status := FingerprintRejected
+
+	if approve {
+		status = FingerprintApproved
+	}
+
+	now := time.Now()
+
+	res, err := db.Exec(f.queryReview(), f.ID, status, moderatorID, now)
+
+	if err != nil {
+		log.Printf("Fingerprint.Review() id -> %v Exec() -> %v Error -> %v", f.ID, f.queryReview(), err)
+		return
+	}
+
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return ErrorFingerprintNotFlagged
+	}
+
+	f.Status = status
+	f.ReviewedBy = moderatorID
+	f.ReviewedAt = &now
+	f.UpdatedAt = now
+
+	f.afterCheck(db)
+
+	return
+}
+
+// Fingerprint pending videos, run by the worker on an interval
+func ProcessFingerprints(db *system.DB, store storage.Storage) (err error) {
+
+	if store == nil {
+		return errors.New("storage is not set")
+	}
+
+	found := true
+
+	for i := 0; i < fingerprintBatchSize && found; i++ {
+		var f Fingerprint
+
+		if found, err = f.processNext(db, store); err != nil {
+			return
+		}
+	}
+
+	return
+}
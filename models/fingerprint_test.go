@@ -0,0 +1,24 @@
+package models
+
+import "testing"
+
+func TestFingerprintDistance(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+	}{
+		{"", 5},
+		{"0", 0},
+		{"3", 3},
+		{"7", fingerprintMaxNearDistance},
+		{"12", fingerprintMaxNearDistance},
+		{"-1", 5},
+		{"near", 5},
+	}
+
+	for _, test := range tests {
+		if got := fingerprintDistance(test.value, 5); got != test.want {
+			t.Errorf("fingerprintDistance(%q) = %v, want %v", test.value, got, test.want)
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/lib/pq"
 
 	"github.com/NaySoftware/go-fcm"
+	"github.com/rathvong/talentmob_server/deeplink"
 	"github.com/rathvong/talentmob_server/system"
 )
 
@@ -20,6 +21,8 @@ const (
 	OBJECT_EVENT         = "event"
 	OBJECT_EVENT_RANKING = "event_ranking"
 	OBJECT_COMPETITION   = "competition"
+	OBJECT_REPORT        = "report"
+	OBJECT_SANCTION      = "sanction"
 	VERB_FAVOURITED      = "favourited"
 	VERB_IMPORTED        = "imported"
 	VERB_VIEWED          = "viewed"
@@ -31,6 +34,12 @@ const (
 	VERB_FOLLOWED        = "followed"
 	VERB_VOTING_ENDED    = "voting_ended"
 	VERB_BOOST           = "boost"
+	VERB_RESOLVED        = "resolved"
+	VERB_SANCTIONED      = "sanctioned"
+	VERB_RESPONDED       = "responded"
+	VERB_PROCESSED       = "processed"
+	VERB_PROCESS_FAILED  = "processing_failed"
+	VERB_REUPLOADED      = "reuploaded"
 	PUSHSERVER_GOOGLE    = "google"
 	PUSHSEVER_APPLE      = "apple"
 )
@@ -38,9 +47,9 @@ const (
 //Server key to perform all push notifications
 var (
 	FCMServerKey = os.Getenv("FCM_SERVER_KEY")
-	Object       = []string{OBJECT_COMMENT, OBJECT_VIDEO, OBJECT_USER, OBJECT_EVENT, OBJECT_COMPETITION, OBJECT_EVENT_RANKING}
+	Object       = []string{OBJECT_COMMENT, OBJECT_VIDEO, OBJECT_USER, OBJECT_EVENT, OBJECT_COMPETITION, OBJECT_EVENT_RANKING, OBJECT_REPORT, OBJECT_SANCTION}
 
-	Verb = []string{VERB_FAVOURITED, VERB_COMMENTED, VERB_FOLLOWED, VERB_IMPORTED, VERB_JOINED, VERB_VOTING_BEGAN, VERB_UPVOTED, VERB_VIEWED, VERB_WON, VERB_VOTING_ENDED, VERB_BOOST}
+	Verb = []string{VERB_FAVOURITED, VERB_COMMENTED, VERB_FOLLOWED, VERB_IMPORTED, VERB_JOINED, VERB_VOTING_BEGAN, VERB_UPVOTED, VERB_VIEWED, VERB_WON, VERB_VOTING_ENDED, VERB_BOOST, VERB_RESOLVED, VERB_SANCTIONED, VERB_RESPONDED, VERB_PROCESSED, VERB_PROCESS_FAILED, VERB_REUPLOADED}
 )
 
 //Apple push notification format
@@ -65,12 +74,26 @@ type Aps struct {
 	Object                  interface{}     `json:"object"`
 	UnreadNotificationCount int             `json:"unread_notification_count"`
 	UrlImage                string          `json:"url_image"`
+	DeepLink                deeplink.Link   `json:"deep_link"`
 }
 
 type AlertMessage struct {
 	Aps Aps `json:"aps"`
 }
 
+// Content of a notification sent by email, the link
+// opens the object in the app or on the website
+type EmailMessage struct {
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+	Link    string `json:"link"`
+}
+
+// Links to the object a notification is about
+func (n *Notification) DeepLink() (link deeplink.Link, err error) {
+	return deeplink.Build(n.ObjectType, n.ObjectID)
+}
+
 // Build push notification and send out to all
 // active mobile devices registered by the user.
 func (n *Notification) SendPushNotification(db *system.DB) (err error) {
@@ -116,6 +139,11 @@ func (n *Notification) SendPushNotification(db *system.DB) (err error) {
 
 	alertMessage.Aps.Alert.Body = n.buildBodyText(sender, receiver, alertMessage.Aps.Object, db)
 
+	if alertMessage.Aps.DeepLink, err = n.DeepLink(); err != nil {
+		log.Printf("Notification.SendPushNotification() object_type -> %v DeepLink() Error -> %v", n.ObjectType, err)
+		err = nil
+	}
+
 	apis, err := receiver.Api.GetAllActiveAPIs(db, receiver.ID)
 
 	if err != nil {
@@ -192,6 +220,24 @@ func (n *Notification) GetObject(db *system.DB) (object interface{}, err error)
 		}
 
 		object = eventRanking
+
+	case OBJECT_REPORT:
+		report := Report{}
+
+		if err = report.Get(db, n.ObjectID); err != nil {
+			return
+		}
+
+		object = report
+
+	case OBJECT_SANCTION:
+		sanction := Sanction{}
+
+		if err = sanction.Get(db, n.ObjectID); err != nil {
+			return
+		}
+
+		object = sanction
 	}
 
 	return
@@ -223,6 +269,10 @@ func (n *Notification) buildBodyText(sender User, receiver User, object interfac
 		body += " has followed you"
 	case VERB_BOOST:
 		body += " has boosted "
+	case VERB_RESPONDED:
+		body += " has responded"
+	case VERB_RESOLVED, VERB_SANCTIONED, VERB_PROCESSED, VERB_PROCESS_FAILED:
+		body = ""
 	}
 
 	switch n.ObjectType {
@@ -239,6 +289,16 @@ func (n *Notification) buildBodyText(sender User, receiver User, object interfac
 		switch n.Verb {
 		case VERB_VOTING_BEGAN:
 		}
+	case OBJECT_REPORT:
+		report := object.(Report)
+
+		body += report.NotificationText(receiver.ID)
+
+	case OBJECT_SANCTION:
+		sanction := object.(Sanction)
+
+		body += sanction.NotificationText()
+
 	case OBJECT_COMMENT:
 		comment := object.(Comment)
 
@@ -258,6 +318,14 @@ func (n *Notification) buildBodyText(sender User, receiver User, object interfac
 			body += " your video: " + video.Title
 		case VERB_IMPORTED:
 			body += " a new video: " + video.Title
+		case VERB_RESPONDED:
+			body += " to your video: " + video.Title
+		case VERB_PROCESSED:
+			body += "Your video: " + video.Title + " is ready to watch"
+		case VERB_PROCESS_FAILED:
+			body += "Your video: " + video.Title + " could not be processed"
+		case VERB_REUPLOADED:
+			body += " may have re-uploaded your video as: " + video.Title + ". It is being reviewed"
 		default:
 			body += " on your video: " + video.Title
 		}
@@ -267,6 +335,53 @@ func (n *Notification) buildBodyText(sender User, receiver User, object interfac
 	return
 }
 
+// Build the email for a notification with the same text as the push
+// notification, the universal link is used so it opens on any device
+func (n *Notification) BuildEmailMessage(db *system.DB) (message EmailMessage, err error) {
+
+	if err = n.validateErrors(); err != nil {
+		log.Println("Notification.BuildEmailMessage() Error -> ", err)
+		return
+	}
+
+	sender := User{}
+	receiver := User{}
+
+	if err = sender.Get(db, n.SenderID); err != nil {
+		log.Println("Notification.BuildEmailMessage() Could not retrieve sender info.")
+		return
+	}
+
+	if err = receiver.Get(db, n.ReceiverID); err != nil {
+		log.Println("Notification.BuildEmailMessage() Could not retrieve receiver info.")
+		return
+	}
+
+	object, err := n.GetObject(db)
+
+	if err != nil {
+		log.Println("Notification.BuildEmailMessage() Could not retrieve object.", err)
+		return
+	}
+
+	link, err := n.DeepLink()
+
+	if err != nil {
+		log.Printf("Notification.BuildEmailMessage() object_type -> %v DeepLink() Error -> %v", n.ObjectType, err)
+		return
+	}
+
+	return newEmailMessage(n.buildBodyText(sender, receiver, object, db), link), nil
+}
+
+func newEmailMessage(body string, link deeplink.Link) EmailMessage {
+	return EmailMessage{
+		Subject: "Talent Mob",
+		Link:    link.UniversalLink,
+		Body:    body + "\n\n" + link.UniversalLink,
+	}
+}
+
 // Push notification to FCM servers
 func (n *Notification) SendFCMPushToClient(pushToken string, msg AlertMessage) (err error) {
 	client := fcm.NewFcmClient(FCMServerKey)
@@ -642,6 +757,8 @@ func (n *Notification) GetNotifications(db *system.DB, userID uint64, page int)
 				   vu.account_type,
 				   vu.created_at,
 				   vu.updated_at,
+				   vu.verified,
+				   vu.verified_at,
 				   boosts.id,
 				   boosts.user_id,
 				   boosts.video_id,
@@ -680,6 +797,8 @@ func (n *Notification) GetNotifications(db *system.DB, userID uint64, page int)
 				   vu.account_type,
 				   vu.created_at,
 				   vu.updated_at,
+				   vu.verified,
+				   vu.verified_at,
 				   cvb.id,
 				   cvb.user_id,
 				   cvb.video_id,
@@ -789,6 +908,8 @@ func (n *Notification) ParseRowsForFeed(rows *sql.Rows) ([]Notification, error)
 		var vuAccountType sql.NullInt64
 		var vuCreatedAt pq.NullTime
 		var vuUpdatedAt pq.NullTime
+		var vuVerified sql.NullBool
+		var vuVerifiedAt pq.NullTime
 
 		var vBoostID sql.NullInt64
 		var vBoostUserId sql.NullInt64
@@ -831,6 +952,8 @@ func (n *Notification) ParseRowsForFeed(rows *sql.Rows) ([]Notification, error)
 		var cvuAccountType sql.NullInt64
 		var cvuCreatedAt pq.NullTime
 		var cvuUpdatedAt pq.NullTime
+		var cvuVerified sql.NullBool
+		var cvuVerifiedAt pq.NullTime
 
 		var cvBoostID sql.NullInt64
 		var cvBoostUserId sql.NullInt64
@@ -890,6 +1013,8 @@ func (n *Notification) ParseRowsForFeed(rows *sql.Rows) ([]Notification, error)
 			&vuAccountType,
 			&vuCreatedAt,
 			&vuUpdatedAt,
+			&vuVerified,
+			&vuVerifiedAt,
 			&vBoostID,
 			&vBoostUserId,
 			&vBoostVideoID,
@@ -928,6 +1053,8 @@ func (n *Notification) ParseRowsForFeed(rows *sql.Rows) ([]Notification, error)
 			&cvuAccountType,
 			&cvuCreatedAt,
 			&cvuUpdatedAt,
+			&cvuVerified,
+			&cvuVerifiedAt,
 			&cvBoostID,
 			&cvBoostUserId,
 			&cvBoostVideoID,
@@ -1086,6 +1213,14 @@ func (n *Notification) ParseRowsForFeed(rows *sql.Rows) ([]Notification, error)
 				v.Publisher.UpdatedAt = cvuUpdatedAt.Time
 			}
 
+			if cvuVerified.Valid {
+				v.Publisher.IsVerified = cvuVerified.Bool
+			}
+
+			if cvuVerifiedAt.Valid {
+				v.Publisher.VerifiedAt = &cvuVerifiedAt.Time
+			}
+
 			if cvBoostID.Valid {
 				v.Boost.ID = uint64(cvBoostID.Int64)
 			}
@@ -1214,6 +1349,14 @@ func (n *Notification) ParseRowsForFeed(rows *sql.Rows) ([]Notification, error)
 				v.Publisher.UpdatedAt = vuUpdatedAt.Time
 			}
 
+			if vuVerified.Valid {
+				v.Publisher.IsVerified = vuVerified.Bool
+			}
+
+			if vuVerifiedAt.Valid {
+				v.Publisher.VerifiedAt = &vuVerifiedAt.Time
+			}
+
 			if vBoostID.Valid {
 				v.Boost.ID = uint64(vBoostID.Int64)
 			}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/rathvong/talentmob_server/deeplink"
+)
+
+func TestNewEmailMessage(t *testing.T) {
+	link := deeplink.Link{
+		AppLink:       "talentmob://video/42",
+		UniversalLink: "https://www.talentmob.com/video/42",
+	}
+
+	message := newEmailMessage("sam liked your video.", link)
+
+	if message.Subject != "Talent Mob" {
+		t.Errorf("subject = %q", message.Subject)
+	}
+
+	if message.Link != link.UniversalLink {
+		t.Errorf("link = %q, want the universal link %q", message.Link, link.UniversalLink)
+	}
+
+	want := "sam liked your video.\n\nhttps://www.talentmob.com/video/42"
+
+	if message.Body != want {
+		t.Errorf("body = %q, want %q", message.Body, want)
+	}
+}
@@ -0,0 +1,745 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	pq "github.com/lib/pq"
+	"github.com/rathvong/talentmob_server/system"
+)
+
+// Limits on a playlist
+const (
+	MaxPlaylistTitleLength       = 60
+	MaxPlaylistDescriptionLength = 300
+	MaxPlaylistVideos            = 200
+)
+
+var (
+	ErrorPlaylistFull        = errors.New("playlist is full")
+	ErrorPlaylistReorder     = errors.New("reorder must include every video in the playlist")
+	ErrorPlaylistUnavailable = errors.New("playlist is not available")
+)
+
+// Named and ordered collection of videos curated by a user.
+// A private playlist is only visible to its owner, public
+// playlists can be followed and are found in discovery.
+// Videos are counted and listed only while they are active so
+// soft deleted videos drop out of every playlist.
+type Playlist struct {
+	BaseModel
+	UserID         uint64      `json:"user_id"`
+	Title          string      `json:"title"`
+	Description    string      `json:"description"`
+	IsPublic       bool        `json:"is_public"`
+	IsActive       bool        `json:"is_active"`
+	VideosCount    uint64      `json:"videos_count"`
+	FollowersCount uint64      `json:"followers_count"`
+	Thumbnail      string      `json:"thumbnail"`
+	IsFollowing    bool        `json:"is_following"`
+	Publisher      ProfileUser `json:"publisher"`
+}
+
+// Columns selected for every playlist read, $1 is the current user
+const playlistColumns = `playlists.id,
+					playlists.user_id,
+					playlists.title,
+					playlists.description,
+					playlists.is_public,
+					playlists.is_active,
+					(SELECT COUNT(*) FROM playlist_items INNER JOIN videos ON videos.id = playlist_items.video_id AND videos.is_active = true WHERE playlist_items.playlist_id = playlists.id),
+					(SELECT COUNT(*) FROM playlist_followers WHERE playlist_followers.playlist_id = playlists.id AND playlist_followers.is_active = true),
+					COALESCE((SELECT videos.thumbnail FROM playlist_items INNER JOIN videos ON videos.id = playlist_items.video_id AND videos.is_active = true WHERE playlist_items.playlist_id = playlists.id ORDER BY playlist_items.position ASC LIMIT 1), ''),
+					(SELECT EXISTS(SELECT 1 FROM playlist_followers WHERE playlist_followers.playlist_id = playlists.id AND playlist_followers.user_id = $1 AND playlist_followers.is_active = true)),
+					playlists.created_at,
+					playlists.updated_at,
+					users.id,
+					users.name,
+					users.avatar,
+					users.account_type,
+					users.created_at,
+					users.updated_at,
+					users.verified,
+					users.verified_at`
+
+func (p *Playlist) queryCreate() (qry string) {
+	return `INSERT INTO playlists
+						(user_id,
+						title,
+						description,
+						is_public,
+						is_active,
+						created_at,
+						updated_at)
+				VALUES
+						($1, $2, $3, $4, $5, $6, $7)
+				RETURNING id`
+}
+
+func (p *Playlist) queryUpdate() (qry string) {
+	return `UPDATE playlists SET
+						title = $2,
+						description = $3,
+						is_public = $4,
+						is_active = $5,
+						updated_at = $6
+				WHERE id = $1`
+}
+
+func (p *Playlist) queryGet() (qry string) {
+	return `SELECT ` + playlistColumns + `
+			FROM playlists
+			INNER JOIN users
+			ON users.id = playlists.user_id
+			WHERE playlists.id = $2
+			AND playlists.is_active = true`
+}
+
+func (p *Playlist) queryGetForUser() (qry string) {
+	return `SELECT ` + playlistColumns + `
+			FROM playlists
+			INNER JOIN users
+			ON users.id = playlists.user_id
+			WHERE playlists.user_id = $2
+			AND playlists.is_active = true
+			AND (playlists.is_public = true OR playlists.user_id = $1)
+			ORDER BY playlists.updated_at DESC
+			LIMIT $3
+			OFFSET $4`
+}
+
+func (p *Playlist) queryGetFollowing() (qry string) {
+	return `SELECT ` + playlistColumns + `
+			FROM playlist_followers
+			INNER JOIN playlists
+			ON playlists.id = playlist_followers.playlist_id
+			AND playlists.is_active = true
+			AND playlists.is_public = true
+			INNER JOIN users
+			ON users.id = playlists.user_id
+			WHERE playlist_followers.user_id = $1
+			AND playlist_followers.is_active = true
+			ORDER BY playlist_followers.updated_at DESC
+			LIMIT $2
+			OFFSET $3`
+}
+
+// SQL query to search public playlists by title and description.
+// An empty query returns the most followed playlists.
+func (p *Playlist) queryFind() (qry string) {
+	return `SELECT ` + playlistColumns + `
+			FROM playlists
+			INNER JOIN users
+			ON users.id = playlists.user_id
+			AND users.is_active = true
+			WHERE playlists.is_active = true
+			AND playlists.is_public = true
+			AND NOT is_shadowbanned(playlists.user_id)
+			AND ($2 = ''
+				OR playlists.title ILIKE $3
+				OR similarity(playlists.title, $2) > 0.2
+				OR word_similarity($2, playlists.description) > 0.4)
+			ORDER BY
+				CASE WHEN $2 = '' THEN 0 ELSE GREATEST(similarity(playlists.title, $2), word_similarity($2, playlists.description) * 0.5) END DESC,
+				(SELECT COUNT(*) FROM playlist_followers WHERE playlist_followers.playlist_id = playlists.id AND playlist_followers.is_active = true) DESC,
+				playlists.updated_at DESC
+			LIMIT $4
+			OFFSET $5`
+}
+
+// SQL query for the videos of a playlist in order
+func (p *Playlist) queryGetVideos() (qry string) {
+	return `SELECT	videos.id,
+					videos.user_id,
+					videos.categories,
+					videos.downvotes,
+					videos.upvotes,
+					videos.shares,
+					videos.views,
+					videos.comments,
+					videos.thumbnail,
+					videos.key,
+					videos.title,
+					videos.created_at,
+					videos.updated_at,
+					videos.is_active,
+					videos.upvote_trending_count
+			FROM playlist_items
+			INNER JOIN videos
+			ON videos.id = playlist_items.video_id
+			AND videos.is_active = true
+			WHERE playlist_items.playlist_id = $1
+			AND (videos.user_id = $2 OR NOT is_shadowbanned(videos.user_id))
+			ORDER BY playlist_items.position ASC
+			LIMIT $3
+			OFFSET $4`
+}
+
+func (p *Playlist) queryCountItems() (qry string) {
+	return `SELECT COUNT(*) FROM playlist_items WHERE playlist_id = $1`
+}
+
+// SQL query to count the active videos in a playlist
+// and how many of them are in the list given
+func (p *Playlist) queryCountActiveItems() (qry string) {
+	return `SELECT	COUNT(*),
+					COUNT(*) FILTER (WHERE playlist_items.video_id = ANY($2::integer[]))
+			FROM playlist_items
+			INNER JOIN videos
+			ON videos.id = playlist_items.video_id
+			AND videos.is_active = true
+			WHERE playlist_items.playlist_id = $1`
+}
+
+// SQL query to hold the playlist while its items are changed
+func (p *Playlist) queryLock() (qry string) {
+	return `SELECT id FROM playlists WHERE id = $1 FOR UPDATE`
+}
+
+// SQL query to add a video at the end of the playlist
+func (p *Playlist) queryAddVideo() (qry string) {
+	return `INSERT INTO playlist_items
+						(playlist_id,
+						video_id,
+						position,
+						created_at,
+						updated_at)
+				SELECT	$1,
+						$2,
+						COALESCE(MAX(position), 0) + 1,
+						$3,
+						$3
+				FROM playlist_items
+				WHERE playlist_id = $1
+				ON CONFLICT (playlist_id, video_id) DO NOTHING`
+}
+
+// SQL query to remove a video and close the gap it leaves
+func (p *Playlist) queryRemoveVideo() (qry string) {
+	return `WITH removed AS (
+					DELETE FROM playlist_items
+					WHERE playlist_id = $1
+					AND video_id = $2
+					RETURNING position
+				)
+				UPDATE playlist_items SET
+						position = playlist_items.position - 1,
+						updated_at = $3
+				FROM removed
+				WHERE playlist_items.playlist_id = $1
+				AND playlist_items.position > removed.position`
+}
+
+// SQL query to number every video from an ordered list,
+// videos left out of the list follow in their old order
+func (p *Playlist) queryReorder() (qry string) {
+	return `WITH ordered AS (
+					SELECT	playlist_items.id,
+							row_number() OVER (ORDER BY given.ordinality ASC NULLS LAST, playlist_items.position ASC) AS position
+					FROM playlist_items
+					LEFT JOIN unnest($2::integer[]) WITH ORDINALITY AS given(video_id, ordinality)
+					ON given.video_id = playlist_items.video_id
+					WHERE playlist_items.playlist_id = $1
+				)
+				UPDATE playlist_items SET
+						position = ordered.position,
+						updated_at = $3
+				FROM ordered
+				WHERE playlist_items.id = ordered.id`
+}
+
+func (p *Playlist) queryTouch() (qry string) {
+	return `UPDATE playlists SET updated_at = $2 WHERE id = $1`
+}
+
+func (p *Playlist) queryFollow() (qry string) {
+	return `INSERT INTO playlist_followers
+						(playlist_id,
+						user_id,
+						is_active,
+						created_at,
+						updated_at)
+				VALUES
+						($1, $2, $3, $4, $4)
+				ON CONFLICT (playlist_id, user_id) DO UPDATE SET
+						is_active = EXCLUDED.is_active,
+						updated_at = EXCLUDED.updated_at`
+}
+
+func (p *Playlist) validateErrors() (err error) {
+	if p.UserID == 0 {
+		return p.Errors(ErrorMissingValue, "user_id")
+	}
+
+	if p.Title == "" {
+		return p.Errors(ErrorMissingValue, "title")
+	}
+
+	if len([]rune(p.Title)) > MaxPlaylistTitleLength {
+		return p.Errors(ErrorIncorrectValue, "title")
+	}
+
+	if len([]rune(p.Description)) > MaxPlaylistDescriptionLength {
+		return p.Errors(ErrorIncorrectValue, "description")
+	}
+
+	return
+}
+
+// Create a new playlist
+func (p *Playlist) Create(db *system.DB) (err error) {
+
+	p.Title = strings.TrimSpace(p.Title)
+	p.Description = strings.TrimSpace(p.Description)
+
+	if err = p.validateErrors(); err != nil {
+		return
+	}
+
+	p.IsActive = true
+	p.CreatedAt = time.Now()
+	p.UpdatedAt = time.Now()
+
+	err = db.QueryRow(p.queryCreate(),
+		p.UserID,
+		p.Title,
+		p.Description,
+		p.IsPublic,
+		p.IsActive,
+		p.CreatedAt,
+		p.UpdatedAt,
+	).Scan(&p.ID)
+
+	if err != nil {
+		log.Printf("Playlist.Create() user_id -> %v QueryRow() -> %v Error -> %v", p.UserID, p.queryCreate(), err)
+	}
+
+	return
+}
+
+// Update the title, description or visibility of a playlist
+func (p *Playlist) Update(db *system.DB) (err error) {
+
+	if p.ID == 0 {
+		return p.Errors(ErrorMissingID, "id")
+	}
+
+	p.Title = strings.TrimSpace(p.Title)
+	p.Description = strings.TrimSpace(p.Description)
+
+	if err = p.validateErrors(); err != nil {
+		return
+	}
+
+	p.UpdatedAt = time.Now()
+
+	if _, err = db.Exec(p.queryUpdate(), p.ID, p.Title, p.Description, p.IsPublic, p.IsActive, p.UpdatedAt); err != nil {
+		log.Printf("Playlist.Update() id -> %v Exec() -> %v Error -> %v", p.ID, p.queryUpdate(), err)
+	}
+
+	return
+}
+
+// Remove a playlist
+func (p *Playlist) SoftDelete(db *system.DB) (err error) {
+	p.IsActive = false
+
+	return p.Update(db)
+}
+
+// Retrieve a playlist visible to the current user
+func (p *Playlist) Get(db *system.DB, id uint64, currentUserID uint64) (err error) {
+
+	if id == 0 {
+		return p.Errors(ErrorMissingID, "id")
+	}
+
+	if err = p.scan(db.QueryRow(p.queryGet(), currentUserID, id)); err != nil {
+		log.Printf("Playlist.Get() id -> %v QueryRow() -> %v Error -> %v", id, p.queryGet(), err)
+		return
+	}
+
+	if !p.IsVisible(currentUserID) {
+		return ErrorPlaylistUnavailable
+	}
+
+	return
+}
+
+// Check if a user can see the playlist
+func (p *Playlist) IsVisible(userID uint64) bool {
+	return p.IsActive && (p.IsPublic || p.UserID == userID)
+}
+
+// Retrieve the playlists of a user, private playlists are
+// only included for the owner
+func (p *Playlist) GetForUser(db *system.DB, userID uint64, currentUserID uint64, page int) (playlists []Playlist, err error) {
+
+	if userID == 0 {
+		return playlists, p.Errors(ErrorMissingValue, "user_id")
+	}
+
+	rows, err := db.Query(p.queryGetForUser(), currentUserID, userID, LimitQueryPerRequest, OffSet(page))
+
+	if err != nil {
+		log.Printf("Playlist.GetForUser() user_id -> %v Query() -> %v Error -> %v", userID, p.queryGetForUser(), err)
+		return
+	}
+
+	defer rows.Close()
+
+	return p.parseRows(rows)
+}
+
+// Retrieve the public playlists a user follows
+func (p *Playlist) GetFollowing(db *system.DB, userID uint64, page int) (playlists []Playlist, err error) {
+
+	if userID == 0 {
+		return playlists, p.Errors(ErrorMissingValue, "user_id")
+	}
+
+	rows, err := db.Query(p.queryGetFollowing(), userID, LimitQueryPerRequest, OffSet(page))
+
+	if err != nil {
+		log.Printf("Playlist.GetFollowing() user_id -> %v Query() -> %v Error -> %v", userID, p.queryGetFollowing(), err)
+		return
+	}
+
+	defer rows.Close()
+
+	return p.parseRows(rows)
+}
+
+// Search public playlists for discovery
+func (p *Playlist) Find(db *system.DB, qry string, currentUserID uint64, page int) (playlists []Playlist, err error) {
+
+	title := strings.TrimSpace(qry)
+	pattern := "%" + title + "%"
+
+	rows, err := db.Query(p.queryFind(), currentUserID, title, pattern, LimitQueryPerRequest, OffSet(page))
+
+	if err != nil {
+		log.Printf("Playlist.Find() title -> %v Query() -> %v Error -> %v", title, p.queryFind(), err)
+		return
+	}
+
+	defer rows.Close()
+
+	return p.parseRows(rows)
+}
+
+// Retrieve the active videos of a playlist in order
+func (p *Playlist) GetVideos(db *system.DB, currentUserID uint64, page int) (videos []Video, err error) {
+
+	if p.ID == 0 {
+		return videos, p.Errors(ErrorMissingID, "id")
+	}
+
+	rows, err := db.Query(p.queryGetVideos(), p.ID, currentUserID, LimitQueryPerRequest, OffSet(page))
+
+	if err != nil {
+		log.Printf("Playlist.GetVideos() id -> %v Query() -> %v Error -> %v", p.ID, p.queryGetVideos(), err)
+		return
+	}
+
+	defer rows.Close()
+
+	var v Video
+
+	return v.parseRows(db, rows, currentUserID, 0)
+}
+
+// Add a video to the end of the playlist, adding a video
+// twice leaves it where it is
+func (p *Playlist) AddVideo(db *system.DB, videoID uint64) (err error) {
+
+	if p.ID == 0 {
+		return p.Errors(ErrorMissingID, "id")
+	}
+
+	video := Video{}
+
+	if err = video.GetVideoByID(db, videoID); err != nil {
+		return p.Errors(ErrorIncorrectValue, "video_id")
+	}
+
+	if !video.IsActive || !video.IsPublished() {
+		return p.Errors(ErrorIncorrectValue, "video_id")
+	}
+
+	tx, err := db.Begin()
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			tx.Rollback()
+			return
+		}
+	}()
+
+	if err != nil {
+		log.Println("Playlist.AddVideo() Begin() Error -> ", err)
+		return
+	}
+
+	if err = p.lock(tx); err != nil {
+		return
+	}
+
+	var count int
+
+	if err = tx.QueryRow(p.queryCountItems(), p.ID).Scan(&count); err != nil {
+		log.Printf("Playlist.AddVideo() id -> %v QueryRow() -> %v Error -> %v", p.ID, p.queryCountItems(), err)
+		return
+	}
+
+	if count >= MaxPlaylistVideos {
+		err = ErrorPlaylistFull
+		return
+	}
+
+	updatedAt := time.Now()
+
+	if _, err = tx.Exec(p.queryAddVideo(), p.ID, videoID, updatedAt); err != nil {
+		log.Printf("Playlist.AddVideo() id -> %v Exec() -> %v Error -> %v", p.ID, p.queryAddVideo(), err)
+		return
+	}
+
+	return p.touch(tx, updatedAt)
+}
+
+// Remove a video from the playlist
+func (p *Playlist) RemoveVideo(db *system.DB, videoID uint64) (err error) {
+
+	if p.ID == 0 {
+		return p.Errors(ErrorMissingID, "id")
+	}
+
+	if videoID == 0 {
+		return p.Errors(ErrorMissingValue, "video_id")
+	}
+
+	tx, err := db.Begin()
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			tx.Rollback()
+			return
+		}
+	}()
+
+	if err != nil {
+		log.Println("Playlist.RemoveVideo() Begin() Error -> ", err)
+		return
+	}
+
+	if err = p.lock(tx); err != nil {
+		return
+	}
+
+	updatedAt := time.Now()
+
+	if _, err = tx.Exec(p.queryRemoveVideo(), p.ID, videoID, updatedAt); err != nil {
+		log.Printf("Playlist.RemoveVideo() id -> %v Exec() -> %v Error -> %v", p.ID, p.queryRemoveVideo(), err)
+		return
+	}
+
+	return p.touch(tx, updatedAt)
+}
+
+// Put the videos of a playlist in a new order.
+// The list must hold every active video in the playlist once,
+// soft deleted videos are moved behind them.
+func (p *Playlist) Reorder(db *system.DB, videoIDs []uint64) (err error) {
+
+	if p.ID == 0 {
+		return p.Errors(ErrorMissingID, "id")
+	}
+
+	seen := make(map[uint64]bool)
+	ids := make([]int64, 0, len(videoIDs))
+
+	for _, id := range videoIDs {
+		if seen[id] {
+			return ErrorPlaylistReorder
+		}
+
+		seen[id] = true
+		ids = append(ids, int64(id))
+	}
+
+	tx, err := db.Begin()
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			tx.Rollback()
+			return
+		}
+	}()
+
+	if err != nil {
+		log.Println("Playlist.Reorder() Begin() Error -> ", err)
+		return
+	}
+
+	if err = p.lock(tx); err != nil {
+		return
+	}
+
+	var count, listed int
+
+	if err = tx.QueryRow(p.queryCountActiveItems(), p.ID, pq.Array(ids)).Scan(&count, &listed); err != nil {
+		log.Printf("Playlist.Reorder() id -> %v QueryRow() -> %v Error -> %v", p.ID, p.queryCountActiveItems(), err)
+		return
+	}
+
+	if listed != count || len(ids) != count {
+		err = ErrorPlaylistReorder
+		return
+	}
+
+	updatedAt := time.Now()
+
+	if _, err = tx.Exec(p.queryReorder(), p.ID, pq.Array(ids), updatedAt); err != nil {
+		log.Printf("Playlist.Reorder() id -> %v Exec() -> %v Error -> %v", p.ID, p.queryReorder(), err)
+		return
+	}
+
+	return p.touch(tx, updatedAt)
+}
+
+// Follow or unfollow a public playlist
+func (p *Playlist) Follow(db *system.DB, userID uint64, follow bool) (err error) {
+
+	if p.ID == 0 {
+		return p.Errors(ErrorMissingID, "id")
+	}
+
+	if userID == 0 || userID == p.UserID {
+		return p.Errors(ErrorIncorrectValue, "user_id")
+	}
+
+	if follow && !p.IsVisible(userID) {
+		return ErrorPlaylistUnavailable
+	}
+
+	if _, err = db.Exec(p.queryFollow(), p.ID, userID, follow, time.Now()); err != nil {
+		log.Printf("Playlist.Follow() id -> %v user_id -> %v Exec() -> %v Error -> %v", p.ID, userID, p.queryFollow(), err)
+		return
+	}
+
+	if follow != p.IsFollowing {
+		p.IsFollowing = follow
+
+		if follow {
+			p.FollowersCount++
+		} else if p.FollowersCount > 0 {
+			p.FollowersCount--
+		}
+	}
+
+	return
+}
+
+func (p *Playlist) lock(tx *sql.Tx) (err error) {
+
+	if err = tx.QueryRow(p.queryLock(), p.ID).Scan(&p.ID); err != nil {
+		log.Printf("Playlist.lock() id -> %v QueryRow() -> %v Error -> %v", p.ID, p.queryLock(), err)
+		return
+	}
+
+	return
+}
+
+func (p *Playlist) touch(tx *sql.Tx, updatedAt time.Time) (err error) {
+
+	if _, err = tx.Exec(p.queryTouch(), p.ID, updatedAt); err != nil {
+		log.Printf("Playlist.touch() id -> %v Exec() -> %v Error -> %v", p.ID, p.queryTouch(), err)
+		return
+	}
+
+	p.UpdatedAt = updatedAt
+
+	return
+}
+
+func (p *Playlist) scan(row *sql.Row) (err error) {
+	return row.Scan(
+		&p.ID,
+		&p.UserID,
+		&p.Title,
+		&p.Description,
+		&p.IsPublic,
+		&p.IsActive,
+		&p.VideosCount,
+		&p.FollowersCount,
+		&p.Thumbnail,
+		&p.IsFollowing,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+		&p.Publisher.ID,
+		&p.Publisher.Name,
+		&p.Publisher.Avatar,
+		&p.Publisher.AccountType,
+		&p.Publisher.CreatedAt,
+		&p.Publisher.UpdatedAt,
+		&p.Publisher.IsVerified,
+		&p.Publisher.VerifiedAt,
+	)
+}
+
+func (p *Playlist) parseRows(rows *sql.Rows) (playlists []Playlist, err error) {
+
+	for rows.Next() {
+		playlist := Playlist{}
+
+		err = rows.Scan(
+			&playlist.ID,
+			&playlist.UserID,
+			&playlist.Title,
+			&playlist.Description,
+			&playlist.IsPublic,
+			&playlist.IsActive,
+			&playlist.VideosCount,
+			&playlist.FollowersCount,
+			&playlist.Thumbnail,
+			&playlist.IsFollowing,
+			&playlist.CreatedAt,
+			&playlist.UpdatedAt,
+			&playlist.Publisher.ID,
+			&playlist.Publisher.Name,
+			&playlist.Publisher.Avatar,
+			&playlist.Publisher.AccountType,
+			&playlist.Publisher.CreatedAt,
+			&playlist.Publisher.UpdatedAt,
+			&playlist.Publisher.IsVerified,
+			&playlist.Publisher.VerifiedAt,
+		)
+
+		if err != nil {
+			log.Println("Playlist.parseRows() Error -> ", err)
+			return
+		}
+
+		playlists = append(playlists, playlist)
+	}
+
+	return
+}
@@ -27,10 +27,11 @@ const (
 	POINT_TRANSACTION_9500_STARPOWER
 	POINT_TRANSACTION_24500_STARPOWER
 	POINT_TRANSACTION_100000_STARPOWER
+	POINT_ACTIVITY_SHARED_USER
 )
 
 // Contains the point value for each activity performed
-var activityPoints = []int64{10, 25, 50, 1000, -2500, -5000, -10000, 0, 10, -1000, 2250, 9500, 24500, 100000}
+var activityPoints = []int64{10, 25, 50, 1000, -2500, -5000, -10000, 0, 10, -1000, 2250, 9500, 24500, 100000, ShareRewardPoints}
 
 const (
 	POINT_ADS         = "ads"
@@ -98,6 +99,9 @@ func (p *Point) AddPoints(activity PointActivity) {
 		p.ReferredUsers = p.ReferredUsers + uint64(activity.Value())
 		p.TotalLifetime = p.TotalLifetime + activity.Value()
 
+	case POINT_ACTIVITY_SHARED_USER:
+		p.TotalLifetime = p.TotalLifetime + activity.Value()
+
 	case POINT_ACTIVITY_TWENTY_FOUR_HOUR_BOOST:
 		p.TwentyFourHourVideoBoost = p.TwentyFourHourVideoBoost + activity.Value()
 
@@ -7,23 +7,25 @@ import (
 	"strings"
 )
 
-// This query model will only support video and user
+// This query model will only support video, user and playlist
 // queries. If the query request does not match
 // the data type supported. The server will send out
 // an error response
 type QueryType int
 
 const (
-	VIDEO = "video"
-	USER  = "user"
+	VIDEO    = "video"
+	USER     = "user"
+	PLAYLIST = "playlist"
 )
 
 const (
 	QUERY_VIDEO QueryType = iota
 	QUERY_USER
+	QUERY_PLAYLIST
 )
 
-var queryTypes = []string{VIDEO, USER}
+var queryTypes = []string{VIDEO, USER, PLAYLIST}
 
 // Return query type to string
 func (q *QueryType) String() (s string) {
@@ -67,6 +69,8 @@ func (q *Query) SetQueryType(qt string) (err error) {
 
 	case VIDEO:
 		q.QueryType = QUERY_VIDEO
+	case PLAYLIST:
+		q.QueryType = QUERY_PLAYLIST
 	default:
 		return q.Errors(ErrorIncorrectValue, "query_type")
 	}
@@ -102,6 +106,11 @@ func (q *Query) Find(db *system.DB, page int) (result QueryResult, err error) {
 		}
 
 		result.Data, err = v.GetDiscoveryTimeLine(db, q.UserID, page)
+
+	case QUERY_PLAYLIST:
+		p := Playlist{}
+		result.ObjectType = PLAYLIST
+		result.Data, err = p.Find(db, q.Qry, q.UserID, page)
 	}
 
 	return
@@ -132,6 +141,11 @@ func (q *Query) Find2(db *system.DB, page int) (result QueryResult, err error) {
 		}
 
 		result.Data, err = v.GetDiscoveryTimeLine2(db, q.UserID, page)
+
+	case QUERY_PLAYLIST:
+		p := Playlist{}
+		result.ObjectType = PLAYLIST
+		result.Data, err = p.Find(db, q.Qry, q.UserID, page)
 	}
 
 	return
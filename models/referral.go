@@ -0,0 +1,341 @@
+package models
+
+import (
+	"log"
+	"time"
+
+	"github.com/rathvong/talentmob_server/system"
+)
+
+// Status of a referral
+const (
+	ReferralStatusPending  = "pending"
+	ReferralStatusRewarded = "rewarded"
+	ReferralStatusRejected = "rejected"
+)
+
+// Reasons a referral will not be rewarded
+const (
+	ReferralReasonSelfReferral = "self_referral"
+	ReferralReasonDeviceReused = "device_reused"
+)
+
+// Referrals track who invited a new user with their referral code.
+// The referrer is only awarded POINT_ACTIVITY_REFERRED_USERS once the
+// new user is activated by casting their first vote or uploading a video.
+// Referrals coming from the referrers own device or a device that already
+// has an account are rejected and never rewarded.
+type Referral struct {
+	BaseModel
+	ReferrerID  uint64      `json:"referrer_id"`
+	ReferredID  uint64      `json:"referred_id"`
+	Code        string      `json:"code"`
+	DeviceID    string      `json:"-"`
+	Status      string      `json:"status"`
+	Reason      string      `json:"reason"`
+	ActivatedAt *time.Time  `json:"activated_at"`
+	Referred    ProfileUser `json:"referred"`
+}
+
+func (r *Referral) queryCreate() (qry string) {
+	return `INSERT INTO referrals
+						(referrer_id,
+						referred_id,
+						code,
+						device_id,
+						status,
+						reason,
+						created_at,
+						updated_at)
+				VALUES
+						($1, $2, $3, $4, $5, $6, $7, $8)
+				RETURNING id`
+}
+
+// SQL query to check if the device belongs to the referrer
+func (r *Referral) querySelfReferral() (qry string) {
+	return `SELECT EXISTS(SELECT 1 FROM apis WHERE user_id = $1 AND device_id = $2)`
+}
+
+// SQL query to check if the device was used by another account
+// or has already been used for a referral
+func (r *Referral) queryDeviceReused() (qry string) {
+	return `SELECT EXISTS(SELECT 1 FROM apis WHERE user_id != $1 AND device_id = $2)
+			OR EXISTS(SELECT 1 FROM referrals WHERE device_id = $2)`
+}
+
+// SQL query to mark a pending referral as rewarded
+// it will only update once so the referrer can not be paid twice
+func (r *Referral) queryActivate() (qry string) {
+	return `UPDATE referrals SET
+						status = 'rewarded',
+						activated_at = $2,
+						updated_at = $2
+				WHERE referred_id = $1
+				AND status = 'pending'
+				RETURNING id, referrer_id`
+}
+
+// Same columns Point.AddPoints changes for POINT_ACTIVITY_REFERRED_USERS
+func (r *Referral) queryAddReferrerPoints() (qry string) {
+	return `UPDATE points SET
+						referred_users = referred_users + $2,
+						total_lifetime = total_lifetime + $2,
+						updated_at = $3
+				WHERE user_id = $1`
+}
+
+func (r *Referral) queryGetForReferrer() (qry string) {
+	return `SELECT	referrals.id,
+					referrals.referrer_id,
+					referrals.referred_id,
+					referrals.code,
+					referrals.status,
+					referrals.reason,
+					referrals.activated_at,
+					referrals.created_at,
+					referrals.updated_at,
+					users.id,
+					users.avatar,
+					users.name,
+					users.account_type,
+					users.created_at,
+					users.updated_at,
+					users.verified,
+					users.verified_at
+			FROM referrals
+			INNER JOIN users
+			ON users.id = referrals.referred_id
+			WHERE referrals.referrer_id = $1
+			ORDER BY referrals.created_at DESC, referrals.id DESC
+			LIMIT $2
+			OFFSET $3`
+}
+
+func (r *Referral) validateCreateErrors() (err error) {
+	if r.ReferrerID == 0 {
+		return r.Errors(ErrorMissingValue, "referrer_id")
+	}
+
+	if r.ReferredID == 0 {
+		return r.Errors(ErrorMissingValue, "referred_id")
+	}
+
+	if r.Code == "" {
+		return r.Errors(ErrorMissingValue, "code")
+	}
+
+	return
+}
+
+// Record a new user signing up with a referral code.
+// Self referrals and reused devices are stored as rejected
+// so they show up in the referrers list without being rewarded.
+func (r *Referral) Create(db *system.DB) (err error) {
+
+	if err = r.validateCreateErrors(); err != nil {
+		log.Println("Referral.Create() Error -> ", err)
+		return
+	}
+
+	r.Status = ReferralStatusPending
+
+	if r.ReferrerID == r.ReferredID {
+		r.Status = ReferralStatusRejected
+		r.Reason = ReferralReasonSelfReferral
+	} else if r.DeviceID != "" {
+		var exists bool
+
+		if err = db.QueryRow(r.querySelfReferral(), r.ReferrerID, r.DeviceID).Scan(&exists); err != nil {
+			log.Printf("Referral.Create() QueryRow() -> %v Error -> %v", r.querySelfReferral(), err)
+			return
+		}
+
+		if exists {
+			r.Status = ReferralStatusRejected
+			r.Reason = ReferralReasonSelfReferral
+		} else {
+
+			if err = db.QueryRow(r.queryDeviceReused(), r.ReferredID, r.DeviceID).Scan(&exists); err != nil {
+				log.Printf("Referral.Create() QueryRow() -> %v Error -> %v", r.queryDeviceReused(), err)
+				return
+			}
+
+			if exists {
+				r.Status = ReferralStatusRejected
+				r.Reason = ReferralReasonDeviceReused
+			}
+		}
+	}
+
+	tx, err := db.Begin()
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			tx.Rollback()
+			return
+		}
+	}()
+
+	if err != nil {
+		log.Println("Referral.Create() Begin() Error -> ", err)
+		return
+	}
+
+	r.CreatedAt = time.Now()
+	r.UpdatedAt = time.Now()
+
+	err = tx.QueryRow(r.queryCreate(),
+		r.ReferrerID,
+		r.ReferredID,
+		r.Code,
+		r.DeviceID,
+		r.Status,
+		r.Reason,
+		r.CreatedAt,
+		r.UpdatedAt,
+	).Scan(&r.ID)
+
+	if err != nil {
+		log.Printf("Referral.Create() referred_id -> %v QueryRow() -> %v Error -> %v", r.ReferredID, r.queryCreate(), err)
+		return
+	}
+
+	return
+}
+
+// Retrieve the users a referrer has invited
+func (r *Referral) GetForReferrer(db *system.DB, referrerID uint64, page int) (referrals []Referral, err error) {
+
+	if referrerID == 0 {
+		return referrals, r.Errors(ErrorMissingValue, "referrer_id")
+	}
+
+	rows, err := db.Query(r.queryGetForReferrer(), referrerID, LimitQueryPerRequest, OffSet(page))
+
+	if err != nil {
+		log.Printf("Referral.GetForReferrer() referrer_id -> %v Query() -> %v Error -> %v", referrerID, r.queryGetForReferrer(), err)
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		referral := Referral{}
+
+		err = rows.Scan(
+			&referral.ID,
+			&referral.ReferrerID,
+			&referral.ReferredID,
+			&referral.Code,
+			&referral.Status,
+			&referral.Reason,
+			&referral.ActivatedAt,
+			&referral.CreatedAt,
+			&referral.UpdatedAt,
+			&referral.Referred.ID,
+			&referral.Referred.Avatar,
+			&referral.Referred.Name,
+			&referral.Referred.AccountType,
+			&referral.Referred.CreatedAt,
+			&referral.Referred.UpdatedAt,
+			&referral.Referred.IsVerified,
+			&referral.Referred.VerifiedAt,
+		)
+
+		if err != nil {
+			log.Println("Referral.GetForReferrer() Error -> ", err)
+			return
+		}
+
+		referrals = append(referrals, referral)
+	}
+
+	return
+}
+
+// Register a new user against the owner of a referral code.
+// An unknown code is logged and ignored so it never blocks a sign up.
+func RegisterReferral(db *system.DB, user User, code string, deviceID string) {
+
+	if code == "" {
+		return
+	}
+
+	var referrer User
+
+	referrerID, err := referrer.GetIDByReferralCode(db, code)
+
+	if err != nil {
+		log.Printf("RegisterReferral() unknown code -> %v user_id -> %v", code, user.ID)
+		return
+	}
+
+	referral := Referral{
+		ReferrerID: referrerID,
+		ReferredID: user.ID,
+		Code:       code,
+		DeviceID:   deviceID,
+	}
+
+	if err := referral.Create(db); err != nil {
+		log.Println("RegisterReferral() Error -> ", err)
+		return
+	}
+
+	if referral.Status == ReferralStatusRejected {
+		log.Printf("RegisterReferral() referral rejected user_id -> %v reason -> %v", user.ID, referral.Reason)
+	}
+}
+
+// Award the referrer once a referred user is activated.
+// This should be called after a users first vote or upload,
+// it is safe to call many times as only a pending referral is paid.
+// The referral and the referrers points are updated in one transaction.
+func ActivateReferral(db *system.DB, userID uint64) {
+
+	if userID == 0 {
+		return
+	}
+
+	var r Referral
+
+	tx, err := db.Begin()
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			tx.Rollback()
+			return
+		}
+
+		log.Printf("ActivateReferral() referral -> %v referrer_id -> %v rewarded", r.ID, r.ReferrerID)
+	}()
+
+	if err != nil {
+		log.Println("ActivateReferral() Begin() Error -> ", err)
+		return
+	}
+
+	now := time.Now()
+
+	if err = tx.QueryRow(r.queryActivate(), userID, now).Scan(&r.ID, &r.ReferrerID); err != nil {
+		// no pending referral for this user
+		return
+	}
+
+	activity := POINT_ACTIVITY_REFERRED_USERS
+
+	if _, err = tx.Exec(r.queryAddReferrerPoints(), r.ReferrerID, activity.Value(), now); err != nil {
+		log.Printf("ActivateReferral() user_id -> %v Exec() -> %v Error -> %v", r.ReferrerID, r.queryAddReferrerPoints(), err)
+	}
+}
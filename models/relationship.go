@@ -154,6 +154,16 @@ func (r *Relationship) queryIsFollowing() (qry string) {
 	return `SELECT EXISTS(SELECT 1 FROM relationships WHERE followed_id = $1 AND follower_id = $2 AND is_active = true)`
 }
 
+/**
+Query if either user has blocked the other
+*/
+func (r *Relationship) queryIsBlocked() (qry string) {
+	return `SELECT EXISTS(SELECT 1 FROM relationships
+				WHERE relationship_type = 'block'
+				AND is_active = true
+				AND ((followed_id = $1 AND follower_id = $2) OR (followed_id = $2 AND follower_id = $1)))`
+}
+
 /**
 We must ensure the values needed for a relationship to be created
 is present. If it is not it will cause an error
@@ -332,6 +342,18 @@ func (r *Relationship) Exists(db *system.DB, followedID uint64, followerID uint6
 	return
 }
 
+/**
+Returns true if either user has blocked the other
+*/
+func (r *Relationship) IsBlocked(db *system.DB, userID uint64, otherUserID uint64) (blocked bool, err error) {
+
+	if err = db.QueryRow(r.queryIsBlocked(), userID, otherUserID).Scan(&blocked); err != nil {
+		log.Printf("Relationship.IsBlocked() user_id -> %v other_user_id -> %v QueryRow() -> %v Error -> %v", userID, otherUserID, r.queryIsBlocked(), err)
+	}
+
+	return
+}
+
 /**
 Returns true if a user is following another user
 */
@@ -0,0 +1,280 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rathvong/talentmob_server/storage"
+	"github.com/rathvong/talentmob_server/system"
+	"github.com/rathvong/talentmob_server/transcoder"
+)
+
+const (
+	DefaultAPIBaseURL = "https://talentmob.herokuapp.com"
+
+	// How long the signed segment urls in a rendition playlist last
+	StreamURLExpiry = 6 * time.Hour
+)
+
+var (
+	// Public address of the api used in stream urls, set with API_BASE_URL
+	APIBaseURL = streamAddress(os.Getenv("API_BASE_URL"), DefaultAPIBaseURL)
+
+	// Address the HLS segments are served from, usually a cdn in front of
+	// the bucket, set with STREAM_BASE_URL. When it is not set the api
+	// serves the rendition playlists with every segment url signed.
+	StreamBaseURL = streamAddress(os.Getenv("STREAM_BASE_URL"), "")
+
+	// Path of the stream route, set by the api from its routes
+	StreamPath string
+)
+
+func streamAddress(value string, fallback string) string {
+	if value == "" {
+		value = fallback
+	}
+
+	return strings.TrimRight(value, "/")
+}
+
+// An HLS rendition of a video written by a completed hls job
+type Rendition struct {
+	BaseModel
+	VideoID     uint64 `json:"video_id"`
+	Name        string `json:"name"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Bandwidth   int    `json:"bandwidth"`
+	PlaylistKey string `json:"playlist_key"`
+}
+
+func (r *Rendition) queryDeleteForVideo() (qry string) {
+	return `DELETE FROM renditions WHERE video_id = $1`
+}
+
+func (r *Rendition) queryCreate() (qry string) {
+	return `INSERT INTO renditions
+						(video_id,
+						name,
+						width,
+						height,
+						bandwidth,
+						playlist_key,
+						created_at,
+						updated_at)
+				VALUES
+						($1, $2, $3, $4, $5, $6, $7, $8)`
+}
+
+func (r *Rendition) queryGetForVideo() (qry string) {
+	return `SELECT	id,
+					video_id,
+					name,
+					width,
+					height,
+					bandwidth,
+					playlist_key,
+					created_at,
+					updated_at
+			FROM renditions
+			WHERE video_id = $1
+			ORDER BY bandwidth ASC`
+}
+
+// Replace the renditions of a video with the ones written by an hls job
+func saveRenditions(tx *sql.Tx, videoID uint64, prefix string, now time.Time) (err error) {
+	var r Rendition
+
+	if _, err = tx.Exec(r.queryDeleteForVideo(), videoID); err != nil {
+		log.Printf("saveRenditions() video_id -> %v Exec() -> %v Error -> %v", videoID, r.queryDeleteForVideo(), err)
+		return
+	}
+
+	for _, rendition := range transcoder.HLSRenditions {
+		_, err = tx.Exec(r.queryCreate(),
+			videoID,
+			rendition.Name,
+			rendition.Width,
+			rendition.Height,
+			rendition.Bandwidth,
+			transcoder.RenditionPlaylistKey(prefix, rendition.Name),
+			now,
+			now,
+		)
+
+		if err != nil {
+			log.Printf("saveRenditions() video_id -> %v Exec() -> %v Error -> %v", videoID, r.queryCreate(), err)
+			return
+		}
+	}
+
+	return
+}
+
+// Retrieve the renditions of a video, lowest bandwidth first
+func (r *Rendition) GetForVideo(db *system.DB, videoID uint64) (renditions []Rendition, err error) {
+
+	if videoID == 0 {
+		return renditions, r.Errors(ErrorMissingValue, "video_id")
+	}
+
+	rows, err := db.Query(r.queryGetForVideo(), videoID)
+
+	if err != nil {
+		log.Printf("Rendition.GetForVideo() video_id -> %v Query() -> %v Error -> %v", videoID, r.queryGetForVideo(), err)
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		rendition := Rendition{}
+
+		err = rows.Scan(
+			&rendition.ID,
+			&rendition.VideoID,
+			&rendition.Name,
+			&rendition.Width,
+			&rendition.Height,
+			&rendition.Bandwidth,
+			&rendition.PlaylistKey,
+			&rendition.CreatedAt,
+			&rendition.UpdatedAt,
+		)
+
+		if err != nil {
+			log.Println("Rendition.GetForVideo() Error -> ", err)
+			return
+		}
+
+		renditions = append(renditions, rendition)
+	}
+
+	return
+}
+
+// Address players load a rendition playlist from
+func (r *Rendition) URL() string {
+	if StreamBaseURL != "" {
+		return StreamBaseURL + "/" + r.PlaylistKey
+	}
+
+	return RenditionURL(r.VideoID, r.Name)
+}
+
+// Build the HLS master playlist for a video from its renditions
+func MasterPlaylist(db *system.DB, videoID uint64) (playlist string, err error) {
+	var r Rendition
+
+	renditions, err := r.GetForVideo(db, videoID)
+
+	if err != nil {
+		return
+	}
+
+	if len(renditions) == 0 {
+		return "", r.Errors(ErrorIncorrectValue, "video_id")
+	}
+
+	var b strings.Builder
+
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+
+	for _, rendition := range renditions {
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d,NAME=\"%s\"\n%s\n",
+			rendition.Bandwidth, rendition.Width, rendition.Height, rendition.Name, rendition.URL())
+	}
+
+	return b.String(), nil
+}
+
+// Load a rendition playlist from storage with each of its segments
+// replaced by a signed url, the bucket is private so players can not
+// load the relative segment paths written by the transcoder
+func RenditionPlaylist(db *system.DB, store storage.Storage, videoID uint64, name string) (playlist string, err error) {
+	var r Rendition
+
+	renditions, err := r.GetForVideo(db, videoID)
+
+	if err != nil {
+		return
+	}
+
+	for _, rendition := range renditions {
+		if rendition.Name == name {
+			r = rendition
+		}
+	}
+
+	if r.ID == 0 {
+		return "", r.Errors(ErrorIncorrectValue, "rendition")
+	}
+
+	body, _, err := store.Get(r.PlaylistKey)
+
+	if err != nil {
+		log.Printf("RenditionPlaylist() key -> %v Get() Error -> %v", r.PlaylistKey, err)
+		return
+	}
+
+	defer body.Close()
+
+	content, err := ioutil.ReadAll(body)
+
+	if err != nil {
+		return
+	}
+
+	return signSegments(store, r.PlaylistKey, string(content))
+}
+
+// Replace the relative segment paths of a playlist with signed urls
+func signSegments(store storage.Storage, playlistKey string, content string) (playlist string, err error) {
+	dir := path.Dir(playlistKey)
+	lines := strings.Split(content, "\n")
+
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+
+		if line == "" || strings.HasPrefix(line, "#") || strings.Contains(line, "://") {
+			continue
+		}
+
+		key := line
+
+		if dir != "." {
+			key = path.Join(dir, line)
+		}
+
+		if lines[i], err = store.PresignDownload(key, StreamURLExpiry); err != nil {
+			log.Printf("signSegments() key -> %v PresignDownload() Error -> %v", key, err)
+			return
+		}
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// Address of the master playlist served by the api
+func StreamURL(videoID uint64) string {
+	values := url.Values{}
+	values.Set("video_id", fmt.Sprint(videoID))
+
+	return APIBaseURL + StreamPath + values.Encode()
+}
+
+// Address of a rendition playlist served by the api
+func RenditionURL(videoID uint64, name string) string {
+	values := url.Values{}
+	values.Set("video_id", fmt.Sprint(videoID))
+	values.Set("rendition", name)
+
+	return APIBaseURL + StreamPath + values.Encode()
+}
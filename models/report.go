@@ -0,0 +1,693 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/rathvong/talentmob_server/system"
+)
+
+// Reasons a user can give when reporting content
+const (
+	ReportReasonSpam           = "spam"
+	ReportReasonHarassment     = "harassment"
+	ReportReasonHate           = "hate"
+	ReportReasonNudity         = "nudity"
+	ReportReasonViolence       = "violence"
+	ReportReasonCopyright      = "copyright"
+	ReportReasonImpersonation  = "impersonation"
+	ReportReasonOther          = "other"
+	MaxReportDetailsLength     = 500
+	DefaultReportHideThreshold = 5
+)
+
+// Status of a report in the moderation queue
+const (
+	ReportStatusPending  = "pending"
+	ReportStatusClaimed  = "claimed"
+	ReportStatusResolved = "resolved"
+)
+
+// Resolutions a moderator can apply to a report
+const (
+	ReportResolutionTakedown = "takedown"
+	ReportResolutionDismiss  = "dismiss"
+	ReportResolutionWarn     = "warn"
+)
+
+var (
+	ReportReasons     = []string{ReportReasonSpam, ReportReasonHarassment, ReportReasonHate, ReportReasonNudity, ReportReasonViolence, ReportReasonCopyright, ReportReasonImpersonation, ReportReasonOther}
+	ReportObjects     = []string{OBJECT_VIDEO, OBJECT_COMMENT, OBJECT_USER}
+	ReportResolutions = []string{ReportResolutionTakedown, ReportResolutionDismiss, ReportResolutionWarn}
+
+	// Number of open reports before a video or comment is hidden
+	// while it waits for a moderator. Set with REPORT_HIDE_THRESHOLD.
+	ReportHideThreshold = reportHideThreshold(os.Getenv("REPORT_HIDE_THRESHOLD"))
+
+	ErrorReportOwnContent = errors.New("you can not report your own content")
+	ErrorReportClaimed    = errors.New("report is claimed by another moderator")
+	ErrorReportResolved   = errors.New("report is already resolved")
+)
+
+// Users report videos, comments and profiles that break the
+// community guidelines. A user can only report the same object once.
+// Videos and comments are hidden once they collect ReportHideThreshold
+// open reports, profiles are never hidden automatically.
+// Moderators claim reports from the queue and resolve every open report
+// on the object at once, notifying each reporter and the owner.
+type Report struct {
+	BaseModel
+	ReporterID    uint64     `json:"reporter_id"`
+	OwnerID       uint64     `json:"owner_id"`
+	ObjectType    string     `json:"object_type"`
+	ObjectID      uint64     `json:"object_id"`
+	Reason        string     `json:"reason"`
+	Details       string     `json:"details"`
+	Status        string     `json:"status"`
+	Resolution    string     `json:"resolution"`
+	ModeratorID   uint64     `json:"moderator_id"`
+	ModeratorNote string     `json:"moderator_note"`
+	IsHidden      bool       `json:"is_hidden"`
+	ClaimedAt     *time.Time `json:"claimed_at"`
+	ResolvedAt    *time.Time `json:"resolved_at"`
+	ReportCount   int        `json:"report_count"`
+}
+
+func reportHideThreshold(value string) int {
+	threshold, err := strconv.Atoi(value)
+
+	if err != nil || threshold <= 0 {
+		return DefaultReportHideThreshold
+	}
+
+	return threshold
+}
+
+func (r *Report) queryCreate() (qry string) {
+	return `INSERT INTO reports
+						(reporter_id,
+						owner_id,
+						object_type,
+						object_id,
+						reason,
+						details,
+						status,
+						created_at,
+						updated_at)
+				VALUES
+						($1, $2, $3, $4, $5, $6, $7, $8, $9)
+				RETURNING id`
+}
+
+func (r *Report) queryExists() (qry string) {
+	return `SELECT EXISTS(SELECT 1 FROM reports WHERE reporter_id = $1 AND object_type = $2 AND object_id = $3)`
+}
+
+// SQL query to count the open reports on an object
+// and check if it has already been hidden
+func (r *Report) queryOpenCount() (qry string) {
+	return `SELECT	COUNT(*),
+					COALESCE(bool_or(hidden), false)
+			FROM reports
+			WHERE object_type = $1
+			AND object_id = $2
+			AND status != 'resolved'`
+}
+
+func (r *Report) queryMarkHidden() (qry string) {
+	return `UPDATE reports SET
+						hidden = $3,
+						updated_at = $4
+				WHERE object_type = $1
+				AND object_id = $2
+				AND status != 'resolved'`
+}
+
+// SQL query to claim a report, it will not take a report
+// from another moderator
+func (r *Report) queryClaim() (qry string) {
+	return `UPDATE reports SET
+						status = 'claimed',
+						moderator_id = $2,
+						claimed_at = $3,
+						updated_at = $3
+				WHERE id = $1
+				AND (status = 'pending' OR (status = 'claimed' AND moderator_id = $2))
+				RETURNING id`
+}
+
+// SQL query to resolve every open report on an object,
+// the reporters are returned so they can be notified
+func (r *Report) queryResolve() (qry string) {
+	return `UPDATE reports SET
+						status = 'resolved',
+						resolution = $3,
+						moderator_id = $4,
+						moderator_note = $5,
+						resolved_at = $6,
+						updated_at = $6
+				WHERE object_type = $1
+				AND object_id = $2
+				AND status != 'resolved'
+				RETURNING reporter_id`
+}
+
+// A video its owner moved to the trash stays there
+func (r *Report) queryUpdateVideoActive() (qry string) {
+	return `UPDATE videos SET
+						is_active = $2,
+						updated_at = $3
+				WHERE id = $1
+				AND deleted_at IS NULL`
+}
+
+func (r *Report) queryUpdateCommentActive() (qry string) {
+	return `UPDATE comments SET
+						is_active = $2,
+						updated_at = $3
+				WHERE id = $1`
+}
+
+func (r *Report) queryGet() (qry string) {
+	return `SELECT	reports.id,
+					reports.reporter_id,
+					reports.owner_id,
+					reports.object_type,
+					reports.object_id,
+					reports.reason,
+					reports.details,
+					reports.status,
+					reports.resolution,
+					COALESCE(reports.moderator_id, 0),
+					reports.moderator_note,
+					reports.hidden,
+					reports.claimed_at,
+					reports.resolved_at,
+					reports.created_at,
+					reports.updated_at,
+					(SELECT COUNT(*) FROM reports r WHERE r.object_type = reports.object_type AND r.object_id = reports.object_id AND r.status != 'resolved')
+			FROM reports
+			WHERE reports.id = $1`
+}
+
+// SQL query for the moderation queue, the most reported
+// objects are shown first
+func (r *Report) queryGetQueue() (qry string) {
+	return `SELECT	reports.id,
+					reports.reporter_id,
+					reports.owner_id,
+					reports.object_type,
+					reports.object_id,
+					reports.reason,
+					reports.details,
+					reports.status,
+					reports.resolution,
+					COALESCE(reports.moderator_id, 0),
+					reports.moderator_note,
+					reports.hidden,
+					reports.claimed_at,
+					reports.resolved_at,
+					reports.created_at,
+					reports.updated_at,
+					COUNT(*) OVER (PARTITION BY reports.object_type, reports.object_id) as report_count
+			FROM reports
+			WHERE reports.status = $1
+			ORDER BY report_count DESC, reports.created_at ASC, reports.id ASC
+			LIMIT $2
+			OFFSET $3`
+}
+
+func (r *Report) validateCreateErrors() (err error) {
+	if r.ReporterID == 0 {
+		return r.Errors(ErrorMissingValue, "reporter_id")
+	}
+
+	if r.ObjectID == 0 {
+		return r.Errors(ErrorMissingValue, "object_id")
+	}
+
+	if !containsString(ReportObjects, r.ObjectType) {
+		return r.Errors(ErrorIncorrectValue, "object_type")
+	}
+
+	if !containsString(ReportReasons, r.Reason) {
+		return r.Errors(ErrorIncorrectValue, "reason")
+	}
+
+	if len([]rune(r.Details)) > MaxReportDetailsLength {
+		return r.Errors(ErrorIncorrectValue, "details")
+	}
+
+	return
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Find the owner of the reported object
+func (r *Report) getOwner(db *system.DB) (ownerID uint64, err error) {
+
+	switch r.ObjectType {
+	case OBJECT_VIDEO:
+		var video Video
+
+		if err = video.GetVideoByID(db, r.ObjectID); err != nil {
+			return
+		}
+
+		if !video.IsActive {
+			return 0, sql.ErrNoRows
+		}
+
+		ownerID = video.UserID
+	case OBJECT_COMMENT:
+		var comment Comment
+
+		if err = comment.Get(db, r.ObjectID); err != nil {
+			return
+		}
+
+		if !comment.IsActive {
+			return 0, sql.ErrNoRows
+		}
+
+		ownerID = comment.UserID
+	case OBJECT_USER:
+		var user User
+
+		if err = user.Get(db, r.ObjectID); err != nil {
+			return
+		}
+
+		ownerID = user.ID
+	}
+
+	return
+}
+
+// Report an object. Hides the object once it collects enough
+// open reports.
+func (r *Report) Create(db *system.DB) (err error) {
+
+	if err = r.validateCreateErrors(); err != nil {
+		return
+	}
+
+	if r.OwnerID, err = r.getOwner(db); err != nil {
+		return r.Errors(ErrorIncorrectValue, "object_id")
+	}
+
+	if r.OwnerID == r.ReporterID {
+		return ErrorReportOwnContent
+	}
+
+	var exists bool
+
+	if err = db.QueryRow(r.queryExists(), r.ReporterID, r.ObjectType, r.ObjectID).Scan(&exists); err != nil {
+		log.Printf("Report.Create() QueryRow() -> %v Error -> %v", r.queryExists(), err)
+		return
+	}
+
+	if exists {
+		return r.Errors(ErrorExists, "report")
+	}
+
+	r.Status = ReportStatusPending
+	r.CreatedAt = time.Now()
+	r.UpdatedAt = time.Now()
+
+	err = db.QueryRow(r.queryCreate(),
+		r.ReporterID,
+		r.OwnerID,
+		r.ObjectType,
+		r.ObjectID,
+		r.Reason,
+		r.Details,
+		r.Status,
+		r.CreatedAt,
+		r.UpdatedAt,
+	).Scan(&r.ID)
+
+	if err != nil {
+		log.Printf("Report.Create() reporter_id -> %v QueryRow() -> %v Error -> %v", r.ReporterID, r.queryCreate(), err)
+		return
+	}
+
+	if err = r.hideIfOverThreshold(db); err != nil {
+		log.Println("Report.Create() hideIfOverThreshold() Error -> ", err)
+	}
+
+	return nil
+}
+
+// Hide a video or comment while it waits for a moderator
+func (r *Report) hideIfOverThreshold(db *system.DB) (err error) {
+
+	if r.ObjectType == OBJECT_USER {
+		return
+	}
+
+	var hidden bool
+
+	if err = db.QueryRow(r.queryOpenCount(), r.ObjectType, r.ObjectID).Scan(&r.ReportCount, &hidden); err != nil {
+		log.Printf("Report.hideIfOverThreshold() QueryRow() -> %v Error -> %v", r.queryOpenCount(), err)
+		return
+	}
+
+	if hidden || r.ReportCount < ReportHideThreshold {
+		r.IsHidden = hidden
+		return
+	}
+
+	tx, err := db.Begin()
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			tx.Rollback()
+			return
+		}
+
+		r.IsHidden = true
+
+		log.Printf("Report.hideIfOverThreshold() %v -> %v hidden after %v reports", r.ObjectType, r.ObjectID, r.ReportCount)
+	}()
+
+	if err != nil {
+		log.Println("Report.hideIfOverThreshold() Begin() -> ", err)
+		return
+	}
+
+	if err = r.setObjectActive(tx, false); err != nil {
+		return
+	}
+
+	if _, err = tx.Exec(r.queryMarkHidden(), r.ObjectType, r.ObjectID, true, time.Now()); err != nil {
+		log.Printf("Report.hideIfOverThreshold() Exec() -> %v Error -> %v", r.queryMarkHidden(), err)
+		return
+	}
+
+	return
+}
+
+// Hide or restore a reported video or comment
+func (r *Report) setObjectActive(tx *sql.Tx, active bool) (err error) {
+
+	var qry string
+
+	switch r.ObjectType {
+	case OBJECT_VIDEO:
+		qry = r.queryUpdateVideoActive()
+	case OBJECT_COMMENT:
+		qry = r.queryUpdateCommentActive()
+	default:
+		return
+	}
+
+	if _, err = tx.Exec(qry, r.ObjectID, active, time.Now()); err != nil {
+		log.Printf("Report.setObjectActive() Exec() -> %v Error -> %v", qry, err)
+	}
+
+	return
+}
+
+// Claim a report so other moderators know it is being reviewed
+func (r *Report) Claim(db *system.DB, moderatorID uint64) (err error) {
+
+	if r.ID == 0 {
+		return r.Errors(ErrorMissingID, "id")
+	}
+
+	if moderatorID == 0 {
+		return r.Errors(ErrorMissingValue, "moderator_id")
+	}
+
+	if r.Status == ReportStatusResolved {
+		return ErrorReportResolved
+	}
+
+	claimedAt := time.Now()
+
+	err = db.QueryRow(r.queryClaim(), r.ID, moderatorID, claimedAt).Scan(&r.ID)
+
+	if err == sql.ErrNoRows {
+		return ErrorReportClaimed
+	}
+
+	if err != nil {
+		log.Printf("Report.Claim() id -> %v QueryRow() -> %v Error -> %v", r.ID, r.queryClaim(), err)
+		return
+	}
+
+	r.Status = ReportStatusClaimed
+	r.ModeratorID = moderatorID
+	r.ClaimedAt = &claimedAt
+	r.UpdatedAt = claimedAt
+
+	return
+}
+
+// Resolve every open report on the reported object.
+// A takedown removes the object, or bans the owner of a reported
+// profile, a dismissal restores an object that was hidden
+// automatically and a warning leaves it in place with a warning
+// sanction recorded on the owner.
+// The reporters and the owner are notified of the outcome.
+func (r *Report) Resolve(db *system.DB, moderatorID uint64, resolution string, note string) (err error) {
+
+	if r.ID == 0 {
+		return r.Errors(ErrorMissingID, "id")
+	}
+
+	if moderatorID == 0 {
+		return r.Errors(ErrorMissingValue, "moderator_id")
+	}
+
+	if !containsString(ReportResolutions, resolution) {
+		return r.Errors(ErrorIncorrectValue, "resolution")
+	}
+
+	if r.Status == ReportStatusResolved {
+		return ErrorReportResolved
+	}
+
+	if r.Status == ReportStatusClaimed && r.ModeratorID != moderatorID {
+		return ErrorReportClaimed
+	}
+
+	var reporters []uint64
+
+	resolvedAt := time.Now()
+
+	tx, err := db.Begin()
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			tx.Rollback()
+			return
+		}
+
+		r.Status = ReportStatusResolved
+		r.Resolution = resolution
+		r.ModeratorID = moderatorID
+		r.ModeratorNote = note
+		r.ResolvedAt = &resolvedAt
+		r.UpdatedAt = resolvedAt
+
+		for _, reporterID := range reporters {
+			if err := Notify(db, moderatorID, reporterID, VERB_RESOLVED, r.ID, OBJECT_REPORT); err != nil {
+				log.Println("Report.Resolve() Notify() reporter Error -> ", err)
+			}
+		}
+
+		if resolution != ReportResolutionDismiss || r.IsHidden {
+			if err := Notify(db, moderatorID, r.OwnerID, VERB_RESOLVED, r.ID, OBJECT_REPORT); err != nil {
+				log.Println("Report.Resolve() Notify() owner Error -> ", err)
+			}
+		}
+	}()
+
+	if err != nil {
+		log.Println("Report.Resolve() Begin() -> ", err)
+		return
+	}
+
+	switch resolution {
+	case ReportResolutionTakedown:
+		if r.ObjectType == OBJECT_USER {
+			sanction := Sanction{UserID: r.OwnerID, ModeratorID: moderatorID, Type: SanctionBan, Reason: r.Reason}
+			err = sanction.createTx(tx)
+		} else {
+			err = r.setObjectActive(tx, false)
+		}
+	case ReportResolutionDismiss:
+		if r.IsHidden {
+			err = r.setObjectActive(tx, true)
+		}
+	case ReportResolutionWarn:
+		sanction := Sanction{UserID: r.OwnerID, ModeratorID: moderatorID, Type: SanctionWarning, Reason: r.Reason}
+		err = sanction.createTx(tx)
+	}
+
+	if err != nil {
+		return
+	}
+
+	rows, err := tx.Query(r.queryResolve(), r.ObjectType, r.ObjectID, resolution, moderatorID, note, resolvedAt)
+
+	if err != nil {
+		log.Printf("Report.Resolve() id -> %v Query() -> %v Error -> %v", r.ID, r.queryResolve(), err)
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var reporterID uint64
+
+		if err = rows.Scan(&reporterID); err != nil {
+			log.Println("Report.Resolve() Error -> ", err)
+			return
+		}
+
+		reporters = append(reporters, reporterID)
+	}
+
+	err = rows.Err()
+
+	return
+}
+
+// Message shown to a user receiving the outcome of a report
+func (r *Report) NotificationText(receiverID uint64) string {
+
+	object := r.ObjectType
+
+	if object == OBJECT_USER {
+		object = "profile"
+	}
+
+	if receiverID != r.OwnerID {
+		switch r.Resolution {
+		case ReportResolutionTakedown:
+			return "Thanks for your report, the " + object + " has been removed."
+		case ReportResolutionWarn:
+			return "Thanks for your report, the owner of the " + object + " has been warned."
+		default:
+			return "Thanks for your report, the " + object + " does not break our community guidelines."
+		}
+	}
+
+	switch r.Resolution {
+	case ReportResolutionTakedown:
+		return "Your " + object + " has been removed for " + r.Reason + "."
+	case ReportResolutionWarn:
+		return "You have received a warning for " + r.Reason + " on your " + object + "."
+	default:
+		return "Your " + object + " has been reviewed and restored."
+	}
+}
+
+// Retrieve a report by id
+func (r *Report) Get(db *system.DB, id uint64) (err error) {
+
+	if id == 0 {
+		return r.Errors(ErrorMissingID, "id")
+	}
+
+	err = db.QueryRow(r.queryGet(), id).Scan(
+		&r.ID,
+		&r.ReporterID,
+		&r.OwnerID,
+		&r.ObjectType,
+		&r.ObjectID,
+		&r.Reason,
+		&r.Details,
+		&r.Status,
+		&r.Resolution,
+		&r.ModeratorID,
+		&r.ModeratorNote,
+		&r.IsHidden,
+		&r.ClaimedAt,
+		&r.ResolvedAt,
+		&r.CreatedAt,
+		&r.UpdatedAt,
+		&r.ReportCount,
+	)
+
+	if err != nil {
+		log.Printf("Report.Get() id -> %v QueryRow() -> %v Error -> %v", id, r.queryGet(), err)
+	}
+
+	return
+}
+
+// Retrieve the moderation queue for a status
+func (r *Report) GetQueue(db *system.DB, status string, page int) (reports []Report, err error) {
+
+	if status == "" {
+		status = ReportStatusPending
+	}
+
+	rows, err := db.Query(r.queryGetQueue(), status, LimitQueryPerRequest, OffSet(page))
+
+	if err != nil {
+		log.Printf("Report.GetQueue() status -> %v Query() -> %v Error -> %v", status, r.queryGetQueue(), err)
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		report := Report{}
+
+		err = rows.Scan(
+			&report.ID,
+			&report.ReporterID,
+			&report.OwnerID,
+			&report.ObjectType,
+			&report.ObjectID,
+			&report.Reason,
+			&report.Details,
+			&report.Status,
+			&report.Resolution,
+			&report.ModeratorID,
+			&report.ModeratorNote,
+			&report.IsHidden,
+			&report.ClaimedAt,
+			&report.ResolvedAt,
+			&report.CreatedAt,
+			&report.UpdatedAt,
+			&report.ReportCount,
+		)
+
+		if err != nil {
+			log.Println("Report.GetQueue() Error -> ", err)
+			return
+		}
+
+		reports = append(reports, report)
+	}
+
+	return
+}
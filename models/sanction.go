@@ -0,0 +1,365 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	pq "github.com/lib/pq"
+	"github.com/rathvong/talentmob_server/system"
+)
+
+// Types of sanctions a moderator can place on a user
+const (
+	SanctionWarning          = "warning"
+	SanctionCommentMute      = "comment_mute"
+	SanctionUploadSuspension = "upload_suspension"
+	SanctionVotingSuspension = "voting_suspension"
+	SanctionShadowban        = "shadowban"
+	SanctionBan              = "ban"
+)
+
+var SanctionTypes = []string{SanctionWarning, SanctionCommentMute, SanctionUploadSuspension, SanctionVotingSuspension, SanctionShadowban, SanctionBan}
+
+var ErrorSanctionRevoked = errors.New("sanction is already revoked")
+
+// Sanctions replace deactivating a user for moderation.
+// Each sanction only blocks the actions of its type, a ban
+// is the only sanction that stops a user from logging in.
+// Content from a shadowbanned user is only visible to themselves.
+// A sanction without an expiry is permanent until it is revoked.
+type Sanction struct {
+	BaseModel
+	UserID      uint64     `json:"user_id"`
+	ModeratorID uint64     `json:"moderator_id"`
+	Type        string     `json:"type"`
+	Reason      string     `json:"reason"`
+	Hours       int        `json:"hours,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+}
+
+func (s *Sanction) queryCreate() (qry string) {
+	return `INSERT INTO sanctions
+						(user_id,
+						moderator_id,
+						sanction_type,
+						reason,
+						expires_at,
+						created_at,
+						updated_at)
+				VALUES
+						($1, NULLIF($2, 0), $3, $4, $5, $6, $7)
+				RETURNING id`
+}
+
+func (s *Sanction) queryRevoke() (qry string) {
+	return `UPDATE sanctions SET
+						revoked_at = $2,
+						updated_at = $2
+				WHERE id = $1
+				AND revoked_at IS NULL`
+}
+
+func (s *Sanction) queryGet() (qry string) {
+	return `SELECT	id,
+					user_id,
+					COALESCE(moderator_id, 0),
+					sanction_type,
+					reason,
+					expires_at,
+					revoked_at,
+					created_at,
+					updated_at
+			FROM sanctions
+			WHERE id = $1`
+}
+
+// SQL query for the first active sanction of the given types,
+// the one lasting the longest is returned
+func (s *Sanction) queryGetActive() (qry string) {
+	return `SELECT	id,
+					user_id,
+					COALESCE(moderator_id, 0),
+					sanction_type,
+					reason,
+					expires_at,
+					revoked_at,
+					created_at,
+					updated_at
+			FROM sanctions
+			WHERE user_id = $1
+			AND sanction_type = ANY($2)
+			AND revoked_at IS NULL
+			AND (expires_at IS NULL OR expires_at > now())
+			ORDER BY expires_at DESC NULLS FIRST
+			LIMIT 1`
+}
+
+func (s *Sanction) queryGetForUser() (qry string) {
+	return `SELECT	id,
+					user_id,
+					COALESCE(moderator_id, 0),
+					sanction_type,
+					reason,
+					expires_at,
+					revoked_at,
+					created_at,
+					updated_at
+			FROM sanctions
+			WHERE user_id = $1
+			ORDER BY created_at DESC, id DESC
+			LIMIT $2
+			OFFSET $3`
+}
+
+func (s *Sanction) validateCreateErrors() (err error) {
+	if s.UserID == 0 {
+		return s.Errors(ErrorMissingValue, "user_id")
+	}
+
+	if !containsString(SanctionTypes, s.Type) {
+		return s.Errors(ErrorIncorrectValue, "type")
+	}
+
+	if s.Reason == "" {
+		return s.Errors(ErrorMissingValue, "reason")
+	}
+
+	if s.Hours < 0 {
+		return s.Errors(ErrorIncorrectValue, "hours")
+	}
+
+	return
+}
+
+// Place a sanction on a user, Hours sets the expiry
+// and leaving it empty makes the sanction permanent
+func (s *Sanction) Create(db *system.DB) (err error) {
+
+	tx, err := db.Begin()
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			tx.Rollback()
+			return
+		}
+	}()
+
+	if err != nil {
+		log.Println("Sanction.Create() Begin() -> ", err)
+		return
+	}
+
+	return s.createTx(tx)
+}
+
+// Place a sanction as part of a larger transaction
+func (s *Sanction) createTx(tx *sql.Tx) (err error) {
+
+	if err = s.validateCreateErrors(); err != nil {
+		return
+	}
+
+	s.CreatedAt = time.Now()
+	s.UpdatedAt = time.Now()
+
+	if s.Hours > 0 {
+		expiresAt := s.CreatedAt.Add(time.Duration(s.Hours) * time.Hour)
+		s.ExpiresAt = &expiresAt
+	}
+
+	err = tx.QueryRow(s.queryCreate(),
+		s.UserID,
+		s.ModeratorID,
+		s.Type,
+		s.Reason,
+		s.ExpiresAt,
+		s.CreatedAt,
+		s.UpdatedAt,
+	).Scan(&s.ID)
+
+	if err != nil {
+		log.Printf("Sanction.createTx() user_id -> %v QueryRow() -> %v Error -> %v", s.UserID, s.queryCreate(), err)
+		return
+	}
+
+	return
+}
+
+// Lift a sanction before it expires
+func (s *Sanction) Revoke(db *system.DB) (err error) {
+
+	if s.ID == 0 {
+		return s.Errors(ErrorMissingID, "id")
+	}
+
+	if s.RevokedAt != nil {
+		return ErrorSanctionRevoked
+	}
+
+	revokedAt := time.Now()
+
+	if _, err = db.Exec(s.queryRevoke(), s.ID, revokedAt); err != nil {
+		log.Printf("Sanction.Revoke() id -> %v Exec() -> %v Error -> %v", s.ID, s.queryRevoke(), err)
+		return
+	}
+
+	s.RevokedAt = &revokedAt
+	s.UpdatedAt = revokedAt
+
+	return
+}
+
+// Retrieve a sanction by id
+func (s *Sanction) Get(db *system.DB, id uint64) (err error) {
+
+	if id == 0 {
+		return s.Errors(ErrorMissingID, "id")
+	}
+
+	err = db.QueryRow(s.queryGet(), id).Scan(
+		&s.ID,
+		&s.UserID,
+		&s.ModeratorID,
+		&s.Type,
+		&s.Reason,
+		&s.ExpiresAt,
+		&s.RevokedAt,
+		&s.CreatedAt,
+		&s.UpdatedAt,
+	)
+
+	if err != nil {
+		log.Printf("Sanction.Get() id -> %v QueryRow() -> %v Error -> %v", id, s.queryGet(), err)
+	}
+
+	return
+}
+
+// Retrieve the active sanction of any of the types for a user,
+// sql.ErrNoRows is returned when the user is not sanctioned
+func (s *Sanction) GetActive(db *system.DB, userID uint64, types ...string) (err error) {
+
+	if userID == 0 {
+		return s.Errors(ErrorMissingValue, "user_id")
+	}
+
+	err = db.QueryRow(s.queryGetActive(), userID, pq.Array(types)).Scan(
+		&s.ID,
+		&s.UserID,
+		&s.ModeratorID,
+		&s.Type,
+		&s.Reason,
+		&s.ExpiresAt,
+		&s.RevokedAt,
+		&s.CreatedAt,
+		&s.UpdatedAt,
+	)
+
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Sanction.GetActive() user_id -> %v QueryRow() -> %v Error -> %v", userID, s.queryGetActive(), err)
+	}
+
+	return
+}
+
+// Retrieve every sanction placed on a user, newest first
+func (s *Sanction) GetForUser(db *system.DB, userID uint64, page int) (sanctions []Sanction, err error) {
+
+	if userID == 0 {
+		return sanctions, s.Errors(ErrorMissingValue, "user_id")
+	}
+
+	rows, err := db.Query(s.queryGetForUser(), userID, LimitQueryPerRequest, OffSet(page))
+
+	if err != nil {
+		log.Printf("Sanction.GetForUser() user_id -> %v Query() -> %v Error -> %v", userID, s.queryGetForUser(), err)
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		sanction := Sanction{}
+
+		err = rows.Scan(
+			&sanction.ID,
+			&sanction.UserID,
+			&sanction.ModeratorID,
+			&sanction.Type,
+			&sanction.Reason,
+			&sanction.ExpiresAt,
+			&sanction.RevokedAt,
+			&sanction.CreatedAt,
+			&sanction.UpdatedAt,
+		)
+
+		if err != nil {
+			log.Println("Sanction.GetForUser() Error -> ", err)
+			return
+		}
+
+		sanctions = append(sanctions, sanction)
+	}
+
+	return
+}
+
+// Describe the sanction to the sanctioned user
+func (s *Sanction) NotificationText() string {
+	var text string
+
+	switch s.Type {
+	case SanctionWarning:
+		text = "You have received a warning"
+	case SanctionCommentMute:
+		text = "You have been muted from commenting"
+	case SanctionUploadSuspension:
+		text = "You have been suspended from uploading videos"
+	case SanctionVotingSuspension:
+		text = "You have been suspended from voting"
+	case SanctionShadowban:
+		text = "Your content has been limited"
+	case SanctionBan:
+		text = "Your account has been banned"
+	}
+
+	if s.ExpiresAt != nil && s.Type != SanctionWarning {
+		text += " until " + s.ExpiresAt.Format("Jan 2, 2006 3:04 PM MST")
+	}
+
+	return text + " for " + s.Reason + "."
+}
+
+// Check if a user is free to perform an action blocked by
+// the sanction types, the error explains the active sanction
+func CheckSanction(db *system.DB, userID uint64, types ...string) (err error) {
+	var sanction Sanction
+
+	err = sanction.GetActive(db, userID, types...)
+
+	if err == sql.ErrNoRows {
+		return nil
+	}
+
+	if err != nil {
+		return
+	}
+
+	return fmt.Errorf("%v", sanction.NotificationText())
+}
+
+// Check if a users content should be hidden from everyone else
+func IsShadowbanned(db *system.DB, userID uint64) bool {
+	var sanction Sanction
+
+	return sanction.GetActive(db, userID, SanctionShadowban) == nil
+}
@@ -0,0 +1,556 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/rathvong/talentmob_server/system"
+)
+
+// Channels a video can be shared through
+const (
+	ShareChannelLink      = "link"
+	ShareChannelSMS       = "sms"
+	ShareChannelEmail     = "email"
+	ShareChannelWhatsApp  = "whatsapp"
+	ShareChannelFacebook  = "facebook"
+	ShareChannelInstagram = "instagram"
+	ShareChannelTwitter   = "twitter"
+	ShareChannelOther     = "other"
+)
+
+var ShareChannels = []string{
+	ShareChannelLink,
+	ShareChannelSMS,
+	ShareChannelEmail,
+	ShareChannelWhatsApp,
+	ShareChannelFacebook,
+	ShareChannelInstagram,
+	ShareChannelTwitter,
+	ShareChannelOther,
+}
+
+const (
+	shareCodeLength            = 10
+	shareCodeCharacters        = "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	DefaultShareRewardPoints   = 250
+	DefaultShareLandingAddress = "https://www.talentmob.com/video"
+)
+
+var (
+	// Points awarded to a sharer when their link brings in
+	// a new user who casts a vote, set with SHARE_REWARD_POINTS
+	ShareRewardPoints = shareRewardPoints(os.Getenv("SHARE_REWARD_POINTS"))
+
+	// Page a share link redirects to, set with SHARE_LANDING_URL
+	ShareLandingAddress = shareLandingAddress(os.Getenv("SHARE_LANDING_URL"))
+
+	ErrorShareVideoUnavailable = errors.New("video is not available for sharing")
+)
+
+// Shares hold a short code minted for each user, video and channel.
+// Opening the link counts a click once per address, the first click on
+// a code adds to the videos shares. A new account signed up from the link
+// reports the code so it can be traced back to the share, the sharer is
+// awarded POINT_ACTIVITY_SHARED_USER once that user votes.
+type Share struct {
+	BaseModel
+	UserID   uint64 `json:"user_id"`
+	VideoID  uint64 `json:"video_id"`
+	Channel  string `json:"channel"`
+	Code     string `json:"code"`
+	Clicks   uint64 `json:"clicks"`
+	Installs uint64 `json:"installs"`
+	Rewards  uint64 `json:"rewards"`
+	URL      string `json:"url"`
+}
+
+func shareRewardPoints(value string) int64 {
+	points, err := strconv.ParseInt(value, 10, 64)
+
+	if err != nil || points < 0 {
+		return DefaultShareRewardPoints
+	}
+
+	return points
+}
+
+func shareLandingAddress(value string) string {
+	if value == "" {
+		return DefaultShareLandingAddress
+	}
+
+	return value
+}
+
+// Minting the same user, video and channel again returns
+// the code that was already handed out
+func (s *Share) queryCreate() (qry string) {
+	return `INSERT INTO shares
+						(user_id,
+						video_id,
+						channel,
+						code,
+						created_at,
+						updated_at)
+				VALUES
+						($1, $2, $3, $4, $5, $5)
+				ON CONFLICT (user_id, video_id, channel)
+				DO UPDATE SET updated_at = $5
+				RETURNING id, code, clicks, installs, rewards, created_at`
+}
+
+func (s *Share) queryCodeExists() (qry string) {
+	return `SELECT EXISTS(SELECT 1 FROM shares WHERE code = $1)`
+}
+
+func (s *Share) queryGetByCode() (qry string) {
+	return `SELECT	id,
+					user_id,
+					video_id,
+					channel,
+					clicks,
+					installs,
+					rewards
+			FROM shares
+			WHERE code = $1`
+}
+
+// SQL query to record the address a share link was opened from,
+// nothing is returned when the address has opened it before
+func (s *Share) queryCreateClick() (qry string) {
+	return `INSERT INTO share_clicks
+						(share_id,
+						ip_address,
+						created_at)
+				VALUES
+						($1, $2, $3)
+				ON CONFLICT (share_id, ip_address) DO NOTHING
+				RETURNING id`
+}
+
+// SQL query to count a click on a share link
+func (s *Share) queryClick() (qry string) {
+	return `UPDATE shares SET
+						clicks = clicks + 1,
+						updated_at = $2
+				WHERE id = $1
+				RETURNING clicks`
+}
+
+// A share is counted on the video once its link is first opened
+func (s *Share) queryAddShareToVideo() (qry string) {
+	return `UPDATE videos SET
+						shares = shares + 1
+				WHERE id = $1`
+}
+
+// SQL query to record a new account signed up from a share.
+// The account must be created after the code was minted, and the device
+// must not be used by another account. A device or an account is only
+// ever attributed to the first share it reported.
+func (s *Share) queryCreateInstall() (qry string) {
+	return `INSERT INTO share_installs
+						(share_id,
+						device_id,
+						user_id,
+						created_at,
+						updated_at)
+				SELECT shares.id, $2, users.id, $4, $4
+				FROM shares
+				INNER JOIN users
+				ON users.id = $3
+				AND users.created_at >= shares.created_at
+				WHERE shares.code = $1
+				AND shares.user_id != users.id
+				AND NOT EXISTS(SELECT 1 FROM apis WHERE device_id = $2 AND user_id != $3)
+				ON CONFLICT DO NOTHING
+				RETURNING share_id`
+}
+
+func (s *Share) queryAddInstall() (qry string) {
+	return `UPDATE shares SET
+						installs = installs + 1,
+						updated_at = $2
+				WHERE id = $1`
+}
+
+// SQL query to mark a share install as rewarded,
+// it will only update once so the sharer can not be paid twice
+func (s *Share) queryReward() (qry string) {
+	return `UPDATE share_installs SET
+						rewarded_at = $2,
+						updated_at = $2
+				FROM shares
+				WHERE share_installs.share_id = shares.id
+				AND share_installs.user_id = $1
+				AND share_installs.rewarded_at IS NULL
+				RETURNING shares.id, shares.user_id`
+}
+
+func (s *Share) queryAddReward() (qry string) {
+	return `UPDATE shares SET
+						rewards = rewards + 1,
+						updated_at = $2
+				WHERE id = $1`
+}
+
+// Same change as Point.AddPoints for POINT_ACTIVITY_SHARED_USER
+func (s *Share) queryAddSharerPoints() (qry string) {
+	return `UPDATE points SET
+						total = total + $2,
+						total_lifetime = total_lifetime + $2,
+						updated_at = $3
+				WHERE user_id = $1`
+}
+
+func (s *Share) queryGetForUser() (qry string) {
+	return `SELECT	id,
+					user_id,
+					video_id,
+					channel,
+					code,
+					clicks,
+					installs,
+					rewards,
+					created_at,
+					updated_at
+			FROM shares
+			WHERE user_id = $1
+			ORDER BY updated_at DESC, id DESC
+			LIMIT $2
+			OFFSET $3`
+}
+
+func (s *Share) validateCreateErrors() (err error) {
+	if s.UserID == 0 {
+		return s.Errors(ErrorMissingValue, "user_id")
+	}
+
+	if s.VideoID == 0 {
+		return s.Errors(ErrorMissingValue, "video_id")
+	}
+
+	if s.Channel == "" {
+		s.Channel = ShareChannelLink
+	}
+
+	if !containsString(ShareChannels, s.Channel) {
+		return s.Errors(ErrorIncorrectValue, "channel")
+	}
+
+	return
+}
+
+// Address of the public share link
+func (s *Share) buildURL() {
+	s.URL = "/s/" + s.Code
+}
+
+// Create a unique share code that is not used yet
+func (s *Share) generateCode(db *system.DB) (err error) {
+	rand.Seed(time.Now().UnixNano())
+
+	for i := 0; i < 5; i++ {
+		code := make([]byte, shareCodeLength)
+
+		for c := range code {
+			code[c] = shareCodeCharacters[rand.Intn(len(shareCodeCharacters))]
+		}
+
+		var exists bool
+
+		if err = db.QueryRow(s.queryCodeExists(), string(code)).Scan(&exists); err != nil {
+			log.Printf("Share.generateCode() QueryRow() -> %v Error -> %v", s.queryCodeExists(), err)
+			return
+		}
+
+		if !exists {
+			s.Code = string(code)
+			return
+		}
+	}
+
+	return s.Errors(ErrorExists, "code")
+}
+
+// Mint a share code for a user sharing a video through a channel.
+// The same code is returned every time the user shares the video
+// through that channel.
+func (s *Share) Create(db *system.DB) (err error) {
+
+	if err = s.validateCreateErrors(); err != nil {
+		log.Println("Share.Create() Error -> ", err)
+		return
+	}
+
+	video := Video{}
+
+	if err = video.GetVideoByID(db, s.VideoID); err != nil {
+		return s.Errors(ErrorIncorrectValue, "video_id")
+	}
+
+	if !video.IsActive || !video.IsPublished() {
+		return ErrorShareVideoUnavailable
+	}
+
+	if err = s.generateCode(db); err != nil {
+		return
+	}
+
+	s.UpdatedAt = time.Now()
+
+	err = db.QueryRow(s.queryCreate(),
+		s.UserID,
+		s.VideoID,
+		s.Channel,
+		s.Code,
+		s.UpdatedAt,
+	).Scan(&s.ID, &s.Code, &s.Clicks, &s.Installs, &s.Rewards, &s.CreatedAt)
+
+	if err != nil {
+		log.Printf("Share.Create() user_id -> %v video_id -> %v QueryRow() -> %v Error -> %v", s.UserID, s.VideoID, s.queryCreate(), err)
+		return
+	}
+
+	s.buildURL()
+
+	return
+}
+
+// Count a click on a share link once per address, the first
+// click on a code adds a share to the video
+func (s *Share) Click(db *system.DB, code string, ipAddress string) (err error) {
+
+	if code == "" {
+		return s.Errors(ErrorMissingValue, "code")
+	}
+
+	tx, err := db.Begin()
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			tx.Rollback()
+			return
+		}
+	}()
+
+	if err != nil {
+		log.Println("Share.Click() Begin() Error -> ", err)
+		return
+	}
+
+	s.Code = code
+
+	err = tx.QueryRow(s.queryGetByCode(), code).Scan(
+		&s.ID,
+		&s.UserID,
+		&s.VideoID,
+		&s.Channel,
+		&s.Clicks,
+		&s.Installs,
+		&s.Rewards,
+	)
+
+	if err != nil {
+		log.Printf("Share.Click() code -> %v QueryRow() -> %v Error -> %v", code, s.queryGetByCode(), err)
+		return
+	}
+
+	s.buildURL()
+
+	s.UpdatedAt = time.Now()
+
+	var clickID uint64
+
+	err = tx.QueryRow(s.queryCreateClick(), s.ID, ipAddress, s.UpdatedAt).Scan(&clickID)
+
+	switch {
+	case err == sql.ErrNoRows:
+		// the address has opened the link before
+		err = nil
+		return
+	case err != nil:
+		log.Printf("Share.Click() share_id -> %v QueryRow() -> %v Error -> %v", s.ID, s.queryCreateClick(), err)
+		return
+	}
+
+	if err = tx.QueryRow(s.queryClick(), s.ID, s.UpdatedAt).Scan(&s.Clicks); err != nil {
+		log.Printf("Share.Click() share_id -> %v QueryRow() -> %v Error -> %v", s.ID, s.queryClick(), err)
+		return
+	}
+
+	if s.Clicks == 1 {
+		if _, err = tx.Exec(s.queryAddShareToVideo(), s.VideoID); err != nil {
+			log.Printf("Share.Click() video_id -> %v Exec() -> %v Error -> %v", s.VideoID, s.queryAddShareToVideo(), err)
+			return
+		}
+	}
+
+	return
+}
+
+// Record a new account signed up from a share link, deviceID is
+// the device of the accounts session. Accounts older than the code,
+// devices used by other accounts and repeat reports are ignored.
+func (s *Share) Install(db *system.DB, code string, user User, deviceID string) (err error) {
+
+	if code == "" {
+		return s.Errors(ErrorMissingValue, "code")
+	}
+
+	if user.ID == 0 {
+		return s.Errors(ErrorMissingValue, "user_id")
+	}
+
+	if deviceID == "" {
+		return s.Errors(ErrorMissingValue, "device_id")
+	}
+
+	tx, err := db.Begin()
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			tx.Rollback()
+			return
+		}
+	}()
+
+	if err != nil {
+		log.Println("Share.Install() Begin() Error -> ", err)
+		return
+	}
+
+	now := time.Now()
+
+	var shareID uint64
+
+	err = tx.QueryRow(s.queryCreateInstall(), code, deviceID, user.ID, now).Scan(&shareID)
+
+	switch {
+	case err == sql.ErrNoRows:
+		// the account or device is not new or was already counted
+		err = nil
+		return
+	case err != nil:
+		log.Printf("Share.Install() code -> %v QueryRow() -> %v Error -> %v", code, s.queryCreateInstall(), err)
+		return
+	}
+
+	if _, err = tx.Exec(s.queryAddInstall(), shareID, now); err != nil {
+		log.Printf("Share.Install() share_id -> %v Exec() -> %v Error -> %v", shareID, s.queryAddInstall(), err)
+	}
+
+	return
+}
+
+// Retrieve the share codes a user has minted with their stats
+func (s *Share) GetForUser(db *system.DB, userID uint64, page int) (shares []Share, err error) {
+
+	if userID == 0 {
+		return shares, s.Errors(ErrorMissingValue, "user_id")
+	}
+
+	rows, err := db.Query(s.queryGetForUser(), userID, LimitQueryPerRequest, OffSet(page))
+
+	if err != nil {
+		log.Printf("Share.GetForUser() user_id -> %v Query() -> %v Error -> %v", userID, s.queryGetForUser(), err)
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		share := Share{}
+
+		err = rows.Scan(
+			&share.ID,
+			&share.UserID,
+			&share.VideoID,
+			&share.Channel,
+			&share.Code,
+			&share.Clicks,
+			&share.Installs,
+			&share.Rewards,
+			&share.CreatedAt,
+			&share.UpdatedAt,
+		)
+
+		if err != nil {
+			log.Println("Share.GetForUser() Error -> ", err)
+			return
+		}
+
+		share.buildURL()
+
+		shares = append(shares, share)
+	}
+
+	return
+}
+
+// Award the sharer once a user who signed up from their link votes.
+// It is safe to call many times as an install is only rewarded once.
+func ActivateShare(db *system.DB, userID uint64) {
+
+	if userID == 0 {
+		return
+	}
+
+	var s Share
+
+	tx, err := db.Begin()
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			tx.Rollback()
+			return
+		}
+
+		log.Printf("ActivateShare() share -> %v sharer_id -> %v rewarded", s.ID, s.UserID)
+	}()
+
+	if err != nil {
+		log.Println("ActivateShare() Begin() Error -> ", err)
+		return
+	}
+
+	now := time.Now()
+
+	if err = tx.QueryRow(s.queryReward(), userID, now).Scan(&s.ID, &s.UserID); err != nil {
+		// no share install waiting for this user
+		return
+	}
+
+	if _, err = tx.Exec(s.queryAddReward(), s.ID, now); err != nil {
+		log.Printf("ActivateShare() share_id -> %v Exec() -> %v Error -> %v", s.ID, s.queryAddReward(), err)
+		return
+	}
+
+	activity := POINT_ACTIVITY_SHARED_USER
+
+	if _, err = tx.Exec(s.queryAddSharerPoints(), s.UserID, activity.Value(), now); err != nil {
+		log.Printf("ActivateShare() user_id -> %v Exec() -> %v Error -> %v", s.UserID, s.queryAddSharerPoints(), err)
+		return
+	}
+}
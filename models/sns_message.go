@@ -0,0 +1,72 @@
+package models
+
+import (
+	"log"
+	"time"
+
+	"github.com/rathvong/talentmob_server/system"
+)
+
+// An SNS message that has been handled. SNS delivers a
+// message at least once, so a message id already stored is
+// a retry or a replay and is not processed again.
+type SNSMessage struct {
+	BaseModel
+	MessageID string `json:"message_id"`
+	TopicArn  string `json:"topic_arn"`
+	Type      string `json:"type"`
+}
+
+func (m *SNSMessage) queryCreate() (qry string) {
+	return `INSERT INTO sns_messages
+						(message_id,
+						topic_arn,
+						type,
+						created_at,
+						updated_at)
+				VALUES
+						($1, $2, $3, $4, $5)
+				ON CONFLICT (message_id) DO NOTHING`
+}
+
+func (m *SNSMessage) queryDelete() (qry string) {
+	return `DELETE FROM sns_messages WHERE message_id = $1`
+}
+
+// Store a message id, returns false when the
+// message has already been received
+func (m *SNSMessage) Create(db *system.DB) (created bool, err error) {
+
+	if m.MessageID == "" {
+		return false, m.Errors(ErrorMissingValue, "message_id")
+	}
+
+	m.CreatedAt = time.Now()
+	m.UpdatedAt = m.CreatedAt
+
+	res, err := db.Exec(m.queryCreate(), m.MessageID, m.TopicArn, m.Type, m.CreatedAt, m.UpdatedAt)
+
+	if err != nil {
+		log.Printf("SNSMessage.Create() message_id -> %v Exec() -> %v Error -> %v", m.MessageID, m.queryCreate(), err)
+		return
+	}
+
+	rows, err := res.RowsAffected()
+
+	return rows > 0, err
+}
+
+// Forget a message that could not be processed so
+// the retry sent by SNS is handled
+func (m *SNSMessage) Delete(db *system.DB) (err error) {
+
+	if m.MessageID == "" {
+		return m.Errors(ErrorMissingValue, "message_id")
+	}
+
+	if _, err = db.Exec(m.queryDelete(), m.MessageID); err != nil {
+		log.Printf("SNSMessage.Delete() message_id -> %v Exec() -> %v Error -> %v", m.MessageID, m.queryDelete(), err)
+	}
+
+	return
+}
@@ -0,0 +1,833 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/rathvong/talentmob_server/system"
+	"github.com/rathvong/talentmob_server/transcoder"
+)
+
+// States of a transcode job
+const (
+	TranscodeJobQueued      = "queued"
+	TranscodeJobSubmitted   = "submitted"
+	TranscodeJobProgressing = "progressing"
+	TranscodeJobCompleted   = "completed"
+	TranscodeJobError       = "error"
+)
+
+// Kinds of transcode jobs run for every video
+const (
+	TranscodeJobKindTranscode = "transcode"
+	TranscodeJobKindWatermark = "watermark"
+	TranscodeJobKindHLS       = "hls"
+)
+
+var TranscodeJobKinds = []string{TranscodeJobKindTranscode, TranscodeJobKindWatermark, TranscodeJobKindHLS}
+
+const (
+	TranscodeJobMaxAttempts = 5
+
+	// Failed jobs wait transcodeJobBackoff doubled for every
+	// attempt, up to transcodeJobMaxBackoff
+	transcodeJobBackoff    = 30 * time.Second
+	transcodeJobMaxBackoff = time.Hour
+
+	// Jobs not heard from in this long are polled for their status
+	transcodeJobPollAfter = 2 * time.Minute
+
+	// A claimed job is left alone by other workers for this long
+	// while it is submitted to the transcoder
+	transcodeJobClaimFor = 10 * time.Minute
+
+	// Jobs submitted or polled in one run of the worker
+	transcodeJobBatchSize = 20
+)
+
+// States a job can move to from each state. A failed
+// job is queued again until it runs out of attempts.
+var transcodeJobTransitions = map[string][]string{
+	TranscodeJobQueued:      {TranscodeJobSubmitted, TranscodeJobError},
+	TranscodeJobSubmitted:   {TranscodeJobProgressing, TranscodeJobCompleted, TranscodeJobError},
+	TranscodeJobProgressing: {TranscodeJobCompleted, TranscodeJobError},
+	TranscodeJobCompleted:   {},
+	TranscodeJobError:       {TranscodeJobQueued},
+}
+
+var ErrorTranscodeJobTransition = errors.New("transcode job can not move to this state")
+
+// A transcode job tracks one video through the transcoder.
+// Jobs are queued, submitted by the worker and followed until they
+// complete or fail. Transcoded is only written when a job moves to
+// submitted or completed so it always matches the job.
+type TranscodeJob struct {
+	BaseModel
+	VideoID          uint64     `json:"video_id"`
+	Kind             string     `json:"kind"`
+	State            string     `json:"state"`
+	ExternalID       string     `json:"external_id"`
+	InputKey         string     `json:"input_key"`
+	OutputKey        string     `json:"output_key"`
+	ThumbnailPattern string     `json:"thumbnail_pattern"`
+	Attempts         int        `json:"attempts"`
+	NextAttemptAt    time.Time  `json:"next_attempt_at"`
+	LastError        string     `json:"last_error"`
+	CompletedAt      *time.Time `json:"completed_at"`
+}
+
+const transcodeJobColumns = `id,
+					video_id,
+					kind,
+					state,
+					external_id,
+					input_key,
+					output_key,
+					thumbnail_pattern,
+					attempts,
+					next_attempt_at,
+					last_error,
+					completed_at,
+					created_at,
+					updated_at`
+
+// A video only has one open job of each kind
+func (j *TranscodeJob) queryCreate() (qry string) {
+	return `INSERT INTO transcode_jobs
+						(video_id,
+						kind,
+						state,
+						input_key,
+						output_key,
+						thumbnail_pattern,
+						next_attempt_at,
+						created_at,
+						updated_at)
+				VALUES
+						($1, $2, 'queued', $3, $4, $5, $6, $6, $6)
+				ON CONFLICT (video_id, kind) WHERE state NOT IN ('completed', 'error')
+				DO NOTHING
+				RETURNING id`
+}
+
+// SQL query to queue a job of a kind for every active video without an open one
+func (j *TranscodeJob) queryCreateForAllVideos() (qry string) {
+	return `INSERT INTO transcode_jobs
+						(video_id,
+						kind,
+						state,
+						input_key,
+						output_key,
+						thumbnail_pattern,
+						next_attempt_at,
+						created_at,
+						updated_at)
+				SELECT	id, $1, 'queued', key,
+						CASE WHEN $1 = 'hls' THEN 'hls/' || key || '/' ELSE key || '.mp4' END,
+						CASE WHEN $1 = 'hls' THEN '' ELSE key || '-{count}' END,
+						$2, $2, $2
+				FROM videos
+				WHERE is_active = true
+				ON CONFLICT (video_id, kind) WHERE state NOT IN ('completed', 'error')
+				DO NOTHING`
+}
+
+// Take the next due queued job, jobs locked by another worker are skipped
+func (j *TranscodeJob) queryNextQueued() (qry string) {
+	return `SELECT ` + transcodeJobColumns + `
+			FROM transcode_jobs
+			WHERE state = 'queued'
+			AND next_attempt_at <= $1
+			ORDER BY next_attempt_at ASC, id ASC
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED`
+}
+
+// Take the next open job that has not been heard from since $1
+func (j *TranscodeJob) queryNextStale() (qry string) {
+	return `SELECT ` + transcodeJobColumns + `
+			FROM transcode_jobs
+			WHERE state IN ('submitted', 'progressing')
+			AND updated_at <= $1
+			ORDER BY updated_at ASC, id ASC
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED`
+}
+
+// SQL query to claim a queued job while it is submitted,
+// other workers skip it until next_attempt_at passes
+func (j *TranscodeJob) queryClaim() (qry string) {
+	return `UPDATE transcode_jobs SET
+						attempts = $2,
+						next_attempt_at = $3,
+						updated_at = $4
+				WHERE id = $1`
+}
+
+func (j *TranscodeJob) queryGetForUpdate() (qry string) {
+	return `SELECT ` + transcodeJobColumns + `
+			FROM transcode_jobs
+			WHERE id = $1
+			FOR UPDATE`
+}
+
+// Mark an open job as heard from so it is polled again later
+func (j *TranscodeJob) queryTouch() (qry string) {
+	return `UPDATE transcode_jobs SET
+						updated_at = $2
+				WHERE id = $1`
+}
+
+func (j *TranscodeJob) queryGetByExternalIDForUpdate() (qry string) {
+	return `SELECT ` + transcodeJobColumns + `
+			FROM transcode_jobs
+			WHERE external_id = $1
+			FOR UPDATE`
+}
+
+func (j *TranscodeJob) queryGetForVideo() (qry string) {
+	return `SELECT ` + transcodeJobColumns + `
+			FROM transcode_jobs
+			WHERE video_id = $1
+			ORDER BY id DESC`
+}
+
+func (j *TranscodeJob) queryUpdate() (qry string) {
+	return `UPDATE transcode_jobs SET
+						state = $2,
+						external_id = $3,
+						attempts = $4,
+						next_attempt_at = $5,
+						last_error = $6,
+						completed_at = $7,
+						updated_at = $8
+				WHERE id = $1`
+}
+
+func (j *TranscodeJob) queryUpdateTranscodedKeys() (qry string) {
+	return `UPDATE transcoded SET
+						transcoded_watermark_key = $2,
+						transcoded_key = $2,
+						transcoded_thumbnail_key = $3,
+						updated_at = $4
+				WHERE video_id = $1`
+}
+
+func (j *TranscodeJob) queryCreateTranscoded() (qry string) {
+	return `INSERT INTO transcoded
+						(video_id,
+						transcoded_watermark_key,
+						transcoded_key,
+						transcoded_thumbnail_key,
+						completed_transcode_watermark,
+						completed_transcode,
+						is_active,
+						created_at,
+						updated_at)
+				VALUES
+						($1, $2, $2, $3, false, false, true, $4, $4)`
+}
+
+func (j *TranscodeJob) queryCompleteTranscode() (qry string) {
+	return `UPDATE transcoded SET
+						completed_transcode = true,
+						updated_at = $2
+				WHERE video_id = $1`
+}
+
+func (j *TranscodeJob) queryCompleteWatermark() (qry string) {
+	return `UPDATE transcoded SET
+						completed_transcode_watermark = true,
+						updated_at = $2
+				WHERE video_id = $1`
+}
+
+func (j *TranscodeJob) scan(row interface {
+	Scan(dest ...interface{}) error
+}) error {
+	return row.Scan(
+		&j.ID,
+		&j.VideoID,
+		&j.Kind,
+		&j.State,
+		&j.ExternalID,
+		&j.InputKey,
+		&j.OutputKey,
+		&j.ThumbnailPattern,
+		&j.Attempts,
+		&j.NextAttemptAt,
+		&j.LastError,
+		&j.CompletedAt,
+		&j.CreatedAt,
+		&j.UpdatedAt,
+	)
+}
+
+// Check a job can move to a state
+func (j *TranscodeJob) canMoveTo(state string) bool {
+	return containsString(transcodeJobTransitions[j.State], state)
+}
+
+// Wait before the next attempt, doubled for every failed attempt
+func transcodeJobBackoffFor(attempts int) time.Duration {
+	backoff := transcodeJobBackoff
+
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+
+		if backoff >= transcodeJobMaxBackoff {
+			return transcodeJobMaxBackoff
+		}
+	}
+
+	return backoff
+}
+
+// HLS jobs write their renditions under a prefix and no thumbnails
+func (j *TranscodeJob) setOutputKeys() {
+	if j.Kind == TranscodeJobKindHLS {
+		j.OutputKey = "hls/" + j.InputKey + "/"
+		j.ThumbnailPattern = ""
+		return
+	}
+
+	j.OutputKey = j.InputKey + ".mp4"
+	j.ThumbnailPattern = j.InputKey + "-{count}"
+}
+
+// Settings sent to the transcoder for this job
+func (j *TranscodeJob) transcoderJob() transcoder.Job {
+	return transcoder.Job{
+		InputKey:         j.InputKey,
+		OutputKey:        j.OutputKey,
+		ThumbnailPattern: j.ThumbnailPattern,
+		Watermark:        j.Kind == TranscodeJobKindWatermark,
+		HLS:              j.Kind == TranscodeJobKindHLS,
+	}
+}
+
+// Queue a job of a kind for a video, nothing is queued
+// when the video already has an open job of that kind
+func (j *TranscodeJob) Create(db *system.DB) (err error) {
+
+	if j.VideoID == 0 {
+		return j.Errors(ErrorMissingValue, "video_id")
+	}
+
+	if !containsString(TranscodeJobKinds, j.Kind) {
+		return j.Errors(ErrorIncorrectValue, "kind")
+	}
+
+	if j.InputKey == "" {
+		return j.Errors(ErrorMissingValue, "input_key")
+	}
+
+	j.State = TranscodeJobQueued
+	j.setOutputKeys()
+	j.CreatedAt = time.Now()
+	j.UpdatedAt = j.CreatedAt
+	j.NextAttemptAt = j.CreatedAt
+
+	err = db.QueryRow(j.queryCreate(),
+		j.VideoID,
+		j.Kind,
+		j.InputKey,
+		j.OutputKey,
+		j.ThumbnailPattern,
+		j.CreatedAt,
+	).Scan(&j.ID)
+
+	if err == sql.ErrNoRows {
+		// already queued or running
+		return nil
+	}
+
+	if err != nil {
+		log.Printf("TranscodeJob.Create() video_id -> %v QueryRow() -> %v Error -> %v", j.VideoID, j.queryCreate(), err)
+	}
+
+	return
+}
+
+// Save a move to a new state. A completed job marks its
+// kind as done on Transcoded, a submitted job makes sure
+// Transcoded holds the keys the transcoder writes to.
+func (j *TranscodeJob) transition(tx *sql.Tx, state string, detail string) (err error) {
+
+	if j.State == state {
+		return
+	}
+
+	if !j.canMoveTo(state) {
+		log.Printf("TranscodeJob.transition() id -> %v from -> %v to -> %v", j.ID, j.State, state)
+		return ErrorTranscodeJobTransition
+	}
+
+	now := time.Now()
+
+	switch state {
+	case TranscodeJobError:
+		j.LastError = detail
+
+		// failed jobs are retried until they run out of attempts
+		if j.Attempts < TranscodeJobMaxAttempts {
+			state = TranscodeJobQueued
+			j.ExternalID = ""
+			j.NextAttemptAt = now.Add(transcodeJobBackoffFor(j.Attempts))
+		}
+	case TranscodeJobCompleted:
+		j.CompletedAt = &now
+	}
+
+	j.State = state
+	j.UpdatedAt = now
+
+	_, err = tx.Exec(j.queryUpdate(),
+		j.ID,
+		j.State,
+		j.ExternalID,
+		j.Attempts,
+		j.NextAttemptAt,
+		j.LastError,
+		j.CompletedAt,
+		j.UpdatedAt,
+	)
+
+	if err != nil {
+		log.Printf("TranscodeJob.transition() id -> %v Exec() -> %v Error -> %v", j.ID, j.queryUpdate(), err)
+		return
+	}
+
+	if j.Kind == TranscodeJobKindHLS {
+		if j.State == TranscodeJobCompleted {
+			return saveRenditions(tx, j.VideoID, j.OutputKey, now)
+		}
+
+		return
+	}
+
+	switch j.State {
+	case TranscodeJobSubmitted:
+		return j.saveTranscodedKeys(tx, now)
+	case TranscodeJobCompleted:
+		qry := j.queryCompleteTranscode()
+
+		if j.Kind == TranscodeJobKindWatermark {
+			qry = j.queryCompleteWatermark()
+		}
+
+		if _, err = tx.Exec(qry, j.VideoID, now); err != nil {
+			log.Printf("TranscodeJob.transition() video_id -> %v Exec() -> %v Error -> %v", j.VideoID, qry, err)
+		}
+	}
+
+	return
+}
+
+func (j *TranscodeJob) saveTranscodedKeys(tx *sql.Tx, now time.Time) (err error) {
+	res, err := tx.Exec(j.queryUpdateTranscodedKeys(), j.VideoID, j.OutputKey, j.ThumbnailPattern, now)
+
+	if err != nil {
+		log.Printf("TranscodeJob.saveTranscodedKeys() video_id -> %v Exec() -> %v Error -> %v", j.VideoID, j.queryUpdateTranscodedKeys(), err)
+		return
+	}
+
+	if updated, _ := res.RowsAffected(); updated > 0 {
+		return
+	}
+
+	if _, err = tx.Exec(j.queryCreateTranscoded(), j.VideoID, j.OutputKey, j.ThumbnailPattern, now); err != nil {
+		log.Printf("TranscodeJob.saveTranscodedKeys() video_id -> %v Exec() -> %v Error -> %v", j.VideoID, j.queryCreateTranscoded(), err)
+	}
+
+	return
+}
+
+// Submit the next due queued job. The job is claimed and committed
+// before it is sent to the transcoder so no lock is held while waiting
+// on the service. Returns false when there was nothing to submit.
+func (j *TranscodeJob) submitNext(db *system.DB, t transcoder.Transcoder) (found bool, err error) {
+
+	if found, err = j.claimNext(db); !found || err != nil {
+		return
+	}
+
+	externalID, submitErr := t.Submit(j.transcoderJob())
+
+	if submitErr != nil {
+		log.Printf("TranscodeJob.submitNext() id -> %v Submit() Error -> %v", j.ID, submitErr)
+	}
+
+	err = j.saveSubmit(db, externalID, submitErr)
+
+	return
+}
+
+// Claim the next due queued job and count the attempt
+func (j *TranscodeJob) claimNext(db *system.DB) (found bool, err error) {
+
+	tx, err := db.Begin()
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			tx.Rollback()
+			return
+		}
+	}()
+
+	if err != nil {
+		log.Println("TranscodeJob.claimNext() Begin() Error -> ", err)
+		return
+	}
+
+	now := time.Now()
+
+	if err = j.scan(tx.QueryRow(j.queryNextQueued(), now)); err != nil {
+		if err == sql.ErrNoRows {
+			err = nil
+			return
+		}
+
+		log.Printf("TranscodeJob.claimNext() QueryRow() -> %v Error -> %v", j.queryNextQueued(), err)
+		return
+	}
+
+	found = true
+
+	j.Attempts++
+	j.NextAttemptAt = now.Add(transcodeJobClaimFor)
+	j.UpdatedAt = now
+
+	if _, err = tx.Exec(j.queryClaim(), j.ID, j.Attempts, j.NextAttemptAt, j.UpdatedAt); err != nil {
+		log.Printf("TranscodeJob.claimNext() id -> %v Exec() -> %v Error -> %v", j.ID, j.queryClaim(), err)
+	}
+
+	return
+}
+
+// Save the outcome of submitting a claimed job. Nothing is saved
+// when the claim ran out and another worker took the job.
+func (j *TranscodeJob) saveSubmit(db *system.DB, externalID string, submitErr error) (err error) {
+
+	tx, err := db.Begin()
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			tx.Rollback()
+			return
+		}
+
+		j.notifyCreator(db)
+	}()
+
+	if err != nil {
+		log.Println("TranscodeJob.saveSubmit() Begin() Error -> ", err)
+		return
+	}
+
+	attempts := j.Attempts
+
+	if err = j.scan(tx.QueryRow(j.queryGetForUpdate(), j.ID)); err != nil {
+		log.Printf("TranscodeJob.saveSubmit() id -> %v QueryRow() -> %v Error -> %v", j.ID, j.queryGetForUpdate(), err)
+		return
+	}
+
+	if j.State != TranscodeJobQueued || j.Attempts != attempts {
+		log.Printf("TranscodeJob.saveSubmit() id -> %v claim lost, external_id -> %v", j.ID, externalID)
+		return
+	}
+
+	if submitErr != nil {
+		return j.transition(tx, TranscodeJobError, submitErr.Error())
+	}
+
+	j.ExternalID = externalID
+
+	return j.transition(tx, TranscodeJobSubmitted, "")
+}
+
+// Ask the transcoder about the open job that has gone the longest
+// without an update. The job is marked as polled and committed before
+// the transcoder is asked so no lock is held while waiting on the
+// service. Errors reaching the transcoder and states the job can not
+// move to are logged and the job is polled again later.
+// Returns false when there was nothing to poll.
+func (j *TranscodeJob) pollNext(db *system.DB, t transcoder.Transcoder) (found bool, err error) {
+
+	if found, err = j.claimStale(db); !found || err != nil {
+		return
+	}
+
+	status, statusErr := t.Status(j.ExternalID)
+
+	switch {
+	case statusErr == transcoder.ErrorUnknownJob:
+		// the transcoder lost the job, it is submitted again
+		status = transcoder.Status{State: transcoder.StateError, Detail: statusErr.Error()}
+	case statusErr != nil:
+		log.Printf("TranscodeJob.pollNext() id -> %v Status() Error -> %v", j.ID, statusErr)
+		return
+	case status.State != j.State && !j.canMoveTo(status.State):
+		log.Printf("TranscodeJob.pollNext() id -> %v state -> %v ignored status -> %v", j.ID, j.State, status.State)
+		return
+	}
+
+	err = j.savePoll(db, status)
+
+	return
+}
+
+// Claim the open job that has gone the longest without an update,
+// touching it keeps other workers from polling it at the same time
+func (j *TranscodeJob) claimStale(db *system.DB) (found bool, err error) {
+
+	tx, err := db.Begin()
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			tx.Rollback()
+			return
+		}
+	}()
+
+	if err != nil {
+		log.Println("TranscodeJob.claimStale() Begin() Error -> ", err)
+		return
+	}
+
+	if err = j.scan(tx.QueryRow(j.queryNextStale(), time.Now().Add(-transcodeJobPollAfter))); err != nil {
+		if err == sql.ErrNoRows {
+			err = nil
+			return
+		}
+
+		log.Printf("TranscodeJob.claimStale() QueryRow() -> %v Error -> %v", j.queryNextStale(), err)
+		return
+	}
+
+	found = true
+
+	err = j.touch(tx)
+
+	return
+}
+
+// Save the status of a polled job. Nothing is saved when the job
+// moved on while the transcoder was asked, a notification from the
+// transcoder may have already updated it.
+func (j *TranscodeJob) savePoll(db *system.DB, status transcoder.Status) (err error) {
+
+	tx, err := db.Begin()
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			tx.Rollback()
+			return
+		}
+
+		j.notifyCreator(db)
+	}()
+
+	if err != nil {
+		log.Println("TranscodeJob.savePoll() Begin() Error -> ", err)
+		return
+	}
+
+	state, externalID := j.State, j.ExternalID
+
+	if err = j.scan(tx.QueryRow(j.queryGetForUpdate(), j.ID)); err != nil {
+		log.Printf("TranscodeJob.savePoll() id -> %v QueryRow() -> %v Error -> %v", j.ID, j.queryGetForUpdate(), err)
+		return
+	}
+
+	if j.State != state || j.ExternalID != externalID {
+		log.Printf("TranscodeJob.savePoll() id -> %v moved to -> %v while polled", j.ID, j.State)
+		return
+	}
+
+	err = j.applyStatus(tx, status)
+
+	return
+}
+
+// Push back the next poll of an open job
+func (j *TranscodeJob) touch(tx *sql.Tx) (err error) {
+	j.UpdatedAt = time.Now()
+
+	if _, err = tx.Exec(j.queryTouch(), j.ID, j.UpdatedAt); err != nil {
+		log.Printf("TranscodeJob.touch() id -> %v Exec() -> %v Error -> %v", j.ID, j.queryTouch(), err)
+	}
+
+	return
+}
+
+// Move the job to the state reported by the transcoder
+func (j *TranscodeJob) applyStatus(tx *sql.Tx, status transcoder.Status) (err error) {
+
+	if status.State == j.State {
+		// still running, poll again later
+		return j.touch(tx)
+	}
+
+	if err = j.transition(tx, status.State, status.Detail); err != nil {
+		return
+	}
+
+	if j.State == TranscodeJobCompleted && status.Duration > 0 {
+		video := Video{}
+		video.ID = j.VideoID
+
+		err = video.SetDuration(tx, float64(status.Duration))
+	}
+
+	return
+}
+
+// Apply a status pushed by the transcoder for one of its jobs
+func ApplyTranscodeStatus(db *system.DB, externalID string, status transcoder.Status) (job TranscodeJob, err error) {
+
+	if externalID == "" {
+		return job, job.Errors(ErrorMissingValue, "external_id")
+	}
+
+	tx, err := db.Begin()
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			tx.Rollback()
+			return
+		}
+
+		job.notifyCreator(db)
+	}()
+
+	if err != nil {
+		log.Println("ApplyTranscodeStatus() Begin() Error -> ", err)
+		return
+	}
+
+	if err = job.scan(tx.QueryRow(job.queryGetByExternalIDForUpdate(), externalID)); err != nil {
+		log.Printf("ApplyTranscodeStatus() external_id -> %v QueryRow() -> %v Error -> %v", externalID, job.queryGetByExternalIDForUpdate(), err)
+		return
+	}
+
+	err = job.applyStatus(tx, status)
+
+	return
+}
+
+// Queue both transcode jobs for a video
+func QueueTranscodeJobs(db *system.DB, video Video) (err error) {
+	for _, kind := range TranscodeJobKinds {
+		job := TranscodeJob{VideoID: video.ID, Kind: kind, InputKey: video.Key}
+
+		if err = job.Create(db); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// Queue a job of a kind for every active video
+func QueueTranscodeJobsForAllVideos(db *system.DB, kind string) (err error) {
+	var j TranscodeJob
+
+	if !containsString(TranscodeJobKinds, kind) {
+		return j.Errors(ErrorIncorrectValue, "kind")
+	}
+
+	if _, err = db.Exec(j.queryCreateForAllVideos(), kind, time.Now()); err != nil {
+		log.Printf("QueueTranscodeJobsForAllVideos() kind -> %v Exec() -> %v Error -> %v", kind, j.queryCreateForAllVideos(), err)
+	}
+
+	return
+}
+
+// Retrieve every job run for a video, newest first
+func (j *TranscodeJob) GetForVideo(db *system.DB, videoID uint64) (jobs []TranscodeJob, err error) {
+
+	if videoID == 0 {
+		return jobs, j.Errors(ErrorMissingValue, "video_id")
+	}
+
+	rows, err := db.Query(j.queryGetForVideo(), videoID)
+
+	if err != nil {
+		log.Printf("TranscodeJob.GetForVideo() video_id -> %v Query() -> %v Error -> %v", videoID, j.queryGetForVideo(), err)
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		job := TranscodeJob{}
+
+		if err = job.scan(rows); err != nil {
+			log.Println("TranscodeJob.GetForVideo() Error -> ", err)
+			return
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return
+}
+
+// Submit due jobs and poll the ones that have gone quiet,
+// run by the worker on an interval
+func ProcessTranscodeJobs(db *system.DB, t transcoder.Transcoder) (err error) {
+
+	if t == nil {
+		return errors.New("transcoder is not set")
+	}
+
+	found := true
+
+	for i := 0; i < transcodeJobBatchSize && found; i++ {
+		var job TranscodeJob
+
+		if found, err = job.submitNext(db, t); err != nil {
+			return
+		}
+	}
+
+	found = true
+
+	for i := 0; i < transcodeJobBatchSize && found; i++ {
+		var job TranscodeJob
+
+		if found, err = job.pollNext(db, t); err != nil {
+			return
+		}
+	}
+
+	return
+}
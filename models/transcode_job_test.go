@@ -0,0 +1,61 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTranscodeJob_CanMoveTo(t *testing.T) {
+	tests := []struct {
+		from string
+		to   string
+		want bool
+	}{
+		{TranscodeJobQueued, TranscodeJobSubmitted, true},
+		{TranscodeJobQueued, TranscodeJobError, true},
+		{TranscodeJobQueued, TranscodeJobProgressing, false},
+		{TranscodeJobQueued, TranscodeJobCompleted, false},
+		{TranscodeJobSubmitted, TranscodeJobProgressing, true},
+		{TranscodeJobSubmitted, TranscodeJobCompleted, true},
+		{TranscodeJobSubmitted, TranscodeJobError, true},
+		{TranscodeJobSubmitted, TranscodeJobQueued, false},
+		{TranscodeJobProgressing, TranscodeJobCompleted, true},
+		{TranscodeJobProgressing, TranscodeJobError, true},
+		{TranscodeJobProgressing, TranscodeJobSubmitted, false},
+		{TranscodeJobCompleted, TranscodeJobError, false},
+		{TranscodeJobCompleted, TranscodeJobQueued, false},
+		{TranscodeJobError, TranscodeJobQueued, true},
+		{TranscodeJobError, TranscodeJobSubmitted, false},
+		{"unknown", TranscodeJobQueued, false},
+	}
+
+	for _, test := range tests {
+		job := TranscodeJob{State: test.from}
+
+		if got := job.canMoveTo(test.to); got != test.want {
+			t.Errorf("%v -> %v = %v, want %v", test.from, test.to, got, test.want)
+		}
+	}
+}
+
+func TestTranscodeJobBackoffFor(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{5, 8 * time.Minute},
+		{7, 32 * time.Minute},
+		{8, time.Hour},
+		{20, time.Hour},
+	}
+
+	for _, test := range tests {
+		if got := transcodeJobBackoffFor(test.attempts); got != test.want {
+			t.Errorf("attempts %v = %v, want %v", test.attempts, got, test.want)
+		}
+	}
+}
@@ -228,7 +228,7 @@ func (t *Transcoded) GetByTranscodedKey(db *system.DB, key string) error {
 		log.Printf("Transcoded.GetByTranscodedKey() key: %s sql: %s error: %v", key, t.queryByTranscodedKey(), err)
 	}
 
-	return nil
+	return err
 }
 
 func (t *Transcoded) Update(db *system.DB) error {
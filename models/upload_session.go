@@ -0,0 +1,415 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rathvong/talentmob_server/storage"
+	"github.com/rathvong/talentmob_server/system"
+)
+
+// States of an upload session
+const (
+	UploadSessionOpen      = "open"
+	UploadSessionFinalized = "finalized"
+)
+
+// How long a session can be finalized for after it is opened
+const UploadSessionExpiry = time.Hour
+
+var (
+	// Largest video in bytes, set with UPLOAD_MAX_VIDEO_BYTES
+	UploadMaxVideoBytes = uploadLimit("UPLOAD_MAX_VIDEO_BYTES", 200<<20)
+
+	// Largest thumbnail in bytes, set with UPLOAD_MAX_THUMBNAIL_BYTES
+	UploadMaxThumbnailBytes = uploadLimit("UPLOAD_MAX_THUMBNAIL_BYTES", 5<<20)
+
+	// Longest video in seconds, set with UPLOAD_MAX_DURATION_SECONDS
+	UploadMaxDurationSeconds = uploadLimit("UPLOAD_MAX_DURATION_SECONDS", 120)
+)
+
+var (
+	ErrorUploadSessionExpired   = errors.New("upload session has expired")
+	ErrorUploadSessionFinalized = errors.New("upload session has already been finalized")
+	ErrorUploadMissing          = errors.New("uploaded file could not be found")
+	ErrorUploadMismatch         = errors.New("uploaded file does not match the upload session")
+	ErrorUploadKeyTaken         = errors.New("key belongs to another upload")
+	ErrorUploadKeyNotOwned      = errors.New("key does not belong to one of your uploads")
+)
+
+func uploadLimit(key string, value int64) int64 {
+	if limit, err := strconv.ParseInt(os.Getenv(key), 10, 64); err == nil && limit > 0 {
+		return limit
+	}
+
+	return value
+}
+
+// An upload session is a ticket for one video. The client declares
+// the files it is going to upload, uploads them to the presigned urls
+// and finalizes the session with the video details. The video is only
+// created once the files in storage match the ticket.
+type UploadSession struct {
+	BaseModel
+	UserID               uint64    `json:"user_id"`
+	Status               string    `json:"status"`
+	VideoKey             string    `json:"video_key"`
+	VideoContentType     string    `json:"video_content_type"`
+	VideoSize            int64     `json:"video_size"`
+	ThumbnailKey         string    `json:"thumbnail_key"`
+	ThumbnailContentType string    `json:"thumbnail_content_type"`
+	ThumbnailSize        int64     `json:"thumbnail_size"`
+	Duration             float64   `json:"duration"`
+	VideoID              uint64    `json:"video_id"`
+	ExpiresAt            time.Time `json:"expires_at"`
+	VideoUploadURL       UploadURL `json:"video_upload_url"`
+	ThumbnailUploadURL   UploadURL `json:"thumbnail_upload_url"`
+}
+
+func (u *UploadSession) queryCreate() (qry string) {
+	return `INSERT INTO upload_sessions
+						(user_id,
+						status,
+						video_key,
+						video_content_type,
+						video_size,
+						thumbnail_key,
+						thumbnail_content_type,
+						thumbnail_size,
+						duration,
+						expires_at,
+						created_at,
+						updated_at)
+				VALUES
+						($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+				RETURNING id`
+}
+
+// Lock the session so it can only be finalized once
+func (u *UploadSession) queryGetForUpdate() (qry string) {
+	return `SELECT	id,
+					user_id,
+					status,
+					video_key,
+					video_content_type,
+					video_size,
+					thumbnail_key,
+					thumbnail_content_type,
+					thumbnail_size,
+					duration,
+					COALESCE(video_id, 0),
+					expires_at,
+					created_at,
+					updated_at
+			FROM upload_sessions
+			WHERE id = $1
+			FOR UPDATE`
+}
+
+func (u *UploadSession) queryFinalize() (qry string) {
+	return `UPDATE upload_sessions SET
+						status = $2,
+						video_id = $3,
+						updated_at = $4
+				WHERE id = $1`
+}
+
+// SQL query for the session a video or thumbnail key was issued to
+func (u *UploadSession) queryGetByKey() (qry string) {
+	return `SELECT	user_id,
+					status,
+					video_key,
+					video_content_type,
+					video_size,
+					thumbnail_key,
+					thumbnail_content_type,
+					thumbnail_size
+			FROM upload_sessions
+			WHERE video_key = $1 OR thumbnail_key = $1
+			LIMIT 1`
+}
+
+func (u *UploadSession) validateCreate() (err error) {
+
+	if u.UserID == 0 {
+		return u.Errors(ErrorMissingValue, "user_id")
+	}
+
+	if !containsString(uploadContentTypes[UploadKindVideo], u.VideoContentType) {
+		return u.Errors(ErrorIncorrectValue, "video_content_type")
+	}
+
+	if u.VideoSize <= 0 || u.VideoSize > UploadMaxVideoBytes {
+		return u.Errors(ErrorIncorrectValue, "video_size")
+	}
+
+	if u.Duration <= 0 || u.Duration > float64(UploadMaxDurationSeconds) {
+		return u.Errors(ErrorIncorrectValue, "duration")
+	}
+
+	// a thumbnail is optional
+	if u.ThumbnailSize == 0 && u.ThumbnailContentType == "" {
+		return
+	}
+
+	if !containsString(uploadContentTypes[UploadKindThumbnail], u.ThumbnailContentType) {
+		return u.Errors(ErrorIncorrectValue, "thumbnail_content_type")
+	}
+
+	if u.ThumbnailSize <= 0 || u.ThumbnailSize > UploadMaxThumbnailBytes {
+		return u.Errors(ErrorIncorrectValue, "thumbnail_size")
+	}
+
+	return
+}
+
+// Open a session and presign the upload urls for its files
+func (u *UploadSession) Create(db *system.DB, store storage.Storage) (err error) {
+
+	if err = u.validateCreate(); err != nil {
+		return
+	}
+
+	u.VideoUploadURL = UploadURL{Kind: UploadKindVideo, ContentType: u.VideoContentType}
+
+	if err = u.VideoUploadURL.Create(store, u.UserID); err != nil {
+		return
+	}
+
+	u.VideoKey = u.VideoUploadURL.Key
+
+	if u.ThumbnailContentType != "" {
+		u.ThumbnailUploadURL = UploadURL{Kind: UploadKindThumbnail, ContentType: u.ThumbnailContentType}
+
+		if err = u.ThumbnailUploadURL.Create(store, u.UserID); err != nil {
+			return
+		}
+
+		u.ThumbnailKey = u.ThumbnailUploadURL.Key
+	}
+
+	u.Status = UploadSessionOpen
+	u.CreatedAt = time.Now()
+	u.UpdatedAt = u.CreatedAt
+	u.ExpiresAt = u.CreatedAt.Add(UploadSessionExpiry)
+
+	err = db.QueryRow(u.queryCreate(),
+		u.UserID,
+		u.Status,
+		u.VideoKey,
+		u.VideoContentType,
+		u.VideoSize,
+		u.ThumbnailKey,
+		u.ThumbnailContentType,
+		u.ThumbnailSize,
+		u.Duration,
+		u.ExpiresAt,
+		u.CreatedAt,
+		u.UpdatedAt,
+	).Scan(&u.ID)
+
+	if err != nil {
+		log.Printf("UploadSession.Create() user_id -> %v QueryRow() -> %v Error -> %v", u.UserID, u.queryCreate(), err)
+	}
+
+	return
+}
+
+// Check a stored file matches what the session declared
+func verifyUpload(store storage.Storage, key string, size int64, contentType string) (err error) {
+
+	object, err := store.Stat(key)
+
+	if err == storage.ErrorNotFound {
+		return ErrorUploadMissing
+	}
+
+	if err != nil {
+		log.Printf("verifyUpload() key -> %v Stat() Error -> %v", key, err)
+		return
+	}
+
+	if object.Size != size || object.ContentType != contentType {
+		log.Printf("verifyUpload() key -> %v expected -> %v %v found -> %v %v", key, size, contentType, object.Size, object.ContentType)
+		return ErrorUploadMismatch
+	}
+
+	return
+}
+
+// Create the video for a session once its files have been uploaded.
+// The keys always come from the session so a client can not claim
+// a file it did not upload.
+func (u *UploadSession) Finalize(db *system.DB, store storage.Storage, video *Video) (err error) {
+
+	if u.ID == 0 {
+		return u.Errors(ErrorMissingID, "id")
+	}
+
+	tx, err := db.Begin()
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			tx.Rollback()
+			return
+		}
+
+		// drafts and scheduled videos are registered when they are published
+		if !video.IsPublished() {
+			return
+		}
+
+		// a failed step does not undo the finalized session
+		if stepErr := video.runPublishSteps(db); stepErr != nil {
+			log.Printf("UploadSession.Finalize() id -> %v runPublishSteps() Error -> %v", u.ID, stepErr)
+		}
+	}()
+
+	if err != nil {
+		log.Println("UploadSession.Finalize() Begin() Error -> ", err)
+		return
+	}
+
+	userID := u.UserID
+
+	err = tx.QueryRow(u.queryGetForUpdate(), u.ID).Scan(
+		&u.ID,
+		&u.UserID,
+		&u.Status,
+		&u.VideoKey,
+		&u.VideoContentType,
+		&u.VideoSize,
+		&u.ThumbnailKey,
+		&u.ThumbnailContentType,
+		&u.ThumbnailSize,
+		&u.Duration,
+		&u.VideoID,
+		&u.ExpiresAt,
+		&u.CreatedAt,
+		&u.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows || (err == nil && u.UserID != userID) {
+		return u.Errors(ErrorIncorrectValue, "id")
+	}
+
+	if err != nil {
+		log.Printf("UploadSession.Finalize() id -> %v QueryRow() -> %v Error -> %v", u.ID, u.queryGetForUpdate(), err)
+		return
+	}
+
+	if u.Status == UploadSessionFinalized {
+		return ErrorUploadSessionFinalized
+	}
+
+	if time.Now().After(u.ExpiresAt) {
+		return ErrorUploadSessionExpired
+	}
+
+	if err = verifyUpload(store, u.VideoKey, u.VideoSize, u.VideoContentType); err != nil {
+		return
+	}
+
+	if u.ThumbnailKey != "" {
+		if err = verifyUpload(store, u.ThumbnailKey, u.ThumbnailSize, u.ThumbnailContentType); err != nil {
+			return
+		}
+	}
+
+	video.UserID = u.UserID
+	video.Key = u.VideoKey
+	video.Thumbnail = u.ThumbnailKey
+
+	// the video and the finalized session are saved together
+	if err = video.createTx(db, tx); err != nil {
+		return
+	}
+
+	u.Status = UploadSessionFinalized
+	u.VideoID = video.ID
+	u.UpdatedAt = time.Now()
+
+	if _, err = tx.Exec(u.queryFinalize(), u.ID, u.Status, u.VideoID, u.UpdatedAt); err != nil {
+		log.Printf("UploadSession.Finalize() id -> %v Exec() -> %v Error -> %v", u.ID, u.queryFinalize(), err)
+	}
+
+	return
+}
+
+// Check a key sent with a video belongs to the user. The key must
+// come from an open upload session of the user with its file in
+// storage, or be an older upload stored under the users prefix.
+// Keys already used by a video are refused.
+func CheckUploadKey(db *system.DB, store storage.Storage, userID uint64, key string, kind string) (err error) {
+	var u UploadSession
+	var v Video
+	var used bool
+
+	if key == "" {
+		return
+	}
+
+	if err = db.QueryRow(v.queryKeyUsed(), key).Scan(&used); err != nil {
+		log.Printf("CheckUploadKey() key -> %v QueryRow() -> %v Error -> %v", key, v.queryKeyUsed(), err)
+		return
+	}
+
+	if used {
+		return ErrorUploadKeyTaken
+	}
+
+	err = db.QueryRow(u.queryGetByKey(), key).Scan(
+		&u.UserID,
+		&u.Status,
+		&u.VideoKey,
+		&u.VideoContentType,
+		&u.VideoSize,
+		&u.ThumbnailKey,
+		&u.ThumbnailContentType,
+		&u.ThumbnailSize,
+	)
+
+	if err == sql.ErrNoRows {
+		if !strings.HasPrefix(key, uploadKeyPrefix(userID)) {
+			return ErrorUploadKeyNotOwned
+		}
+
+		if _, err = store.Stat(key); err == storage.ErrorNotFound {
+			return ErrorUploadMissing
+		}
+
+		return
+	}
+
+	if err != nil {
+		log.Printf("CheckUploadKey() key -> %v QueryRow() -> %v Error -> %v", key, u.queryGetByKey(), err)
+		return
+	}
+
+	if u.UserID != userID {
+		return ErrorUploadKeyTaken
+	}
+
+	if u.Status == UploadSessionFinalized {
+		return ErrorUploadSessionFinalized
+	}
+
+	switch {
+	case kind == UploadKindVideo && key == u.VideoKey:
+		return verifyUpload(store, key, u.VideoSize, u.VideoContentType)
+	case kind == UploadKindThumbnail && key == u.ThumbnailKey:
+		return verifyUpload(store, key, u.ThumbnailSize, u.ThumbnailContentType)
+	}
+
+	return ErrorUploadMismatch
+}
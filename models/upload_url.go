@@ -0,0 +1,89 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rathvong/talentmob_server/storage"
+)
+
+// Files clients can upload
+const (
+	UploadKindVideo     = "video"
+	UploadKindThumbnail = "thumbnail"
+)
+
+// How long a presigned upload url can be used for
+const UploadURLExpiry = 15 * time.Minute
+
+// Content types accepted for each kind of upload
+var uploadContentTypes = map[string][]string{
+	UploadKindVideo:     {"video/mp4", "video/quicktime"},
+	UploadKindThumbnail: {"image/jpeg", "image/png"},
+}
+
+// A presigned url a client uploads a file to. The client
+// sends the file with Method and the same content type,
+// then uses Key when it creates the video.
+type UploadURL struct {
+	Kind        string    `json:"kind"`
+	ContentType string    `json:"content_type"`
+	Key         string    `json:"key"`
+	URL         string    `json:"url"`
+	Method      string    `json:"method"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// Keys start with the uploader so they can be traced back to them
+func newUploadKey(userID uint64, kind string) (key string, err error) {
+	b := make([]byte, 16)
+
+	if _, err = rand.Read(b); err != nil {
+		return
+	}
+
+	key = uploadKeyPrefix(userID) + hex.EncodeToString(b)
+
+	if kind == UploadKindThumbnail {
+		key += "-" + UploadKindThumbnail
+	}
+
+	return
+}
+
+func uploadKeyPrefix(userID uint64) string {
+	return fmt.Sprintf("%d-", userID)
+}
+
+// Presign an upload url for a new file
+func (u *UploadURL) Create(store storage.Storage, userID uint64) (err error) {
+	var b BaseModel
+
+	if userID == 0 {
+		return b.Errors(ErrorMissingValue, "user_id")
+	}
+
+	types, ok := uploadContentTypes[u.Kind]
+
+	if !ok {
+		return b.Errors(ErrorIncorrectValue, "kind")
+	}
+
+	if !containsString(types, u.ContentType) {
+		return b.Errors(ErrorIncorrectValue, "content_type")
+	}
+
+	if u.Key, err = newUploadKey(userID, u.Kind); err != nil {
+		return
+	}
+
+	u.Method = http.MethodPut
+	u.ExpiresAt = time.Now().Add(UploadURLExpiry)
+
+	u.URL, err = store.PresignUpload(u.Key, u.ContentType, UploadURLExpiry)
+
+	return
+}
@@ -14,6 +14,7 @@ import (
 	"fmt"
 
 	"math/rand"
+	"strings"
 )
 
 // The main struct for users account
@@ -22,42 +23,48 @@ import (
 // user every time they sign up or re login
 type User struct {
 	BaseModel
-	Api                  Api    `json:"api, omitempty"`
-	Bio                  Bio    `json:"bio"`
-	FacebookID           string `json:"facebook_id"`
-	Avatar               string `json:"avatar"`
-	Name                 string `json:"name"`
-	Email                string `json:"email"`
-	AccountType          int    `json:"account_type"`
-	MinutesWatched       uint64 `json:"minutes_watched"`
-	Points               uint64 `json:"points"`
-	Password             string `json:"password, omitempty"`
-	IsActive             bool   `json:"is_active"`
-	ImportedVideosCount  int    `json:"imported_videos_count"`
-	FavouriteVideosCount int    `json:"favourite_videos_count"`
-	EncryptedPassword    string `json:"-"`
-	Role                 string `json:"role"` // needs to be added to db
-	TotalVotesReceived   uint64 `json:"total_votes_received"`
-	IsFollowing          bool   `json:"is_following"`
-	RankTalent           uint64 `json:"rank_talent"`
-	RankMob              uint64 `json:"rank_mob"`
-	IsReturning          bool   `json:"is_returning"`
-	DeviceID             string `json:"device_id, omitempty"`
+	Api                  Api        `json:"api, omitempty"`
+	Bio                  Bio        `json:"bio"`
+	FacebookID           string     `json:"facebook_id"`
+	Avatar               string     `json:"avatar"`
+	Name                 string     `json:"name"`
+	Email                string     `json:"email"`
+	AccountType          int        `json:"account_type"`
+	MinutesWatched       uint64     `json:"minutes_watched"`
+	Points               uint64     `json:"points"`
+	Password             string     `json:"password, omitempty"`
+	IsActive             bool       `json:"is_active"`
+	ImportedVideosCount  int        `json:"imported_videos_count"`
+	FavouriteVideosCount int        `json:"favourite_videos_count"`
+	EncryptedPassword    string     `json:"-"`
+	Role                 string     `json:"role"` // needs to be added to db
+	TotalVotesReceived   uint64     `json:"total_votes_received"`
+	IsFollowing          bool       `json:"is_following"`
+	RankTalent           uint64     `json:"rank_talent"`
+	RankMob              uint64     `json:"rank_mob"`
+	IsReturning          bool       `json:"is_returning"`
+	DeviceID             string     `json:"device_id, omitempty"`
+	IsVerified           bool       `json:"verified"`
+	VerifiedAt           *time.Time `json:"verified_at"`
+	ReferralCode         string     `json:"referral_code"`
+	ReferrerCode         string     `json:"referrer_code,omitempty"`
 }
 
 type ProfileUser struct {
-	ID                   uint64    `json:"id"`
-	Bio                  Bio       `json:"bio"`
-	Name                 string    `json:"name"`
-	Avatar               string    `json:"avatar"`
-	ImportedVideosCount  int       `json:"imported_videos_count"`
-	FavouriteVideosCount int       `json:"favourite_videos_count"`
-	AccountType          int       `json:"account_type"`
-	CreatedAt            time.Time `json:"created_at"`
-	UpdatedAt            time.Time `json:"updated_at"`
-	IsFollowing          bool      `json:"is_following"`
-	RankTalent           uint64    `json:"rank_talent"`
-	RankMob              uint64    `json:"rank_mob"`
+	ID                   uint64     `json:"id"`
+	Bio                  Bio        `json:"bio"`
+	Name                 string     `json:"name"`
+	Avatar               string     `json:"avatar"`
+	ImportedVideosCount  int        `json:"imported_videos_count"`
+	FavouriteVideosCount int        `json:"favourite_videos_count"`
+	AccountType          int        `json:"account_type"`
+	CreatedAt            time.Time  `json:"created_at"`
+	UpdatedAt            time.Time  `json:"updated_at"`
+	IsFollowing          bool       `json:"is_following"`
+	RankTalent           uint64     `json:"rank_talent"`
+	RankMob              uint64     `json:"rank_mob"`
+	IsVerified           bool       `json:"verified"`
+	VerifiedAt           *time.Time `json:"verified_at"`
 }
 
 const (
@@ -85,6 +92,8 @@ func (p *ProfileUser) GetUser(db *system.DB, userID uint64) (err error) {
 	p.AccountType = user.AccountType
 	p.CreatedAt = user.CreatedAt
 	p.UpdatedAt = user.UpdatedAt
+	p.IsVerified = user.IsVerified
+	p.VerifiedAt = user.VerifiedAt
 
 	return
 }
@@ -97,6 +106,8 @@ func (p *ProfileUser) GetUser2(db *system.DB, userID uint64, currentUserID uint6
 					users.account_type,
 					users.created_at,
 					users.updated_at,
+					users.verified,
+					users.verified_at,
 					(SELECT COUNT(*) FROM votes WHERE user_id = $1 AND upvote > 0),
 					(SELECT COUNT(*) FROM videos WHERE user_id = $1 AND is_active = true),
 					bios.id,
@@ -165,6 +176,8 @@ func (p *ProfileUser) GetUser2(db *system.DB, userID uint64, currentUserID uint6
 		&p.AccountType,
 		&p.CreatedAt,
 		&p.UpdatedAt,
+		&p.IsVerified,
+		&p.VerifiedAt,
 		&p.FavouriteVideosCount,
 		&p.ImportedVideosCount,
 		&p.Bio.ID,
@@ -208,9 +221,10 @@ func (u *User) queryCreate() (qry string) {
 						updated_at,
 						encrypted_password,
 						favourite_videos_count,
-						imported_videos_count)
+						imported_videos_count,
+						referral_code)
 			VALUES
-						($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+						($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 			RETURNING id`
 }
 
@@ -247,7 +261,10 @@ func (u *User) queryGetByEmail() (qry string) {
 					encrypted_password,
 					favourite_videos_count,
 					imported_videos_count,
-					is_active
+					is_active,
+					verified,
+					verified_at,
+					COALESCE(referral_code, '')
 			FROM
 					users
 			WHERE	email = $1`
@@ -268,7 +285,10 @@ func (u *User) queryGetByID() (qry string) {
 					encrypted_password,
 					favourite_videos_count,
 					imported_videos_count,
-					is_active
+					is_active,
+					verified,
+					verified_at,
+					COALESCE(referral_code, '')
 			FROM
 					users
 			WHERE	id = $1`
@@ -289,32 +309,79 @@ func (u *User) queryGetByFacebookID() (qry string) {
 					encrypted_password,
 					favourite_videos_count,
 					imported_videos_count,
-					is_active
+					is_active,
+					verified,
+					verified_at,
+					COALESCE(referral_code, '')
 			FROM
 					users
 			WHERE	facebook_id = $1`
 }
 
+// SQL query to fuzzy search users by name and bio.
+// Candidates are collected from the trigram indexes on users.name,
+// bios.bio and bios.catch_phrases, then ranked by trigram similarity on the
+// name, with bio and catch phrase matches weighted at half. Talent get a
+// boost that shrinks with the talent rank of their latest user_stats
+// snapshot, and verified users get a flat boost, so well known talent
+// surfaces first. users.id is used as the tie breaker so pages stay stable.
 func (u *User) queryGetByName() (qry string) {
-	return `SELECT
-					id,
-        			facebook_id,
-					avatar,
-					name,
-					email,
-					account_type,
-					minutes_watched,
-					points,
-					created_at,
-					updated_at,
-					encrypted_password,
-					favourite_videos_count,
-					imported_videos_count,
-				FROM users
-				WHERE
-					name ILIKE $1
-				LIMIT $2
-				OFFSET $3`
+	return `WITH candidates AS (
+				SELECT id FROM users WHERE name % $1
+				UNION
+				SELECT id FROM users WHERE name ILIKE $2
+				UNION
+				SELECT user_id FROM bios WHERE $1 <% bio
+				UNION
+				SELECT user_id FROM bios WHERE $1 <% catch_phrases
+			)
+			SELECT
+					u.id,
+					u.facebook_id,
+					u.avatar,
+					u.name,
+					u.email,
+					u.account_type,
+					u.minutes_watched,
+					u.points,
+					u.created_at,
+					u.updated_at,
+					u.encrypted_password,
+					u.favourite_videos_count,
+					u.imported_videos_count
+			FROM (
+				SELECT	users.*,
+						GREATEST(
+							similarity(users.name, $1),
+							word_similarity($1, COALESCE(b.bio, '')) * 0.5,
+							word_similarity($1, COALESCE(b.catch_phrases, '')) * 0.5
+						) +
+						COALESCE(0.3 / sqrt(talent.rank), 0) +
+						CASE WHEN users.verified THEN 0.2 ELSE 0 END as score
+				FROM candidates
+				INNER JOIN users
+				ON users.id = candidates.id
+				LEFT JOIN LATERAL (
+					SELECT	bios.bio,
+							bios.catch_phrases
+					FROM bios
+					WHERE bios.user_id = users.id
+					ORDER BY bios.created_at ASC
+					LIMIT 1) b
+				ON true
+				LEFT JOIN LATERAL (
+					SELECT	NULLIF(user_stats.rank_talent, 0) as rank
+					FROM user_stats
+					WHERE user_stats.user_id = users.id
+					ORDER BY user_stats.day DESC
+					LIMIT 1) talent
+				ON true
+				WHERE users.is_active = true
+				AND NOT is_shadowbanned(users.id)
+			) u
+			ORDER BY u.score DESC, u.id ASC
+			LIMIT $3
+			OFFSET $4`
 
 }
 
@@ -406,6 +473,16 @@ func (u *User) queryTotalTalentCount() (qry string) {
 				  AND users.account_type = 1`
 }
 
+// SQL query to validate if a referral code is taken
+func (u *User) queryReferralCodeExists() (qry string) {
+	return `SELECT EXISTS(SELECT 1 FROM USERS WHERE referral_code = $1)`
+}
+
+// SQL query to retrieve a user id by referral code
+func (u *User) queryGetIDByReferralCode() (qry string) {
+	return `SELECT id FROM users WHERE referral_code = $1 AND is_active = true`
+}
+
 // SQL query to validate if a row exists with email
 func (u *User) queryEmailExists() (qry string) {
 	return `SELECT EXISTS(SELECT 1 FROM USERS WHERE email = $1)`
@@ -477,6 +554,10 @@ func (u *User) Create(db *system.DB) (err error) {
 		return
 	}
 
+	if err = u.GenerateReferralCode(db); err != nil {
+		return
+	}
+
 	//initialize date values
 	u.CreatedAt = time.Now()
 	u.UpdatedAt = time.Now()
@@ -493,7 +574,8 @@ func (u *User) Create(db *system.DB) (err error) {
 		u.UpdatedAt,
 		u.EncryptedPassword,
 		u.ImportedVideosCount,
-		u.FavouriteVideosCount).Scan(&u.ID)
+		u.FavouriteVideosCount,
+		u.ReferralCode).Scan(&u.ID)
 
 	if err != nil {
 		log.Printf("User.Create() QueryRow() -> %v Error -> %v", u.queryCreate(), err)
@@ -665,7 +747,10 @@ func (u *User) GetByEmail(db *system.DB, email string) (err error) {
 		&u.EncryptedPassword,
 		&u.FavouriteVideosCount,
 		&u.ImportedVideosCount,
-		&u.IsActive)
+		&u.IsActive,
+		&u.IsVerified,
+		&u.VerifiedAt,
+		&u.ReferralCode)
 
 	if err != nil {
 		log.Printf("User.Get() Email -> %v QueryRow() -> %v Error -> %v", email, u.queryGetByEmail(), err)
@@ -695,7 +780,10 @@ func (u *User) Get(db *system.DB, id uint64) (err error) {
 		&u.EncryptedPassword,
 		&u.FavouriteVideosCount,
 		&u.ImportedVideosCount,
-		&u.IsActive)
+		&u.IsActive,
+		&u.IsVerified,
+		&u.VerifiedAt,
+		&u.ReferralCode)
 
 	if err != nil {
 		log.Printf("User.Get() id -> %v QueryRow() -> %v Error -> %v", id, u.queryGetByID(), err)
@@ -725,7 +813,10 @@ func (u *User) GetByFacebookID(db *system.DB, id string) (err error) {
 		&u.EncryptedPassword,
 		&u.FavouriteVideosCount,
 		&u.ImportedVideosCount,
-		&u.IsActive)
+		&u.IsActive,
+		&u.IsVerified,
+		&u.VerifiedAt,
+		&u.ReferralCode)
 
 	if err != nil {
 		log.Printf("User.GetByFacebookID() id -> %v QueryRow() -> %v Error -> %v", id, u.queryGetByFacebookID(), err)
@@ -765,19 +856,21 @@ func (u *User) DecryptHashPassword() (validated bool) {
 
 }
 
+// Fuzzy search users by name and bio, see queryGetByName for ranking
 func (u *User) Find(db *system.DB, qry string, page int) (users []User, err error) {
 
-	name := "%" + qry + "%"
-
-	rows, err := db.Query(u.queryGetByName(), name, LimitQueryPerRequest, OffSet(page))
+	name := strings.TrimSpace(qry)
+	pattern := "%" + name + "%"
 
-	defer rows.Close()
+	rows, err := db.Query(u.queryGetByName(), name, pattern, LimitQueryPerRequest, OffSet(page))
 
 	if err != nil {
 		log.Printf("User.Find() name -> %v  \nQuery() -> %v \nError -> %v", name, u.queryGetByName(), err)
 		return
 	}
 
+	defer rows.Close()
+
 	return u.parseRows(rows)
 }
 
@@ -1026,3 +1119,52 @@ func (u *User) AddStarPower(db *system.DB, sp PointActivity) error {
 
 	return nil
 }
+
+// Characters used for referral codes, similar looking
+// characters are left out so codes are easy to share
+const referralCodeCharacters = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+const referralCodeLength = 8
+
+// Generate a unique referral code for a new user
+func (u *User) GenerateReferralCode(db *system.DB) (err error) {
+	rand.Seed(time.Now().UnixNano())
+
+	for i := 0; i < 5; i++ {
+		code := make([]byte, referralCodeLength)
+
+		for c := range code {
+			code[c] = referralCodeCharacters[rand.Intn(len(referralCodeCharacters))]
+		}
+
+		var exists bool
+
+		if err = db.QueryRow(u.queryReferralCodeExists(), string(code)).Scan(&exists); err != nil {
+			log.Printf("User.GenerateReferralCode() QueryRow() -> %v Error -> %v", u.queryReferralCodeExists(), err)
+			return
+		}
+
+		if !exists {
+			u.ReferralCode = string(code)
+			return
+		}
+	}
+
+	return u.Errors(ErrorExists, "referral_code")
+}
+
+// Retrieve the id of the active user owning a referral code
+func (u *User) GetIDByReferralCode(db *system.DB, code string) (id uint64, err error) {
+
+	if code == "" {
+		return 0, u.Errors(ErrorMissingValue, "referral_code")
+	}
+
+	err = db.QueryRow(u.queryGetIDByReferralCode(), strings.ToUpper(strings.TrimSpace(code))).Scan(&id)
+
+	if err != nil {
+		log.Printf("User.GetIDByReferralCode() code -> %v QueryRow() -> %v Error -> %v", code, u.queryGetIDByReferralCode(), err)
+	}
+
+	return
+}
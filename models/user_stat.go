@@ -0,0 +1,303 @@
+package models
+
+import (
+	"log"
+	"time"
+
+	"github.com/rathvong/talentmob_server/system"
+)
+
+// Layout for the day of a stats snapshot
+const UserStatDayLayout = "2006-01-02"
+
+// Time ranges supported for a users stats history
+var UserStatRanges = []int{7, 30, 90}
+
+// Values tracked in a daily stats snapshot
+type UserStatValues struct {
+	VotesReceived int64 `json:"votes_received"`
+	Views         int64 `json:"views"`
+	Followers     int64 `json:"followers"`
+	RankTalent    int64 `json:"rank_talent"`
+	RankMob       int64 `json:"rank_mob"`
+	Points        int64 `json:"points"`
+}
+
+// Subtract the values of a previous snapshot
+func (u UserStatValues) Sub(previous UserStatValues) UserStatValues {
+	return UserStatValues{
+		VotesReceived: u.VotesReceived - previous.VotesReceived,
+		Views:         u.Views - previous.Views,
+		Followers:     u.Followers - previous.Followers,
+		RankTalent:    u.RankTalent - previous.RankTalent,
+		RankMob:       u.RankMob - previous.RankMob,
+		Points:        u.Points - previous.Points,
+	}
+}
+
+// A daily snapshot of a users stats written by the rollup job.
+// Delta holds the change from the previous day, and is null
+// when there is no snapshot for the previous day.
+type UserStat struct {
+	BaseModel
+	UserStatValues
+	UserID uint64          `json:"user_id"`
+	Day    string          `json:"day"`
+	Delta  *UserStatValues `json:"delta"`
+}
+
+// A users stats over a range of days.
+// Delta holds the change from the day before the range began, and is
+// null when there is no snapshot for that day.
+type UserStatSeries struct {
+	UserID uint64          `json:"user_id"`
+	Days   int             `json:"days"`
+	Stats  []UserStat      `json:"stats"`
+	Delta  *UserStatValues `json:"delta"`
+}
+
+// SQL query to write a snapshot for every active user on a day.
+// Running it again on the same day refreshes the snapshot.
+func (u *UserStat) queryRollup() (qry string) {
+	return `WITH received AS (
+				SELECT	videos.user_id,
+						COUNT(*) as votes
+				FROM votes
+				INNER JOIN videos
+				ON videos.id = votes.video_id
+				WHERE votes.upvote > 0
+				GROUP BY videos.user_id
+			), viewed AS (
+				SELECT	user_id,
+						SUM(views) as views
+				FROM videos
+				WHERE is_active = true
+				GROUP BY user_id
+			), fans AS (
+				SELECT	followed_id,
+						COUNT(*) as followers
+				FROM relationships
+				WHERE is_active = true
+				GROUP BY followed_id
+			), talent AS (
+				SELECT	users.id,
+						ROW_NUMBER() OVER (ORDER BY COALESCE(received.votes, 0) DESC) as rank
+				FROM users
+				LEFT JOIN received
+				ON received.user_id = users.id
+				WHERE users.id != 8
+				AND users.id != 11
+				AND users.id != 10
+				AND users.is_active = true
+			), mob AS (
+				SELECT	users.id,
+						ROW_NUMBER() OVER (ORDER BY points.total_mob DESC) as rank
+				FROM users
+				INNER JOIN points
+				ON points.user_id = users.id
+				WHERE points.total_mob > 0
+				AND users.is_active = true
+			)
+			INSERT INTO user_stats
+						(user_id,
+						day,
+						votes_received,
+						views,
+						followers,
+						rank_talent,
+						rank_mob,
+						points,
+						created_at,
+						updated_at)
+			SELECT	users.id,
+					$1::date,
+					COALESCE(received.votes, 0),
+					COALESCE(viewed.views, 0),
+					COALESCE(fans.followers, 0),
+					COALESCE(talent.rank, 0),
+					COALESCE(mob.rank, 0),
+					COALESCE(points.total, 0),
+					$2,
+					$2
+			FROM users
+			LEFT JOIN received
+			ON received.user_id = users.id
+			LEFT JOIN viewed
+			ON viewed.user_id = users.id
+			LEFT JOIN fans
+			ON fans.followed_id = users.id
+			LEFT JOIN talent
+			ON talent.id = users.id
+			LEFT JOIN mob
+			ON mob.id = users.id
+			LEFT JOIN points
+			ON points.user_id = users.id
+			WHERE users.is_active = true
+			ON CONFLICT (user_id, day) DO UPDATE SET
+					votes_received = EXCLUDED.votes_received,
+					views = EXCLUDED.views,
+					followers = EXCLUDED.followers,
+					rank_talent = EXCLUDED.rank_talent,
+					rank_mob = EXCLUDED.rank_mob,
+					points = EXCLUDED.points,
+					updated_at = EXCLUDED.updated_at`
+}
+
+// SQL query to retrieve the snapshots of a user from a day onwards
+func (u *UserStat) queryGetSince() (qry string) {
+	return `SELECT	id,
+					user_id,
+					to_char(day, 'YYYY-MM-DD'),
+					votes_received,
+					views,
+					followers,
+					rank_talent,
+					rank_mob,
+					points,
+					created_at,
+					updated_at
+			FROM user_stats
+			WHERE user_id = $1
+			AND day >= $2::date
+			ORDER BY day ASC`
+}
+
+// The day a snapshot is taken, events run on pacific time
+// so the stats days follow the same clock.
+func UserStatDay(t time.Time) string {
+	loc, err := time.LoadLocation("America/Los_Angeles")
+
+	if err != nil {
+		loc = time.UTC
+	}
+
+	return t.In(loc).Format(UserStatDayLayout)
+}
+
+// Write todays snapshot for every active user.
+// Past days can not be rebuilt as the snapshot holds the current totals.
+func (u *UserStat) Rollup(db *system.DB) (err error) {
+
+	day := UserStatDay(time.Now())
+
+	res, err := db.Exec(u.queryRollup(), day, time.Now())
+
+	if err != nil {
+		log.Printf("UserStat.Rollup() day -> %v Exec() -> %v Error -> %v", day, u.queryRollup(), err)
+		return
+	}
+
+	count, _ := res.RowsAffected()
+
+	log.Printf("UserStat.Rollup() day -> %v users -> %v", day, count)
+
+	return
+}
+
+// Retrieve a users snapshots for the last number of days.
+// Only the rollup table is read, the day before the range is loaded
+// to calculate the change on the first day.
+func (u *UserStat) GetSeries(db *system.DB, userID uint64, days int) (series UserStatSeries, err error) {
+
+	if userID == 0 {
+		return series, u.Errors(ErrorMissingValue, "user_id")
+	}
+
+	if !isValidUserStatRange(days) {
+		return series, u.Errors(ErrorIncorrectValue, "days")
+	}
+
+	series.UserID = userID
+	series.Days = days
+	series.Stats = make([]UserStat, 0)
+
+	since := UserStatDay(time.Now().AddDate(0, 0, -days))
+
+	rows, err := db.Query(u.queryGetSince(), userID, since)
+
+	if err != nil {
+		log.Printf("UserStat.GetSeries() user_id -> %v Query() -> %v Error -> %v", userID, u.queryGetSince(), err)
+		return
+	}
+
+	defer rows.Close()
+
+	var stats []UserStat
+
+	for rows.Next() {
+		stat := UserStat{}
+
+		err = rows.Scan(
+			&stat.ID,
+			&stat.UserID,
+			&stat.Day,
+			&stat.VotesReceived,
+			&stat.Views,
+			&stat.Followers,
+			&stat.RankTalent,
+			&stat.RankMob,
+			&stat.Points,
+			&stat.CreatedAt,
+			&stat.UpdatedAt,
+		)
+
+		if err != nil {
+			log.Println("UserStat.GetSeries() Error -> ", err)
+			return
+		}
+
+		stats = append(stats, stat)
+	}
+
+	if len(stats) == 0 {
+		return
+	}
+
+	// days missing a snapshot the day before are left without a delta
+	for i := 1; i < len(stats); i++ {
+		if stats[i-1].Day != previousUserStatDay(stats[i].Day) {
+			continue
+		}
+
+		delta := stats[i].UserStatValues.Sub(stats[i-1].UserStatValues)
+		stats[i].Delta = &delta
+	}
+
+	// the first snapshot is the baseline when it is the day before the range
+	if stats[0].Day == since {
+		baseline := stats[0]
+		stats = stats[1:]
+
+		if len(stats) > 0 {
+			delta := stats[len(stats)-1].UserStatValues.Sub(baseline.UserStatValues)
+			series.Delta = &delta
+		}
+	}
+
+	if len(stats) > 0 {
+		series.Stats = stats
+	}
+
+	return
+}
+
+// The day before a snapshot day
+func previousUserStatDay(day string) string {
+	t, err := time.Parse(UserStatDayLayout, day)
+
+	if err != nil {
+		return ""
+	}
+
+	return t.AddDate(0, 0, -1).Format(UserStatDayLayout)
+}
+
+func isValidUserStatRange(days int) bool {
+	for _, value := range UserStatRanges {
+		if value == days {
+			return true
+		}
+	}
+
+	return false
+}
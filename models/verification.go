@@ -0,0 +1,483 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/rathvong/talentmob_server/system"
+)
+
+// Status of a verification request
+const (
+	VerificationStatusPending  = "pending"
+	VerificationStatusApproved = "approved"
+	VerificationStatusRejected = "rejected"
+	VerificationStatusRevoked  = "revoked"
+)
+
+// The max number of evidence links a talent can attach
+// to a verification request
+const MaxVerificationEvidenceLinks = 5
+
+var ErrorVerificationTransition = errors.New("verification can not move to this status")
+
+// Talents can request to be verified so fans can tell
+// them apart from impersonators. A moderator will review the
+// evidence links and approve or reject the request.
+// Requests are never deleted, and every status change is kept in
+// verification_histories for auditing.
+type Verification struct {
+	BaseModel
+	UserID        uint64         `json:"user_id"`
+	EvidenceLinks pq.StringArray `json:"evidence_links"`
+	Note          string         `json:"note"`
+	Status        string         `json:"status"`
+	ReviewerNote  string         `json:"reviewer_note"`
+	ReviewedAt    *time.Time     `json:"reviewed_at"`
+}
+
+// Audit record for every status change of a verification request
+type VerificationHistory struct {
+	BaseModel
+	VerificationID uint64 `json:"verification_id"`
+	UserID         uint64 `json:"user_id"`
+	Status         string `json:"status"`
+	Note           string `json:"note"`
+}
+
+func (v *Verification) queryCreate() (qry string) {
+	return `INSERT INTO verifications
+						(user_id,
+						evidence_links,
+						note,
+						status,
+						reviewer_note,
+						created_at,
+						updated_at)
+				VALUES
+						($1, $2, $3, $4, $5, $6, $7)
+				RETURNING id`
+}
+
+func (v *Verification) queryReview() (qry string) {
+	return `UPDATE verifications SET
+						status = $2,
+						reviewer_note = $3,
+						reviewed_at = $4,
+						updated_at = $4
+				WHERE id = $1
+				AND status = $5`
+}
+
+func (v *Verification) queryUpdateUser() (qry string) {
+	return `UPDATE users SET
+						verified = $2,
+						verified_at = $3,
+						updated_at = $4
+				WHERE id = $1`
+}
+
+func (v *Verification) queryCreateHistory() (qry string) {
+	return `INSERT INTO verification_histories
+						(verification_id,
+						user_id,
+						status,
+						note,
+						created_at,
+						updated_at)
+				VALUES
+						($1, $2, $3, $4, $5, $6)`
+}
+
+func (v *Verification) queryGet() (qry string) {
+	return `SELECT	id,
+					user_id,
+					evidence_links,
+					note,
+					status,
+					reviewer_note,
+					reviewed_at,
+					created_at,
+					updated_at
+			FROM verifications
+			WHERE id = $1`
+}
+
+func (v *Verification) queryGetForUser() (qry string) {
+	return `SELECT	id,
+					user_id,
+					evidence_links,
+					note,
+					status,
+					reviewer_note,
+					reviewed_at,
+					created_at,
+					updated_at
+			FROM verifications
+			WHERE user_id = $1
+			ORDER BY created_at DESC
+			LIMIT $2
+			OFFSET $3`
+}
+
+func (v *Verification) queryGetByStatus() (qry string) {
+	return `SELECT	id,
+					user_id,
+					evidence_links,
+					note,
+					status,
+					reviewer_note,
+					reviewed_at,
+					created_at,
+					updated_at
+			FROM verifications
+			WHERE status = $1
+			ORDER BY created_at ASC, id ASC
+			LIMIT $2
+			OFFSET $3`
+}
+
+func (v *Verification) queryPendingExists() (qry string) {
+	return `SELECT EXISTS(SELECT 1 FROM verifications WHERE user_id = $1 AND status = 'pending')`
+}
+
+func (v *Verification) queryGetHistory() (qry string) {
+	return `SELECT	id,
+					verification_id,
+					user_id,
+					status,
+					note,
+					created_at,
+					updated_at
+			FROM verification_histories
+			WHERE user_id = $1
+			ORDER BY created_at DESC, id DESC`
+}
+
+func (v *Verification) validateCreateErrors() (err error) {
+	if v.UserID == 0 {
+		return v.Errors(ErrorMissingValue, "user_id")
+	}
+
+	if len(v.EvidenceLinks) == 0 {
+		return v.Errors(ErrorMissingValue, "evidence_links")
+	}
+
+	if len(v.EvidenceLinks) > MaxVerificationEvidenceLinks {
+		return v.Errors(ErrorIncorrectValue, "evidence_links")
+	}
+
+	for _, link := range v.EvidenceLinks {
+		u, err := url.ParseRequestURI(link)
+
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return v.Errors(ErrorIncorrectValue, "evidence_links")
+		}
+	}
+
+	return
+}
+
+// Submit a new verification request for a talent.
+// Only one pending request is allowed per user.
+func (v *Verification) Create(db *system.DB) (err error) {
+
+	if err = v.validateCreateErrors(); err != nil {
+		log.Println("Verification.Create() Error -> ", err)
+		return
+	}
+
+	pending, err := v.PendingExists(db, v.UserID)
+
+	if err != nil {
+		return
+	}
+
+	if pending {
+		return v.Errors(ErrorExists, "pending verification")
+	}
+
+	tx, err := db.Begin()
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			tx.Rollback()
+			return
+		}
+	}()
+
+	if err != nil {
+		log.Println("Verification.Create() Begin() Error -> ", err)
+		return
+	}
+
+	v.Status = VerificationStatusPending
+	v.CreatedAt = time.Now()
+	v.UpdatedAt = time.Now()
+
+	err = tx.QueryRow(v.queryCreate(),
+		v.UserID,
+		v.EvidenceLinks,
+		v.Note,
+		v.Status,
+		v.ReviewerNote,
+		v.CreatedAt,
+		v.UpdatedAt,
+	).Scan(&v.ID)
+
+	if err != nil {
+		log.Printf("Verification.Create() user_id -> %v QueryRow() -> %v Error -> %v", v.UserID, v.queryCreate(), err)
+		return
+	}
+
+	_, err = tx.Exec(v.queryCreateHistory(), v.ID, v.UserID, v.Status, v.Note, v.CreatedAt, v.UpdatedAt)
+
+	if err != nil {
+		log.Printf("Verification.Create() Exec() -> %v Error -> %v", v.queryCreateHistory(), err)
+		return
+	}
+
+	return
+}
+
+// Approve a pending request and mark the user as verified
+func (v *Verification) Approve(db *system.DB, note string) (err error) {
+	return v.review(db, VerificationStatusPending, VerificationStatusApproved, note)
+}
+
+// Reject a pending request, the user is left unverified
+func (v *Verification) Reject(db *system.DB, note string) (err error) {
+	return v.review(db, VerificationStatusPending, VerificationStatusRejected, note)
+}
+
+// Revoke an approved request and remove the verified flag from the user
+func (v *Verification) Revoke(db *system.DB, note string) (err error) {
+	return v.review(db, VerificationStatusApproved, VerificationStatusRevoked, note)
+}
+
+// Move a request from one status to another, updating the users
+// verified flag and recording the change in the history.
+func (v *Verification) review(db *system.DB, from string, to string, note string) (err error) {
+
+	if v.ID == 0 {
+		return v.Errors(ErrorMissingID, "id")
+	}
+
+	if v.Status != from {
+		return errors.New("verification is " + v.Status + ", expected " + from)
+	}
+
+	tx, err := db.Begin()
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			tx.Rollback()
+			return
+		}
+	}()
+
+	if err != nil {
+		log.Println("Verification.review() Begin() Error -> ", err)
+		return
+	}
+
+	reviewedAt := time.Now()
+
+	res, err := tx.Exec(v.queryReview(), v.ID, to, note, reviewedAt, from)
+
+	if err != nil {
+		log.Printf("Verification.review() id -> %v Exec() -> %v Error -> %v", v.ID, v.queryReview(), err)
+		return
+	}
+
+	// another moderator reviewed the request first
+	if count, _ := res.RowsAffected(); count == 0 {
+		return ErrorVerificationTransition
+	}
+
+	switch to {
+	case VerificationStatusApproved:
+		_, err = tx.Exec(v.queryUpdateUser(), v.UserID, true, reviewedAt, reviewedAt)
+	case VerificationStatusRevoked:
+		_, err = tx.Exec(v.queryUpdateUser(), v.UserID, false, nil, reviewedAt)
+	}
+
+	if err != nil {
+		log.Printf("Verification.review() user_id -> %v Exec() -> %v Error -> %v", v.UserID, v.queryUpdateUser(), err)
+		return
+	}
+
+	if _, err = tx.Exec(v.queryCreateHistory(), v.ID, v.UserID, to, note, reviewedAt, reviewedAt); err != nil {
+		log.Printf("Verification.review() Exec() -> %v Error -> %v", v.queryCreateHistory(), err)
+		return
+	}
+
+	v.Status = to
+	v.ReviewerNote = note
+	v.ReviewedAt = &reviewedAt
+	v.UpdatedAt = reviewedAt
+
+	return
+}
+
+// Retrieve a verification request by id
+func (v *Verification) Get(db *system.DB, id uint64) (err error) {
+
+	if id == 0 {
+		return v.Errors(ErrorMissingID, "id")
+	}
+
+	err = db.QueryRow(v.queryGet(), id).Scan(
+		&v.ID,
+		&v.UserID,
+		&v.EvidenceLinks,
+		&v.Note,
+		&v.Status,
+		&v.ReviewerNote,
+		&v.ReviewedAt,
+		&v.CreatedAt,
+		&v.UpdatedAt,
+	)
+
+	if err != nil {
+		log.Printf("Verification.Get() id -> %v QueryRow() -> %v Error -> %v", id, v.queryGet(), err)
+	}
+
+	return
+}
+
+// Check if a user is already waiting on a review
+func (v *Verification) PendingExists(db *system.DB, userID uint64) (exists bool, err error) {
+
+	if userID == 0 {
+		return false, v.Errors(ErrorMissingValue, "user_id")
+	}
+
+	err = db.QueryRow(v.queryPendingExists(), userID).Scan(&exists)
+
+	if err != nil {
+		log.Printf("Verification.PendingExists() user_id -> %v QueryRow() -> %v Error -> %v", userID, v.queryPendingExists(), err)
+	}
+
+	return
+}
+
+// Retrieve all requests made by a user, newest first
+func (v *Verification) GetForUser(db *system.DB, userID uint64, page int) (verifications []Verification, err error) {
+
+	if userID == 0 {
+		return verifications, v.Errors(ErrorMissingValue, "user_id")
+	}
+
+	rows, err := db.Query(v.queryGetForUser(), userID, LimitQueryPerRequest, OffSet(page))
+
+	if err != nil {
+		log.Printf("Verification.GetForUser() user_id -> %v Query() -> %v Error -> %v", userID, v.queryGetForUser(), err)
+		return
+	}
+
+	defer rows.Close()
+
+	return v.parseRows(rows)
+}
+
+// Retrieve the moderation queue for a status, oldest first
+func (v *Verification) GetByStatus(db *system.DB, status string, page int) (verifications []Verification, err error) {
+
+	if status == "" {
+		status = VerificationStatusPending
+	}
+
+	rows, err := db.Query(v.queryGetByStatus(), status, LimitQueryPerRequest, OffSet(page))
+
+	if err != nil {
+		log.Printf("Verification.GetByStatus() status -> %v Query() -> %v Error -> %v", status, v.queryGetByStatus(), err)
+		return
+	}
+
+	defer rows.Close()
+
+	return v.parseRows(rows)
+}
+
+// Retrieve the audit trail of every verification change for a user
+func (v *Verification) GetHistory(db *system.DB, userID uint64) (histories []VerificationHistory, err error) {
+
+	if userID == 0 {
+		return histories, v.Errors(ErrorMissingValue, "user_id")
+	}
+
+	rows, err := db.Query(v.queryGetHistory(), userID)
+
+	if err != nil {
+		log.Printf("Verification.GetHistory() user_id -> %v Query() -> %v Error -> %v", userID, v.queryGetHistory(), err)
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		history := VerificationHistory{}
+
+		err = rows.Scan(
+			&history.ID,
+			&history.VerificationID,
+			&history.UserID,
+			&history.Status,
+			&history.Note,
+			&history.CreatedAt,
+			&history.UpdatedAt,
+		)
+
+		if err != nil {
+			log.Println("Verification.GetHistory() Error -> ", err)
+			return
+		}
+
+		histories = append(histories, history)
+	}
+
+	return
+}
+
+func (v *Verification) parseRows(rows *sql.Rows) (verifications []Verification, err error) {
+
+	for rows.Next() {
+		verification := Verification{}
+
+		err = rows.Scan(
+			&verification.ID,
+			&verification.UserID,
+			&verification.EvidenceLinks,
+			&verification.Note,
+			&verification.Status,
+			&verification.ReviewerNote,
+			&verification.ReviewedAt,
+			&verification.CreatedAt,
+			&verification.UpdatedAt,
+		)
+
+		if err != nil {
+			log.Println("Verification.parseRows() Error -> ", err)
+			return
+		}
+
+		verifications = append(verifications, verification)
+	}
+
+	return
+}
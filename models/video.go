@@ -9,7 +9,6 @@ import (
 
 	pq "github.com/lib/pq"
 	"github.com/rathvong/talentmob_server/system"
-	"github.com/rathvong/talentmob_server/talentmobtranscoding"
 )
 
 // main structure for videos model
@@ -39,7 +38,21 @@ type Video struct {
 	CompetitionEndDate  int64       `json:"competition_end_date"`
 	UpVoteTrendingCount uint        `json:"upvote_trending_count"`
 	Priority            int
-	EventID             uint64 `json:"event_id"`
+	EventID             uint64     `json:"event_id"`
+	Status              string     `json:"status"`
+	PublishAt           *time.Time `json:"publish_at"`
+	ReplyToVideoID      uint64     `json:"reply_to_video_id"`
+	Responses           uint64     `json:"responses"`
+	Duration            float64    `json:"duration"`
+	AverageWatchTime    float64    `json:"average_watch_time"`
+	CompletionRate      float64    `json:"completion_rate"`
+	QualifiedViews      uint64     `json:"qualified_views"`
+	PlaybackKey         string     `json:"playback_key"`
+	IsProcessed         bool       `json:"is_processed"`
+	StreamURL           string     `json:"stream_url"`
+	Captions            []Caption  `json:"captions"`
+	DeletedAt           *time.Time `json:"deleted_at"`
+	PurgeAt             *time.Time `json:"purge_at"`
 }
 
 // SQL query to create a row
@@ -57,9 +70,13 @@ func (v *Video) queryCreate() (qry string) {
 						title,
 						created_at,
 						updated_at,
-						is_active)
+						is_active,
+						status,
+						publish_at,
+						event_id,
+						reply_to_video_id)
 			VALUES
-						($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+						($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, NULLIF($16, 0), NULLIF($17, 0))
 			RETURNING 	id`
 }
 
@@ -108,9 +125,10 @@ func (v *Video) queryTimeLine() (qry string) {
     WHERE videos.id NOT IN (select video_id from votes where user_id = $1)
     AND videos.user_id != $1
     AND videos.is_active = true
+    AND NOT is_shadowbanned(videos.user_id)
     AND videos.upvote_trending_count > 4
     and videos.created_at > now()::date - 7
-    ORDER BY upvote_trending_count DESC
+    ORDER BY upvote_trending_count DESC, qualified_views DESC
     LIMIT 4
     ) UNION ALL (
     SELECT
@@ -135,6 +153,7 @@ func (v *Video) queryTimeLine() (qry string) {
             ON videos.id = boosts.video_id
             AND videos.user_id != $1
             AND videos.is_active = true
+            AND NOT is_shadowbanned(videos.user_id)
             WHERE boosts.is_active = true
             AND boosts.end_time >= now()
             AND boosts.video_id NOT IN (SELECT video_id from votes where user_id = $1)
@@ -166,10 +185,12 @@ func (v *Video) queryTimeLine() (qry string) {
 					WHERE videos.id NOT IN (select video_id from votes where user_id = $1)
  					AND videos.user_id != $1
 					AND videos.is_active = true
+ 					AND NOT is_shadowbanned(videos.user_id)
 					AND videos.upvote_trending_count <= 4
 					OR videos.id NOT IN (select video_id from votes where user_id = $1)
 					AND videos.user_id != $1
 					AND videos.is_active = true
+					AND NOT is_shadowbanned(videos.user_id)
 					AND videos.upvote_trending_count IS NULL
 					ORDER BY videos.id DESC
 				LIMIT 20
@@ -230,9 +251,10 @@ func (v *Video) queryDiscoveryTimeLine() (qry string) {
     WHERE videos.id NOT IN (select video_id from votes where user_id = $1)
     AND videos.user_id != $1
     AND videos.is_active = true
+    AND NOT is_shadowbanned(videos.user_id)
     AND videos.upvote_trending_count > 1
     and videos.created_at > now()::date - 7
-    ORDER BY upvote_trending_count DESC
+    ORDER BY upvote_trending_count DESC, qualified_views DESC
     LIMIT 4
     ) UNION ALL (
     SELECT
@@ -257,6 +279,7 @@ func (v *Video) queryDiscoveryTimeLine() (qry string) {
             ON videos.id = boosts.video_id
             AND videos.user_id != $1
             AND videos.is_active = true
+            AND NOT is_shadowbanned(videos.user_id)
             WHERE boosts.is_active = true
             AND boosts.end_time >= now()
             AND boosts.video_id NOT IN (SELECT video_id from votes where user_id = $1)
@@ -288,10 +311,12 @@ func (v *Video) queryDiscoveryTimeLine() (qry string) {
 					WHERE videos.id NOT IN (select video_id from votes where user_id = $1)
  					AND videos.user_id != $1
 					AND videos.is_active = true
+ 					AND NOT is_shadowbanned(videos.user_id)
 					AND videos.upvote_trending_count <= 1
 					OR videos.id NOT IN (select video_id from votes where user_id = $1)
 					AND videos.user_id != $1
 					AND videos.is_active = true
+					AND NOT is_shadowbanned(videos.user_id)
 					AND videos.upvote_trending_count IS NULL
 					ORDER BY videos.id DESC
 				LIMIT 100
@@ -423,6 +448,7 @@ func (v *Video) queryLeaderBoard() (qry string) {
 						videos.upvote_trending_count
 			FROM videos
 			WHERE is_active = true
+			AND (user_id = $3 OR NOT is_shadowbanned(user_id))
 			ORDER BY upvotes DESC, downvotes ASC
 			LIMIT $1
 			OFFSET $2`
@@ -444,11 +470,30 @@ func (v *Video) queryVideoByID() (qry string) {
 						created_at,
 						updated_at,
 						is_active,
-						videos.upvote_trending_count
+						videos.upvote_trending_count,
+						status,
+						publish_at,
+						COALESCE(event_id, 0),
+						COALESCE(reply_to_video_id, 0),
+						responses,
+						duration,
+						average_watch_time,
+						completion_rate,
+						qualified_views
 			FROM videos
 			WHERE id = $1`
 }
 
+// SQL query to check if a video already uses a key
+func (v *Video) queryKeyUsed() (qry string) {
+	return `SELECT EXISTS(SELECT 1 FROM videos WHERE key = $1 OR thumbnail = $1)`
+}
+
+// SQL query to hold a key until the transaction ends
+func (v *Video) queryLockKey() (qry string) {
+	return `SELECT pg_advisory_xact_lock(hashtext('videos.key'), hashtext($1))`
+}
+
 func (v *Video) querySoftDeleteVideo() (qry string) {
 	return `UPDATE videos SET
 					is_active = false
@@ -499,6 +544,7 @@ func (v *Video) queryVideoByTitleAndCategory() (qry string) {
 						FROM videos
 						WHERE is_active = true
 						AND user_id != $3
+						AND NOT is_shadowbanned(user_id)
 						AND id NOT IN (select video_id from votes where user_id = $3)
 						) v
 				WHERE v.rank > 0
@@ -529,6 +575,7 @@ func (v *Video) queryRecentVideos() (qry string) {
 
 			FROM videos
 			WHERE is_active = true
+			AND (user_id = $3 OR NOT is_shadowbanned(user_id))
 			ORDER BY videos.created_at DESC
 			LIMIT $1
 			OFFSET $2 `
@@ -581,53 +628,36 @@ func (v *Video) validateError() (err error) {
 
 // CreateForWeeklyEvents a new video
 func (v *Video) CreateForWeeklyEvents(db *system.DB) (err error) {
+	return v.Create(db)
+}
+
+// Validate and insert a new video as part of a larger transaction,
+// the caller runs the publish steps once it has committed.
+// The keys are locked until the transaction ends so two videos
+// can not take the same file.
+func (v *Video) createTx(db *system.DB, tx *sql.Tx) (err error) {
 
 	if err = v.validateError(); err != nil {
 		return err
 	}
 
-	tx, err := db.Begin()
+	if err = v.validatePublishing(); err != nil {
+		return err
+	}
 
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-			return
-		}
+	if err = v.validateReplyTo(db); err != nil {
+		return err
+	}
 
-		if err = tx.Commit(); err != nil {
-			tx.Rollback()
+	for _, key := range []string{v.Key, v.Thumbnail} {
+		if err = v.lockKey(tx, key); err != nil {
 			return
 		}
-
-		// Register video in this weeks competition
-		compete := Competitor{}
-		if err = compete.RegisterForWeeklyEvent(db, *v); err != nil {
-			log.Println("competitor.Register() error: ", err)
-
-		}
-
-		// Create new categories
-		category := Category{}
-		category.CreateNewCategoriesFromTags(db, v.Categories, *v)
-
-		if err := talentmobtranscoding.Transcode(v.ID); err != nil {
-			log.Println("transcode err: ", err)
-		}
-
-		if err := talentmobtranscoding.TranscodeWithWatermark(v.ID); err != nil {
-			log.Println("transcode with watermark err: ", err)
-		}
-
-	}()
-
-	if err != nil {
-		log.Println("Video.Create() Begin -> ", err)
-		return
 	}
 
 	v.CreatedAt = time.Now()
 	v.UpdatedAt = time.Now()
-	v.IsActive = true
+	v.IsActive = v.IsPublished()
 
 	err = tx.QueryRow(v.queryCreate(),
 		v.UserID,
@@ -642,22 +672,48 @@ func (v *Video) CreateForWeeklyEvents(db *system.DB) (err error) {
 		v.Title,
 		v.CreatedAt,
 		v.UpdatedAt,
-		v.IsActive).Scan(&v.ID)
+		v.IsActive,
+		v.Status,
+		v.PublishAt,
+		v.EventID,
+		v.ReplyToVideoID).Scan(&v.ID)
 
 	if err != nil {
-		log.Printf("Video.Create() QueryRow() -> %v Error -> %v", v.queryCreate(), err)
+		log.Printf("Video.createTx() QueryRow() -> %v Error -> %v", v.queryCreate(), err)
 	}
 
-	// Register video into competition
 	return
 }
 
-func (v *Video) Create(db *system.DB) (err error) {
+// Hold a key for the rest of the transaction and check
+// no other video has taken it
+func (v *Video) lockKey(tx *sql.Tx, key string) (err error) {
 
-	if err = v.validateError(); err != nil {
-		return err
+	if key == "" {
+		return
+	}
+
+	if _, err = tx.Exec(v.queryLockKey(), key); err != nil {
+		log.Printf("Video.lockKey() key -> %v Exec() -> %v Error -> %v", key, v.queryLockKey(), err)
+		return
+	}
+
+	var used bool
+
+	if err = tx.QueryRow(v.queryKeyUsed(), key).Scan(&used); err != nil {
+		log.Printf("Video.lockKey() key -> %v QueryRow() -> %v Error -> %v", key, v.queryKeyUsed(), err)
+		return
 	}
 
+	if used {
+		return ErrorUploadKeyTaken
+	}
+
+	return
+}
+
+func (v *Video) Create(db *system.DB) (err error) {
+
 	tx, err := db.Begin()
 
 	defer func() {
@@ -671,35 +727,12 @@ func (v *Video) Create(db *system.DB) (err error) {
 			return
 		}
 
-		// Register video in this weeks competition
-		compete := Competitor{}
-		if err = compete.RegisterForWeeklyEvent(db, *v); err != nil {
-			log.Println("competitor.Register() error: ", err)
-		}
-
-		if v.EventID != 0 {
-			compete := Competitor{}
-			compete.VideoID = v.ID
-			compete.UserID = v.UserID
-			compete.EventID = v.EventID
-			if err = compete.Create(db); err != nil {
-				log.Println("competitor.Register() error: ", err)
-			}
-
-		}
-
-		// Create new categories
-		category := Category{}
-		category.CreateNewCategoriesFromTags(db, v.Categories, *v)
-
-		if err := talentmobtranscoding.Transcode(v.ID); err != nil {
-			log.Println("transcode err: ", err)
-		}
-
-		if err := talentmobtranscoding.TranscodeWithWatermark(v.ID); err != nil {
-			log.Println("transcode with watermark err: ", err)
+		// drafts and scheduled videos are registered when they are published
+		if !v.IsPublished() {
+			return
 		}
 
+		err = v.runPublishSteps(db)
 	}()
 
 	if err != nil {
@@ -707,31 +740,8 @@ func (v *Video) Create(db *system.DB) (err error) {
 		return
 	}
 
-	v.CreatedAt = time.Now()
-	v.UpdatedAt = time.Now()
-	v.IsActive = true
-
-	err = tx.QueryRow(v.queryCreate(),
-		v.UserID,
-		v.Categories,
-		v.Downvotes,
-		v.Upvotes,
-		v.Shares,
-		v.Views,
-		v.Comments,
-		v.Thumbnail,
-		v.Key,
-		v.Title,
-		v.CreatedAt,
-		v.UpdatedAt,
-		v.IsActive).Scan(&v.ID)
-
-	if err != nil {
-		log.Printf("Video.Create() QueryRow() -> %v Error -> %v", v.queryCreate(), err)
-	}
-
 	// Register video into competition
-	return
+	return v.createTx(db, tx)
 }
 
 func (v *Video) SoftDelete(db *system.DB) (err error) {
@@ -858,6 +868,8 @@ func (v *Video) GetTimeLine2(db *system.DB, userID uint64, page int) (videos []V
 			users.account_type,
 			users.created_at,
 			users.updated_at,
+			users.verified,
+			users.verified_at,
 			(SELECT EXISTS(SELECT 1 FROM relationships WHERE followed_id = competitors.user_id AND follower_id = $1 AND is_active = true)),
 			boosts.id,
 			boosts.user_id,
@@ -879,9 +891,10 @@ func (v *Video) GetTimeLine2(db *system.DB, userID uint64, page int) (videos []V
     WHERE videos.id NOT IN (select video_id from votes where user_id = $1)
     AND videos.user_id != $1
     AND videos.is_active = true
+    AND NOT is_shadowbanned(videos.user_id)
     AND videos.upvote_trending_count > 4
     and videos.created_at > now()::date - 7
-    ORDER BY upvote_trending_count DESC
+    ORDER BY upvote_trending_count DESC, qualified_views DESC
     LIMIT 4
     ) UNION ALL (
     SELECT
@@ -910,6 +923,8 @@ func (v *Video) GetTimeLine2(db *system.DB, userID uint64, page int) (videos []V
 			users.account_type,
 			users.created_at,
 			users.updated_at,
+			users.verified,
+			users.verified_at,
 			(SELECT EXISTS(SELECT 1 FROM relationships WHERE followed_id = competitors.user_id AND follower_id = $1 AND is_active = true)),
 			boosts.id,
 			boosts.user_id,
@@ -924,6 +939,7 @@ func (v *Video) GetTimeLine2(db *system.DB, userID uint64, page int) (videos []V
             ON videos.id = boosts.video_id
             AND videos.user_id != $1
 			AND videos.is_active = true
+            AND NOT is_shadowbanned(videos.user_id)
 			LEFT JOIN competitors
 			ON competitors.video_id = videos.id
 			LEFT JOIN users
@@ -959,10 +975,12 @@ func (v *Video) GetTimeLine2(db *system.DB, userID uint64, page int) (videos []V
 					WHERE videos.id NOT IN (select video_id from votes where user_id = $1)
  					AND videos.user_id != $1
 					AND videos.is_active = true
+ 					AND NOT is_shadowbanned(videos.user_id)
 					AND videos.upvote_trending_count <= 4
 					OR videos.id NOT IN (select video_id from votes where user_id = $1)
 					AND videos.user_id != $1
 					AND videos.is_active = true
+					AND NOT is_shadowbanned(videos.user_id)
 					AND videos.upvote_trending_count IS NULL
 					ORDER BY videos.id DESC
 				LIMIT 20
@@ -994,6 +1012,8 @@ func (v *Video) GetTimeLine2(db *system.DB, userID uint64, page int) (videos []V
 			users.account_type,
 			users.created_at,
 			users.updated_at,
+			users.verified,
+			users.verified_at,
 			(SELECT EXISTS(SELECT 1 FROM relationships WHERE followed_id = competitors.user_id AND follower_id = $1 AND is_active = true)),
 			boosts.id,
 			boosts.user_id,
@@ -1093,6 +1113,8 @@ func (v *Video) GetDiscoveryTimeLine2(db *system.DB, userID uint64, page int) (v
 			users.account_type,
 			users.created_at,
 			users.updated_at,
+			users.verified,
+			users.verified_at,
 			(SELECT EXISTS(SELECT 1 FROM relationships WHERE followed_id = competitors.user_id AND follower_id = $1 AND is_active = true)),
 			boosts.id,
 			boosts.user_id,
@@ -1114,9 +1136,10 @@ func (v *Video) GetDiscoveryTimeLine2(db *system.DB, userID uint64, page int) (v
     WHERE videos.id NOT IN (select video_id from votes where user_id = $1)
     AND videos.user_id != $1
     AND videos.is_active = true
+    AND NOT is_shadowbanned(videos.user_id)
     AND videos.upvote_trending_count > 4
     and videos.created_at > now()::date - 7
-    ORDER BY upvote_trending_count DESC
+    ORDER BY upvote_trending_count DESC, qualified_views DESC
     LIMIT 4
     ) UNION ALL (
     SELECT
@@ -1145,6 +1168,8 @@ func (v *Video) GetDiscoveryTimeLine2(db *system.DB, userID uint64, page int) (v
 			users.account_type,
 			users.created_at,
 			users.updated_at,
+			users.verified,
+			users.verified_at,
 			(SELECT EXISTS(SELECT 1 FROM relationships WHERE followed_id = competitors.user_id AND follower_id = $1 AND is_active = true)),
 			boosts.id,
 			boosts.user_id,
@@ -1159,6 +1184,7 @@ func (v *Video) GetDiscoveryTimeLine2(db *system.DB, userID uint64, page int) (v
             ON videos.id = boosts.video_id
             AND videos.user_id != $1
 			AND videos.is_active = true
+            AND NOT is_shadowbanned(videos.user_id)
 			LEFT JOIN competitors
 			ON competitors.video_id = videos.id
 			LEFT JOIN users
@@ -1194,10 +1220,12 @@ func (v *Video) GetDiscoveryTimeLine2(db *system.DB, userID uint64, page int) (v
 					WHERE videos.id NOT IN (select video_id from votes where user_id = $1)
  					AND videos.user_id != $1
 					AND videos.is_active = true
+ 					AND NOT is_shadowbanned(videos.user_id)
 					AND videos.upvote_trending_count <= 4
 					OR videos.id NOT IN (select video_id from votes where user_id = $1)
 					AND videos.user_id != $1
 					AND videos.is_active = true
+					AND NOT is_shadowbanned(videos.user_id)
 					AND videos.upvote_trending_count IS NULL
 					ORDER BY videos.id DESC
 				LIMIT 100
@@ -1229,6 +1257,8 @@ func (v *Video) GetDiscoveryTimeLine2(db *system.DB, userID uint64, page int) (v
 			users.account_type,
 			users.created_at,
 			users.updated_at,
+			users.verified,
+			users.verified_at,
 			(SELECT EXISTS(SELECT 1 FROM relationships WHERE followed_id = competitors.user_id AND follower_id = $1 AND is_active = true)),
 			boosts.id,
 			boosts.user_id,
@@ -1326,6 +1356,8 @@ func (v *Video) GetImportedVideos2(db *system.DB, userID uint64, currentUserID u
 				users.account_type,
 				users.created_at,
 				users.updated_at,
+				users.verified,
+				users.verified_at,
 				(SELECT EXISTS(SELECT 1 FROM relationships WHERE followed_id = competitors.user_id AND follower_id = $2 AND is_active = true)),
 				boosts.id,
 				boosts.user_id,
@@ -1346,6 +1378,7 @@ func (v *Video) GetImportedVideos2(db *system.DB, userID uint64, currentUserID u
 			AND boosts.end_time > now()
 			WHERE videos.user_id = $1
 			AND videos.is_active = true
+			AND (videos.user_id = $2 OR NOT is_shadowbanned(videos.user_id))
 			ORDER BY videos.created_at DESC
 			LIMIT $3
 			OFFSET $4 `
@@ -1416,6 +1449,8 @@ func (v *Video) GetFavouriteVideos2(db *system.DB, userID uint64, currentUserID
 				users.account_type,
 				users.created_at,
 				users.updated_at,
+				users.verified,
+				users.verified_at,
 				(SELECT EXISTS(SELECT 1 FROM relationships WHERE followed_id = competitors.user_id AND follower_id = $2 AND is_active = true)),
 				boosts.id,
 				boosts.user_id,
@@ -1477,7 +1512,7 @@ func (v *Video) GetHistory(db *system.DB, userID uint64, page int) (videos []Vid
 //Get Leader board list
 func (v *Video) GetLeaderBoard(db *system.DB, page int, userID uint64) (videos []Video, err error) {
 
-	rows, err := db.Query(v.queryLeaderBoard(), LimitQueryPerRequest, OffSet(page))
+	rows, err := db.Query(v.queryLeaderBoard(), LimitQueryPerRequest, OffSet(page), userID)
 
 	defer rows.Close()
 
@@ -1515,6 +1550,8 @@ func (v *Video) GetLeaderBoard2(db *system.DB, page int, userID uint64) (videos
 	users.account_type,
 	users.created_at,
 	users.updated_at,
+	users.verified,
+	users.verified_at,
 	(SELECT EXISTS(SELECT 1 FROM relationships WHERE followed_id = competitors.user_id AND follower_id = $1 AND is_active = true)),
 	boosts.id,
 	boosts.user_id,
@@ -1534,6 +1571,7 @@ ON boosts.video_id = videos.id
 AND boosts.is_active = true
 AND boosts.end_time > now()
 WHERE videos.is_active = true
+AND (videos.user_id = $1 OR NOT is_shadowbanned(videos.user_id))
 ORDER BY videos.upvotes DESC, videos.downvotes ASC
 LIMIT $2
 OFFSET $3`
@@ -1571,16 +1609,29 @@ func (v *Video) GetVideoByID(db *system.DB, id uint64) (err error) {
 		&v.CreatedAt,
 		&v.UpdatedAt,
 		&v.IsActive,
-		&trending)
+		&trending,
+		&v.Status,
+		&v.PublishAt,
+		&v.EventID,
+		&v.ReplyToVideoID,
+		&v.Responses,
+		&v.Duration,
+		&v.AverageWatchTime,
+		&v.CompletionRate,
+		&v.QualifiedViews)
 
 	if err != nil {
 		log.Printf("Video.GetVideoByID() id -> %v QueryRow() -> %v Error -> %v", id, v.queryVideoByID(), err)
+		return
 	}
 
 	if trending.Valid {
 		v.UpVoteTrendingCount = uint(trending.Int64)
 	}
 
+	v.SetPlaybackKey(db)
+	v.SetCaptions(db)
+
 	return
 }
 
@@ -1605,12 +1656,20 @@ func (v *Video) GetVideoByID2(db *system.DB, id uint64) (err error) {
 						videos.updated_at,
 						videos.is_active,
 						videos.upvote_trending_count,
+						COALESCE(videos.reply_to_video_id, 0),
+						videos.responses,
+						videos.duration,
+						videos.average_watch_time,
+						videos.completion_rate,
+						videos.qualified_views,
 						users.id,
 						users.avatar,
 						users.name,
 						users.account_type,
 						users.created_at,
 						users.updated_at,
+						users.verified,
+						users.verified_at,
 						boosts.id,
 						boosts.user_id,
 						boosts.video_id,
@@ -1660,12 +1719,20 @@ func (v *Video) GetVideoByID2(db *system.DB, id uint64) (err error) {
 		&v.UpdatedAt,
 		&v.IsActive,
 		&trending,
+		&v.ReplyToVideoID,
+		&v.Responses,
+		&v.Duration,
+		&v.AverageWatchTime,
+		&v.CompletionRate,
+		&v.QualifiedViews,
 		&v.Publisher.ID,
 		&v.Publisher.Avatar,
 		&v.Publisher.Name,
 		&v.Publisher.AccountType,
 		&v.Publisher.CreatedAt,
 		&v.Publisher.UpdatedAt,
+		&v.Publisher.IsVerified,
+		&v.Publisher.VerifiedAt,
 		&boostID,
 		&boostUserID,
 		&boostVideoID,
@@ -1724,6 +1791,9 @@ func (v *Video) GetVideoByID2(db *system.DB, id uint64) (err error) {
 		v.CompetitionEndDate = endDate.Time.UnixNano() / 1000000
 	}
 
+	v.SetPlaybackKey(db)
+	v.SetCaptions(db)
+
 	return
 }
 
@@ -1772,6 +1842,8 @@ func (v *Video) Find2(db *system.DB, q string, page int, userID uint64, weekInte
    users.account_type,
    users.created_at,
    users.updated_at,
+   users.verified,
+   users.verified_at,
    (SELECT EXISTS(SELECT 1 FROM relationships WHERE followed_id = competitors.user_id AND follower_id = $3 AND is_active = true)),
    boosts.id,
    boosts.user_id,
@@ -1804,6 +1876,7 @@ FROM (
 	FROM videos
 	WHERE is_active = true
 	AND user_id != $3
+	AND NOT is_shadowbanned(user_id)
 	AND id NOT IN (select video_id from votes where user_id = $3)
 	) v
 
@@ -1834,7 +1907,7 @@ OFFSET $2`
 
 func (v *Video) Recent(db *system.DB, userID uint64, page int, weeklyInterval int) (videos []Video, err error) {
 
-	rows, err := db.Query(v.queryRecentVideos(), LimitQueryPerRequest, OffSet(page))
+	rows, err := db.Query(v.queryRecentVideos(), LimitQueryPerRequest, OffSet(page), userID)
 
 	defer rows.Close()
 
@@ -1846,6 +1919,14 @@ func (v *Video) Recent(db *system.DB, userID uint64, page int, weeklyInterval in
 	return v.parseRows(db, rows, userID, weeklyInterval)
 }
 
+// Set the fields of a page of videos that are loaded
+// for the whole page at once rather than per video
+func setVideoListDetails(db *system.DB, videos []Video) {
+	SetPlaybackKeys(db, videos)
+	SetCaptionsForVideos(db, videos)
+	SetResponseCounts(db, videos)
+}
+
 //Parse rows for video queries
 func (v *Video) parseRows(db *system.DB, rows *sql.Rows, userID uint64, weekInterval int) (videos []Video, err error) {
 
@@ -1912,6 +1993,8 @@ func (v *Video) parseRows(db *system.DB, rows *sql.Rows, userID uint64, weekInte
 		videos = append(videos, video)
 	}
 
+	setVideoListDetails(db, videos)
+
 	return
 }
 
@@ -1953,6 +2036,8 @@ func (v *Video) parseRows2(db *system.DB, rows *sql.Rows, userID uint64, weekInt
 			&video.Publisher.AccountType,
 			&video.Publisher.CreatedAt,
 			&video.Publisher.UpdatedAt,
+			&video.Publisher.IsVerified,
+			&video.Publisher.VerifiedAt,
 			&video.Publisher.IsFollowing,
 			&boostID,
 			&boostUserID,
@@ -2011,6 +2096,8 @@ func (v *Video) parseRows2(db *system.DB, rows *sql.Rows, userID uint64, weekInt
 		videos = append(videos, video)
 	}
 
+	setVideoListDetails(db, videos)
+
 	return
 }
 
@@ -2083,6 +2170,8 @@ func (v *Video) parseTimeLineRows(db *system.DB, rows *sql.Rows, userID uint64,
 		videos = append(videos, video)
 	}
 
+	setVideoListDetails(db, videos)
+
 	return
 }
 
@@ -2130,6 +2219,8 @@ func (v *Video) parseTimeLineRows2(db *system.DB, rows *sql.Rows, userID uint64,
 			&video.Publisher.AccountType,
 			&video.Publisher.CreatedAt,
 			&video.Publisher.UpdatedAt,
+			&video.Publisher.IsVerified,
+			&video.Publisher.VerifiedAt,
 			&video.Publisher.IsFollowing,
 			&boostID,
 			&boostUserID,
@@ -2196,6 +2287,8 @@ func (v *Video) parseTimeLineRows2(db *system.DB, rows *sql.Rows, userID uint64,
 		videos = append(videos, video)
 	}
 
+	setVideoListDetails(db, videos)
+
 	return
 }
 
@@ -2260,6 +2353,8 @@ func (v *Video) parseQueryRows(db *system.DB, rows *sql.Rows, userID uint64, wee
 		videos = append(videos, video)
 	}
 
+	setVideoListDetails(db, videos)
+
 	return
 }
 
@@ -2307,6 +2402,8 @@ func (v *Video) parseQueryRows2(db *system.DB, rows *sql.Rows, userID uint64, we
 			&video.Publisher.AccountType,
 			&video.Publisher.CreatedAt,
 			&video.Publisher.UpdatedAt,
+			&video.Publisher.IsVerified,
+			&video.Publisher.VerifiedAt,
 			&video.Publisher.IsFollowing,
 			&boostID,
 			&boostUserID,
@@ -2373,6 +2470,8 @@ func (v *Video) parseQueryRows2(db *system.DB, rows *sql.Rows, userID uint64, we
 		videos = append(videos, video)
 	}
 
+	setVideoListDetails(db, videos)
+
 	return
 }
 
@@ -0,0 +1,353 @@
+package models
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	pq "github.com/lib/pq"
+	"github.com/rathvong/talentmob_server/system"
+)
+
+// Limits when a creator edits a video
+const (
+	MaxVideoTitleLength = 100
+	MaxVideoTags        = 10
+)
+
+var ErrorVideoEditLocked = errors.New("video can no longer be edited once voting has ended")
+
+// VideoEdit keeps a record of every change a creator makes
+// to the title, categories or thumbnail of their video.
+// Empty fields in an edit request are left unchanged.
+type VideoEdit struct {
+	BaseModel
+	VideoID            uint64 `json:"video_id"`
+	UserID             uint64 `json:"user_id"`
+	Title              string `json:"title"`
+	Categories         string `json:"categories"`
+	Thumbnail          string `json:"thumbnail"`
+	PreviousTitle      string `json:"previous_title"`
+	PreviousCategories string `json:"previous_categories"`
+	PreviousThumbnail  string `json:"previous_thumbnail"`
+}
+
+func (e *VideoEdit) queryCreate() (qry string) {
+	return `INSERT INTO video_edits
+						(video_id,
+						user_id,
+						title,
+						categories,
+						thumbnail,
+						previous_title,
+						previous_categories,
+						previous_thumbnail,
+						created_at,
+						updated_at)
+				VALUES
+						($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+				RETURNING id`
+}
+
+// SQL query to update the editable fields of a video.
+// The tsvector_update_on_videos trigger rebuilds the search meta.
+func (e *VideoEdit) queryUpdateVideo() (qry string) {
+	return `UPDATE videos SET
+						title = $2,
+						categories = $3,
+						thumbnail = $4,
+						updated_at = $5
+				WHERE id = $1`
+}
+
+// SQL query to remove tags from a video and take the video
+// out of the count of each category, the inverse of
+// Category.CreateNewCategoriesFromTags.
+// The rows are deleted so unique_idx_on_tags lets the tag be added back,
+// tags deactivated by earlier edits are cleared without changing the count.
+func (e *VideoEdit) queryRemoveTags() (qry string) {
+	return `WITH removed AS (
+					DELETE FROM tags
+					WHERE video_id = $1
+					AND (title = ANY($2) OR is_active = false)
+					RETURNING category_id, is_active
+				)
+				UPDATE categories SET
+						video_count = GREATEST(categories.video_count - removed.count, 0),
+						updated_at = $3
+				FROM (SELECT category_id, COUNT(*) as count FROM removed WHERE is_active = true GROUP BY category_id) removed
+				WHERE categories.id = removed.category_id`
+}
+
+func (e *VideoEdit) queryGetForVideo() (qry string) {
+	return `SELECT	id,
+					video_id,
+					user_id,
+					title,
+					categories,
+					thumbnail,
+					previous_title,
+					previous_categories,
+					previous_thumbnail,
+					created_at,
+					updated_at
+			FROM video_edits
+			WHERE video_id = $1
+			ORDER BY created_at DESC, id DESC
+			LIMIT $2
+			OFFSET $3`
+}
+
+func (e *VideoEdit) validateCreateErrors() (err error) {
+	if e.VideoID == 0 {
+		return e.Errors(ErrorMissingValue, "video_id")
+	}
+
+	if e.UserID == 0 {
+		return e.Errors(ErrorMissingValue, "user_id")
+	}
+
+	if e.Title == "" && e.Categories == "" && e.Thumbnail == "" {
+		return e.Errors(ErrorMissingValue, "title, categories or thumbnail")
+	}
+
+	if len([]rune(e.Title)) > MaxVideoTitleLength {
+		return e.Errors(ErrorIncorrectValue, "title")
+	}
+
+	if e.Categories != "" {
+		tags := ParseTags(e.Categories)
+
+		if len(tags) == 0 || len(tags) > MaxVideoTags {
+			return e.Errors(ErrorIncorrectValue, "categories")
+		}
+	}
+
+	return
+}
+
+// Split the categories of a video into unique tags. Tags are stored
+// the way NormalizeTag writes them so edits find the stored rows.
+func ParseTags(categories string) (tags []string) {
+	seen := make(map[string]bool)
+
+	for _, tag := range strings.Split(categories, "#") {
+		tag = NormalizeTag(tag)
+
+		if tag == "" || seen[tag] {
+			continue
+		}
+
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+
+	return
+}
+
+// Lower case tag without surrounding spaces
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// Tags found in a but not in b
+func diffTags(a []string, b []string) (diff []string) {
+	found := make(map[string]bool)
+
+	for _, tag := range b {
+		found[tag] = true
+	}
+
+	for _, tag := range a {
+		if !found[tag] {
+			diff = append(diff, tag)
+		}
+	}
+
+	return
+}
+
+// A video can be edited until voting has closed on any
+// competition it was entered in
+func (v *Video) IsEditable(db *system.DB) (editable bool, err error) {
+	var competitor Competitor
+
+	competitions, err := competitor.GetAllCompetitionsByVideoID(db, v.ID)
+
+	if err != nil {
+		return
+	}
+
+	for _, competition := range competitions {
+		if !competition.IsVoteUpdateable() {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// Apply an edit from the owner of the video.
+// Tags removed from the categories are deleted and taken out
+// of the category video counts, new tags are registered the same way
+// as an upload. The edit is stored in video_edits.
+func (v *Video) Edit(db *system.DB, edit *VideoEdit) (err error) {
+
+	if v.ID == 0 {
+		return v.Errors(ErrorMissingID, "id")
+	}
+
+	edit.VideoID = v.ID
+	edit.Title = strings.TrimSpace(edit.Title)
+	edit.Categories = strings.TrimSpace(edit.Categories)
+	edit.Thumbnail = strings.TrimSpace(edit.Thumbnail)
+
+	if err = edit.validateCreateErrors(); err != nil {
+		return
+	}
+
+	if edit.UserID != v.UserID {
+		return v.Errors(ErrorIncorrectValue, "user_id")
+	}
+
+	editable, err := v.IsEditable(db)
+
+	if err != nil {
+		return
+	}
+
+	if !editable {
+		return ErrorVideoEditLocked
+	}
+
+	edit.PreviousTitle = v.Title
+	edit.PreviousCategories = v.Categories
+	edit.PreviousThumbnail = v.Thumbnail
+
+	if edit.Title == "" {
+		edit.Title = v.Title
+	}
+
+	if edit.Categories == "" {
+		edit.Categories = v.Categories
+	}
+
+	if edit.Thumbnail == "" {
+		edit.Thumbnail = v.Thumbnail
+	}
+
+	previousTags := ParseTags(v.Categories)
+	tags := ParseTags(edit.Categories)
+
+	removed := diffTags(previousTags, tags)
+	added := diffTags(tags, previousTags)
+
+	tx, err := db.Begin()
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			tx.Rollback()
+			return
+		}
+
+		if len(added) > 0 {
+			category := Category{}
+			category.CreateNewCategoriesFromTags(db, strings.Join(added, "#"), *v)
+		}
+	}()
+
+	if err != nil {
+		log.Println("Video.Edit() Begin() Error -> ", err)
+		return
+	}
+
+	edit.CreatedAt = time.Now()
+	edit.UpdatedAt = time.Now()
+
+	if _, err = tx.Exec(edit.queryUpdateVideo(), v.ID, edit.Title, edit.Categories, edit.Thumbnail, edit.UpdatedAt); err != nil {
+		log.Printf("Video.Edit() id -> %v Exec() -> %v Error -> %v", v.ID, edit.queryUpdateVideo(), err)
+		return
+	}
+
+	if len(removed) > 0 || len(added) > 0 {
+		if _, err = tx.Exec(edit.queryRemoveTags(), v.ID, pq.Array(removed), edit.UpdatedAt); err != nil {
+			log.Printf("Video.Edit() id -> %v Exec() -> %v Error -> %v", v.ID, edit.queryRemoveTags(), err)
+			return
+		}
+	}
+
+	err = tx.QueryRow(edit.queryCreate(),
+		edit.VideoID,
+		edit.UserID,
+		edit.Title,
+		edit.Categories,
+		edit.Thumbnail,
+		edit.PreviousTitle,
+		edit.PreviousCategories,
+		edit.PreviousThumbnail,
+		edit.CreatedAt,
+		edit.UpdatedAt,
+	).Scan(&edit.ID)
+
+	if err != nil {
+		log.Printf("Video.Edit() id -> %v QueryRow() -> %v Error -> %v", v.ID, edit.queryCreate(), err)
+		return
+	}
+
+	v.Title = edit.Title
+	v.Categories = edit.Categories
+	v.Thumbnail = edit.Thumbnail
+	v.UpdatedAt = edit.UpdatedAt
+
+	return
+}
+
+// Retrieve the edit history of a video, newest first
+func (e *VideoEdit) GetForVideo(db *system.DB, videoID uint64, page int) (edits []VideoEdit, err error) {
+
+	if videoID == 0 {
+		return edits, e.Errors(ErrorMissingValue, "video_id")
+	}
+
+	rows, err := db.Query(e.queryGetForVideo(), videoID, LimitQueryPerRequest, OffSet(page))
+
+	if err != nil {
+		log.Printf("VideoEdit.GetForVideo() video_id -> %v Query() -> %v Error -> %v", videoID, e.queryGetForVideo(), err)
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		edit := VideoEdit{}
+
+		err = rows.Scan(
+			&edit.ID,
+			&edit.VideoID,
+			&edit.UserID,
+			&edit.Title,
+			&edit.Categories,
+			&edit.Thumbnail,
+			&edit.PreviousTitle,
+			&edit.PreviousCategories,
+			&edit.PreviousThumbnail,
+			&edit.CreatedAt,
+			&edit.UpdatedAt,
+		)
+
+		if err != nil {
+			log.Println("VideoEdit.GetForVideo() Error -> ", err)
+			return
+		}
+
+		edits = append(edits, edit)
+	}
+
+	return
+}
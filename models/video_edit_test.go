@@ -0,0 +1,44 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTags(t *testing.T) {
+	tests := []struct {
+		categories string
+		want       []string
+	}{
+		{"", nil},
+		{"#dance", []string{"dance"}},
+		{"#Dance #music", []string{"dance", "music"}},
+		{" #dance#  Music  #", []string{"dance", "music"}},
+		{"#dance #DANCE #music", []string{"dance", "music"}},
+		{"comedy #dance", []string{"comedy", "dance"}},
+	}
+
+	for _, test := range tests {
+		if got := ParseTags(test.categories); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseTags(%q) = %v, want %v", test.categories, got, test.want)
+		}
+	}
+}
+
+func TestNormalizeTag(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want string
+	}{
+		{"dance", "dance"},
+		{" Dance ", "dance"},
+		{"HIP HOP", "hip hop"},
+		{"  ", ""},
+	}
+
+	for _, test := range tests {
+		if got := NormalizeTag(test.tag); got != test.want {
+			t.Errorf("NormalizeTag(%q) = %q, want %q", test.tag, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package models
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/lib/pq"
+	"github.com/rathvong/talentmob_server/system"
+)
+
+// Processing states of a video
+const (
+	VideoProcessingPending    = "pending"
+	VideoProcessingProcessing = "processing"
+	VideoProcessingReady      = "ready"
+	VideoProcessingFailed     = "failed"
+)
+
+// Outputs a video can be played from
+const (
+	VideoOutputOriginal  = "original"
+	VideoOutputTranscode = "transcode"
+	VideoOutputWatermark = "watermark"
+	VideoOutputHLS       = "hls"
+)
+
+// How far along a job is in each state
+var transcodeJobProgress = map[string]int{
+	TranscodeJobQueued:      0,
+	TranscodeJobSubmitted:   10,
+	TranscodeJobProgressing: 50,
+	TranscodeJobCompleted:   100,
+	TranscodeJobError:       0,
+}
+
+// A file a video can be played from, IsReady is
+// false until the transcoder has written it
+type VideoOutput struct {
+	Name    string `json:"name"`
+	Key     string `json:"key"`
+	IsReady bool   `json:"is_ready"`
+}
+
+// Processing status of a video for its creator and the apps.
+// It combines the latest job of each kind with the outputs
+// that can be played so far.
+type VideoProcessing struct {
+	VideoID  uint64         `json:"video_id"`
+	State    string         `json:"state"`
+	Progress int            `json:"progress"`
+	Error    string         `json:"error"`
+	Jobs     []TranscodeJob `json:"jobs"`
+	Outputs  []VideoOutput  `json:"outputs"`
+}
+
+// SQL query for the playback keys of a page of videos
+func (v *Video) queryPlaybackKeys() (qry string) {
+	return `SELECT	videos.id,
+					transcoded.transcoded_key,
+					transcoded.completed_transcode,
+					EXISTS(SELECT 1 FROM renditions WHERE renditions.video_id = videos.id)
+			FROM videos
+			LEFT JOIN LATERAL (
+				SELECT	transcoded_key,
+						completed_transcode
+				FROM transcoded
+				WHERE transcoded.video_id = videos.id
+				ORDER BY transcoded.id DESC
+				LIMIT 1) transcoded
+			ON true
+			WHERE videos.id = ANY($1)`
+}
+
+// Mark the creator as told about the outcome of processing, a video
+// reprocessed by an admin task does not notify its creator again
+func (v *Video) queryMarkProcessingNotified() (qry string) {
+	return `UPDATE videos SET
+						processing_notified = true
+				WHERE id = $1
+				AND processing_notified = false
+				RETURNING user_id`
+}
+
+// Set the key the apps should play. The original upload is
+// played until the transcoded video is ready. StreamURL is set
+// once the HLS renditions have been written.
+func (v *Video) SetPlaybackKey(db *system.DB) (err error) {
+	videos := []Video{*v}
+
+	err = SetPlaybackKeys(db, videos)
+
+	v.PlaybackKey = videos[0].PlaybackKey
+	v.IsProcessed = videos[0].IsProcessed
+	v.StreamURL = videos[0].StreamURL
+
+	return
+}
+
+// Set the playback keys of a page of videos in one query
+func SetPlaybackKeys(db *system.DB, videos []Video) (err error) {
+
+	if len(videos) == 0 {
+		return
+	}
+
+	var v Video
+
+	ids := make([]int64, len(videos))
+
+	for i := range videos {
+		videos[i].PlaybackKey = videos[i].Key
+		videos[i].IsProcessed = false
+		videos[i].StreamURL = ""
+
+		ids[i] = int64(videos[i].ID)
+	}
+
+	rows, err := db.Query(v.queryPlaybackKeys(), pq.Array(ids))
+
+	if err != nil {
+		log.Printf("SetPlaybackKeys() Query() -> %v Error -> %v", v.queryPlaybackKeys(), err)
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uint64
+		var key sql.NullString
+		var completed sql.NullBool
+		var streamable bool
+
+		if err = rows.Scan(&id, &key, &completed, &streamable); err != nil {
+			log.Println("SetPlaybackKeys() Error -> ", err)
+			return
+		}
+
+		for i := range videos {
+			if videos[i].ID != id {
+				continue
+			}
+
+			if completed.Bool && key.String != "" {
+				videos[i].PlaybackKey = key.String
+				videos[i].IsProcessed = true
+			}
+
+			if streamable {
+				videos[i].StreamURL = StreamURL(id)
+			}
+		}
+	}
+
+	return
+}
+
+// Retrieve the processing status of a video
+func (p *VideoProcessing) Get(db *system.DB, video Video) (err error) {
+
+	var job TranscodeJob
+
+	jobs, err := job.GetForVideo(db, video.ID)
+
+	if err != nil {
+		return
+	}
+
+	p.VideoID = video.ID
+	p.Jobs = make([]TranscodeJob, 0)
+	p.Outputs = []VideoOutput{{Name: VideoOutputOriginal, Key: video.Key, IsReady: true}}
+
+	// jobs are newest first, only the latest of each kind counts
+	for _, j := range jobs {
+		if !p.hasKind(j.Kind) {
+			p.Jobs = append(p.Jobs, j)
+		}
+	}
+
+	transcoded := Transcoded{}
+
+	if exists, err := transcoded.Exists(db, video.ID); err != nil {
+		return err
+	} else if exists {
+		if err = transcoded.GetByVideoID(db, video.ID); err != nil {
+			return err
+		}
+
+		p.Outputs = append(p.Outputs,
+			VideoOutput{Name: VideoOutputTranscode, Key: transcoded.TranscodedKey, IsReady: transcoded.TranscodedCompleted},
+			VideoOutput{Name: VideoOutputWatermark, Key: transcoded.TranscodedWatermarkKey, IsReady: transcoded.WatermarkCompleted},
+		)
+	}
+
+	var rendition Rendition
+
+	renditions, err := rendition.GetForVideo(db, video.ID)
+
+	if err != nil {
+		return
+	}
+
+	p.Outputs = append(p.Outputs, VideoOutput{Name: VideoOutputHLS, Key: StreamURL(video.ID), IsReady: len(renditions) > 0})
+
+	p.setState(transcoded)
+
+	return
+}
+
+func (p *VideoProcessing) hasKind(kind string) bool {
+	for _, j := range p.Jobs {
+		if j.Kind == kind {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Work out the state from the jobs. Videos transcoded before jobs
+// were tracked have no jobs and are ready when Transcoded says so.
+func (p *VideoProcessing) setState(transcoded Transcoded) {
+
+	if len(p.Jobs) == 0 {
+		p.State = VideoProcessingPending
+
+		if transcoded.TranscodedCompleted && transcoded.WatermarkCompleted {
+			p.State = VideoProcessingReady
+			p.Progress = 100
+		}
+
+		return
+	}
+
+	completed := 0
+	progress := 0
+
+	for _, j := range p.Jobs {
+		progress += transcodeJobProgress[j.State]
+
+		switch {
+		case j.State == TranscodeJobCompleted:
+			completed++
+		case j.State == TranscodeJobError:
+			p.State = VideoProcessingFailed
+			p.Error = j.LastError
+		case j.LastError != "":
+			// failed before and waiting to be retried
+			p.Error = j.LastError
+		}
+	}
+
+	p.Progress = progress / len(p.Jobs)
+
+	if p.State == VideoProcessingFailed {
+		return
+	}
+
+	// videos queued before a job kind was added are ready
+	// once the jobs they were queued with have completed
+	if completed == len(p.Jobs) {
+		p.State = VideoProcessingReady
+		p.Progress = 100
+		p.Error = ""
+		return
+	}
+
+	p.State = VideoProcessingProcessing
+}
+
+// Tell the creator once a video has finished processing or has
+// failed for good. Nothing is sent while jobs are still running.
+func (j *TranscodeJob) notifyCreator(db *system.DB) {
+
+	if j.State != TranscodeJobCompleted && j.State != TranscodeJobError {
+		return
+	}
+
+	video := Video{}
+
+	if err := video.GetVideoByID(db, j.VideoID); err != nil {
+		return
+	}
+
+	processing := VideoProcessing{}
+
+	if err := processing.Get(db, video); err != nil {
+		log.Println("TranscodeJob.notifyCreator() Error -> ", err)
+		return
+	}
+
+	verb := VERB_PROCESSED
+
+	switch processing.State {
+	case VideoProcessingReady:
+	case VideoProcessingFailed:
+		verb = VERB_PROCESS_FAILED
+	default:
+		return
+	}
+
+	var userID uint64
+
+	err := db.QueryRow(video.queryMarkProcessingNotified(), video.ID).Scan(&userID)
+
+	if err == sql.ErrNoRows {
+		return
+	}
+
+	if err != nil {
+		log.Printf("TranscodeJob.notifyCreator() video_id -> %v QueryRow() -> %v Error -> %v", video.ID, video.queryMarkProcessingNotified(), err)
+		return
+	}
+
+	if err = Notify(db, userID, userID, verb, video.ID, OBJECT_VIDEO); err != nil {
+		log.Println("TranscodeJob.notifyCreator() Notify() Error -> ", err)
+	}
+}
@@ -0,0 +1,320 @@
+package models
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/rathvong/talentmob_server/system"
+)
+
+// Publishing states of a video.
+// Drafts and scheduled videos are stored inactive so they
+// are left out of every feed until they are published.
+const (
+	VideoStatusPublished = "published"
+	VideoStatusDraft     = "draft"
+	VideoStatusScheduled = "scheduled"
+)
+
+var VideoStatuses = []string{VideoStatusPublished, VideoStatusDraft, VideoStatusScheduled}
+
+var ErrorVideoPublished = errors.New("video has already been published")
+
+// SQL query to take a draft or scheduled video live.
+// Only one caller can claim the video so the publish
+// steps never run twice.
+func (v *Video) queryPublish() (qry string) {
+	return `UPDATE videos SET
+						status = 'published',
+						is_active = true,
+						publish_at = NULL,
+						created_at = $2,
+						updated_at = $2
+				WHERE id = $1
+				AND status != 'published'
+				RETURNING id`
+}
+
+func (v *Video) querySchedule() (qry string) {
+	return `UPDATE videos SET
+						status = $2,
+						publish_at = $3,
+						updated_at = $4
+				WHERE id = $1
+				AND status != 'published'`
+}
+
+func (v *Video) queryDeleteDraft() (qry string) {
+	return `DELETE FROM videos
+				WHERE id = $1
+				AND status != 'published'`
+}
+
+func (v *Video) queryGetDrafts() (qry string) {
+	return `SELECT	id,
+					user_id,
+					categories,
+					thumbnail,
+					key,
+					title,
+					status,
+					publish_at,
+					COALESCE(event_id, 0),
+					created_at,
+					updated_at
+			FROM videos
+			WHERE user_id = $1
+			AND status != 'published'
+			ORDER BY publish_at ASC NULLS LAST, created_at DESC
+			LIMIT $2
+			OFFSET $3`
+}
+
+// SQL query for scheduled videos that are due
+func (v *Video) queryGetDueScheduled() (qry string) {
+	return `SELECT	id
+			FROM videos
+			WHERE status = 'scheduled'
+			AND publish_at <= $1
+			ORDER BY publish_at ASC`
+}
+
+// Check the publishing state of a new video, an empty
+// status publishes straight away
+func (v *Video) validatePublishing() (err error) {
+
+	if v.Status == "" {
+		v.Status = VideoStatusPublished
+	}
+
+	if !containsString(VideoStatuses, v.Status) {
+		return v.Errors(ErrorIncorrectValue, "status")
+	}
+
+	switch v.Status {
+	case VideoStatusScheduled:
+		if v.PublishAt == nil || v.PublishAt.Before(time.Now()) {
+			return v.Errors(ErrorIncorrectValue, "publish_at")
+		}
+
+		// clients send the time with their offset, publish_at has no time zone
+		publishAt := v.PublishAt.UTC()
+		v.PublishAt = &publishAt
+	default:
+		v.PublishAt = nil
+	}
+
+	return
+}
+
+// Check if a video is live
+func (v *Video) IsPublished() bool {
+	return v.Status == "" || v.Status == VideoStatusPublished
+}
+
+// Steps run once a video goes live. The video is queued to be
+// fingerprinted, which registers it in this weeks competition once
+// it is cleared. It is entered in any event it was uploaded for, new
+// categories are created, the creator of a video it responds to
+// is notified and transcoding is started.
+func (v *Video) runPublishSteps(db *system.DB) (err error) {
+
+	// Register video in this weeks competition and its event after the duplicate check
+	if err = QueueFingerprint(db, *v); err != nil {
+		log.Println("QueueFingerprint() Error -> ", err)
+	}
+
+	// Create new categories
+	category := Category{}
+	category.CreateNewCategoriesFromTags(db, v.Categories, *v)
+
+	// an upload activates a referred user
+	ActivateReferral(db, v.UserID)
+
+	v.notifyReplyTo(db)
+
+	// the transcode worker picks the jobs up from the queue
+	if err := QueueTranscodeJobs(db, *v); err != nil {
+		log.Println("QueueTranscodeJobs() Error -> ", err)
+	}
+
+	return
+}
+
+// Publish a draft or scheduled video now. The video is dated
+// from the moment it goes live so it is treated as a new upload.
+func (v *Video) Publish(db *system.DB) (err error) {
+
+	if v.ID == 0 {
+		return v.Errors(ErrorMissingID, "id")
+	}
+
+	if v.IsPublished() {
+		return ErrorVideoPublished
+	}
+
+	publishedAt := time.Now()
+
+	var id uint64
+
+	if err = db.QueryRow(v.queryPublish(), v.ID, publishedAt).Scan(&id); err != nil {
+		log.Printf("Video.Publish() id -> %v QueryRow() -> %v Error -> %v", v.ID, v.queryPublish(), err)
+		return
+	}
+
+	v.Status = VideoStatusPublished
+	v.IsActive = true
+	v.PublishAt = nil
+	v.CreatedAt = publishedAt
+	v.UpdatedAt = publishedAt
+
+	if err := v.runPublishSteps(db); err != nil {
+		log.Println("Video.Publish() runPublishSteps() Error -> ", err)
+	}
+
+	return
+}
+
+// Move an unpublished video between draft and scheduled,
+// a scheduled video needs a publish time in the future
+func (v *Video) Schedule(db *system.DB, status string, publishAt *time.Time) (err error) {
+
+	if v.ID == 0 {
+		return v.Errors(ErrorMissingID, "id")
+	}
+
+	if v.IsPublished() {
+		return ErrorVideoPublished
+	}
+
+	if status == VideoStatusPublished {
+		return v.Errors(ErrorIncorrectValue, "status")
+	}
+
+	v.Status = status
+	v.PublishAt = publishAt
+
+	if err = v.validatePublishing(); err != nil {
+		return
+	}
+
+	v.UpdatedAt = time.Now()
+
+	if _, err = db.Exec(v.querySchedule(), v.ID, v.Status, v.PublishAt, v.UpdatedAt); err != nil {
+		log.Printf("Video.Schedule() id -> %v Exec() -> %v Error -> %v", v.ID, v.querySchedule(), err)
+	}
+
+	return
+}
+
+// Remove a draft or scheduled video, nothing else refers
+// to a video before it is published
+func (v *Video) DeleteDraft(db *system.DB) (err error) {
+
+	if v.ID == 0 {
+		return v.Errors(ErrorMissingID, "id")
+	}
+
+	if v.IsPublished() {
+		return ErrorVideoPublished
+	}
+
+	if _, err = db.Exec(v.queryDeleteDraft(), v.ID); err != nil {
+		log.Printf("Video.DeleteDraft() id -> %v Exec() -> %v Error -> %v", v.ID, v.queryDeleteDraft(), err)
+	}
+
+	return
+}
+
+// Retrieve a users drafts and scheduled videos, the next
+// to be published first
+func (v *Video) GetDrafts(db *system.DB, userID uint64, page int) (videos []Video, err error) {
+
+	if userID == 0 {
+		return videos, v.Errors(ErrorMissingValue, "user_id")
+	}
+
+	rows, err := db.Query(v.queryGetDrafts(), userID, LimitQueryPerRequest, OffSet(page))
+
+	if err != nil {
+		log.Printf("Video.GetDrafts() user_id -> %v Query() -> %v Error -> %v", userID, v.queryGetDrafts(), err)
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		video := Video{}
+
+		err = rows.Scan(
+			&video.ID,
+			&video.UserID,
+			&video.Categories,
+			&video.Thumbnail,
+			&video.Key,
+			&video.Title,
+			&video.Status,
+			&video.PublishAt,
+			&video.EventID,
+			&video.CreatedAt,
+			&video.UpdatedAt,
+		)
+
+		if err != nil {
+			log.Println("Video.GetDrafts() Error -> ", err)
+			return
+		}
+
+		videos = append(videos, video)
+	}
+
+	setVideoListDetails(db, videos)
+
+	return
+}
+
+// Publish every scheduled video that is due
+func PublishScheduledVideos(db *system.DB) (err error) {
+	var v Video
+
+	rows, err := db.Query(v.queryGetDueScheduled(), time.Now().UTC())
+
+	if err != nil {
+		log.Printf("PublishScheduledVideos() Query() -> %v Error -> %v", v.queryGetDueScheduled(), err)
+		return
+	}
+
+	var ids []uint64
+
+	for rows.Next() {
+		var id uint64
+
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			log.Println("PublishScheduledVideos() Error -> ", err)
+			return
+		}
+
+		ids = append(ids, id)
+	}
+
+	rows.Close()
+
+	for _, id := range ids {
+		video := Video{}
+
+		if err := video.GetVideoByID(db, id); err != nil {
+			continue
+		}
+
+		if err := video.Publish(db); err != nil {
+			log.Printf("PublishScheduledVideos() id -> %v Error -> %v", id, err)
+			continue
+		}
+
+		log.Println("PublishScheduledVideos() published -> ", id)
+	}
+
+	return nil
+}
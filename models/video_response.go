@@ -0,0 +1,182 @@
+package models
+
+import (
+	"errors"
+	"log"
+
+	"github.com/lib/pq"
+	"github.com/rathvong/talentmob_server/system"
+)
+
+var ErrorVideoResponseUnavailable = errors.New("video is not available for responses")
+
+// SQL query for the responses to a video, most voted first.
+// Responses are hidden when the original video is removed, when
+// the responder and the original creator or the viewer have blocked
+// each other, or when the responder is shadowbanned.
+func (v *Video) queryResponses() (qry string) {
+	return `SELECT	videos.id,
+					videos.user_id,
+					videos.categories,
+					videos.downvotes,
+					videos.upvotes,
+					videos.shares,
+					videos.views,
+					videos.comments,
+					videos.thumbnail,
+					videos.key,
+					videos.title,
+					videos.created_at,
+					videos.updated_at,
+					videos.is_active,
+					videos.upvote_trending_count
+			FROM videos
+			INNER JOIN videos original
+			ON original.id = videos.reply_to_video_id
+			AND original.is_active = true
+			AND (original.user_id = $2 OR NOT is_shadowbanned(original.user_id))
+			WHERE videos.reply_to_video_id = $1
+			AND videos.is_active = true
+			AND (videos.user_id = $2 OR NOT is_shadowbanned(videos.user_id))
+			AND NOT EXISTS (SELECT 1 FROM relationships
+						WHERE relationships.relationship_type = 'block'
+						AND relationships.is_active = true
+						AND ((relationships.followed_id = videos.user_id AND relationships.follower_id IN ($2, original.user_id))
+						OR (relationships.follower_id = videos.user_id AND relationships.followed_id IN ($2, original.user_id))))
+			ORDER BY videos.upvotes DESC, videos.downvotes ASC, videos.created_at DESC
+			LIMIT $3
+			OFFSET $4`
+}
+
+// SQL query for the response counts of a page of videos
+func (v *Video) queryResponseCounts() (qry string) {
+	return `SELECT	id,
+					responses
+			FROM videos
+			WHERE id = ANY($1)`
+}
+
+// Check the video being responded to can still be answered.
+// A user can not respond to a removed video or to a creator
+// they have blocked or been blocked by.
+func (v *Video) validateReplyTo(db *system.DB) (err error) {
+
+	if v.ReplyToVideoID == 0 {
+		return
+	}
+
+	original := Video{}
+
+	if err = original.GetVideoByID(db, v.ReplyToVideoID); err != nil {
+		return v.Errors(ErrorIncorrectValue, "reply_to_video_id")
+	}
+
+	if !original.IsActive || !original.IsPublished() {
+		return ErrorVideoResponseUnavailable
+	}
+
+	if original.UserID == v.UserID {
+		return
+	}
+
+	if IsShadowbanned(db, original.UserID) {
+		return ErrorVideoResponseUnavailable
+	}
+
+	var relationship Relationship
+
+	blocked, err := relationship.IsBlocked(db, v.UserID, original.UserID)
+
+	if err != nil {
+		return
+	}
+
+	if blocked {
+		return ErrorVideoResponseUnavailable
+	}
+
+	return
+}
+
+// Let the original creator know a response has been published
+func (v *Video) notifyReplyTo(db *system.DB) {
+
+	if v.ReplyToVideoID == 0 {
+		return
+	}
+
+	original := Video{}
+
+	if err := original.GetVideoByID(db, v.ReplyToVideoID); err != nil {
+		return
+	}
+
+	if !original.IsActive || original.UserID == v.UserID {
+		return
+	}
+
+	if err := Notify(db, v.UserID, original.UserID, VERB_RESPONDED, original.ID, OBJECT_VIDEO); err != nil {
+		log.Println("Video.notifyReplyTo() Notify() Error -> ", err)
+	}
+}
+
+// Retrieve the responses to a video visible to the current user
+func (v *Video) GetResponses(db *system.DB, videoID uint64, currentUserID uint64, page int) (videos []Video, err error) {
+
+	if videoID == 0 {
+		return videos, v.Errors(ErrorMissingValue, "video_id")
+	}
+
+	rows, err := db.Query(v.queryResponses(), videoID, currentUserID, LimitQueryPerRequest, OffSet(page))
+
+	if err != nil {
+		log.Printf("Video.GetResponses() video_id -> %v Query() -> %v Error -> %v", videoID, v.queryResponses(), err)
+		return
+	}
+
+	defer rows.Close()
+
+	return v.parseRows(db, rows, currentUserID, 0)
+}
+
+// Set the response counts of a page of videos in one query
+func SetResponseCounts(db *system.DB, videos []Video) (err error) {
+
+	if len(videos) == 0 {
+		return
+	}
+
+	var v Video
+
+	ids := make([]int64, len(videos))
+
+	for i := range videos {
+		ids[i] = int64(videos[i].ID)
+	}
+
+	rows, err := db.Query(v.queryResponseCounts(), pq.Array(ids))
+
+	if err != nil {
+		log.Printf("SetResponseCounts() Query() -> %v Error -> %v", v.queryResponseCounts(), err)
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, responses uint64
+
+		if err = rows.Scan(&id, &responses); err != nil {
+			log.Println("SetResponseCounts() Error -> ", err)
+			return
+		}
+
+		for i := range videos {
+			if videos[i].ID == id {
+				videos[i].Responses = responses
+			}
+		}
+	}
+
+	return
+}
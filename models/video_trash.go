@@ -0,0 +1,636 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rathvong/talentmob_server/storage"
+	"github.com/rathvong/talentmob_server/system"
+	"github.com/rathvong/talentmob_server/transcoder"
+)
+
+const (
+	// Videos purged in one run of the purge job
+	trashPurgeBatchSize = 20
+
+	// Thumbnails the transcoder extracts from a video at most
+	trashPurgeThumbnails = 5
+)
+
+// How long a deleted video can be restored for before it is purged,
+// set with VIDEO_TRASH_RETENTION_DAYS
+var VideoTrashRetention = trashRetention(os.Getenv("VIDEO_TRASH_RETENTION_DAYS"), 30)
+
+var (
+	ErrorVideoNotInTrash = errors.New("video is not in the trash")
+	ErrorTrashExpired    = errors.New("video can no longer be restored")
+	ErrorVideoTakenDown  = errors.New("video was removed by a moderator and can not be restored")
+)
+
+func trashRetention(value string, fallback int) time.Duration {
+	days, err := strconv.Atoi(value)
+
+	if err != nil || days <= 0 {
+		days = fallback
+	}
+
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// SQL query to move a video to the trash. A video hidden by open
+// reports can still be trashed by its owner, a video taken down by
+// a moderator is already gone.
+func (v *Video) queryTrash() (qry string) {
+	return `UPDATE videos SET
+						is_active = false,
+						deleted_at = $2,
+						updated_at = $2
+				WHERE id = $1
+				AND deleted_at IS NULL
+				AND (is_active = true
+					OR EXISTS(SELECT 1 FROM reports
+							WHERE reports.object_type = 'video'
+							AND reports.object_id = videos.id
+							AND reports.status <> 'resolved'
+							AND reports.hidden = true))
+				AND NOT EXISTS(SELECT 1 FROM reports
+							WHERE reports.object_type = 'video'
+							AND reports.object_id = videos.id
+							AND reports.resolution = 'takedown')`
+}
+
+// A video taken down by a moderator or hidden by open
+// reports can not be brought back by restoring it
+func (v *Video) queryGetTrashedForUpdate() (qry string) {
+	return `SELECT	deleted_at,
+					EXISTS(SELECT 1 FROM reports
+							WHERE reports.object_type = 'video'
+							AND reports.object_id = videos.id
+							AND (reports.resolution = 'takedown'
+								OR (reports.status <> 'resolved' AND reports.hidden = true)))
+			FROM videos
+			WHERE id = $1
+			AND user_id = $2
+			FOR UPDATE`
+}
+
+func (v *Video) queryRestore() (qry string) {
+	return `UPDATE videos SET
+						is_active = true,
+						deleted_at = NULL,
+						updated_at = $2
+				WHERE id = $1`
+}
+
+// Leave the competitions a video was entered in
+func (v *Video) queryDeactivateCompetitors() (qry string) {
+	return `UPDATE competitors SET
+						is_active = false,
+						updated_at = $2
+				WHERE video_id = $1
+				AND is_active = true
+				RETURNING event_id`
+}
+
+// Enter a restored video back in the competitions that are still open
+func (v *Video) queryReactivateCompetitors() (qry string) {
+	return `UPDATE competitors SET
+						is_active = true,
+						updated_at = $2
+				FROM events
+				WHERE competitors.video_id = $1
+				AND competitors.is_active = false
+				AND events.id = competitors.event_id
+				AND events.is_opened = true
+				AND events.end_date > $2
+				RETURNING competitors.event_id`
+}
+
+func (v *Video) queryUpdateCompetitorsCount() (qry string) {
+	return `UPDATE events SET
+						competitors_count = competitors_count + $2
+				WHERE id = $1`
+}
+
+func (v *Video) queryGetTrash() (qry string) {
+	return `SELECT	id,
+					user_id,
+					categories,
+					thumbnail,
+					key,
+					title,
+					status,
+					COALESCE(event_id, 0),
+					deleted_at,
+					created_at,
+					updated_at
+			FROM videos
+			WHERE user_id = $1
+			AND deleted_at > $2
+			ORDER BY deleted_at DESC
+			LIMIT $3
+			OFFSET $4`
+}
+
+// Videos that failed to purge are touched so they
+// do not hold up the videos behind them. Videos ranked in an
+// event are kept for the leaderboard history and never purged.
+func (v *Video) queryGetExpiredTrash() (qry string) {
+	return `SELECT	id,
+					user_id,
+					thumbnail,
+					key
+			FROM videos
+			WHERE deleted_at <= $1
+			AND NOT EXISTS(SELECT 1 FROM competitors
+							INNER JOIN event_rankings
+							ON event_rankings.competitor_id = competitors.id
+							WHERE competitors.video_id = videos.id)
+			ORDER BY updated_at ASC
+			LIMIT $2`
+}
+
+func (v *Video) queryTouchTrash() (qry string) {
+	return `UPDATE videos SET
+						updated_at = $2
+				WHERE id = $1
+				AND deleted_at IS NOT NULL`
+}
+
+// A key can be shared by videos the same user posted twice
+func (v *Video) queryKeyShared() (qry string) {
+	return `SELECT EXISTS(SELECT 1 FROM videos WHERE (key = $1 OR thumbnail = $1) AND id <> $2)`
+}
+
+// Comments and notifications are not covered by
+// delete_associations_for_videos and are removed first
+func (v *Video) queryPurgeNotifications() (qry string) {
+	return `DELETE FROM notifications
+				WHERE (object_type = 'video' AND object_id = $1)
+				OR (object_type = 'comment' AND object_id IN (SELECT id FROM comments WHERE video_id = $1))`
+}
+
+func (v *Video) queryPurgeComments() (qry string) {
+	return `DELETE FROM comments WHERE video_id = $1`
+}
+
+// The rest of the rows of a video are removed by delete_associations_for_videos
+func (v *Video) queryPurge() (qry string) {
+	return `DELETE FROM videos
+				WHERE id = $1
+				AND deleted_at IS NOT NULL`
+}
+
+// Change the competitor counts of the events returned by a competitors update
+func (v *Video) updateCompetitorsCounts(tx *sql.Tx, rows *sql.Rows, change int) (err error) {
+	var eventIDs []uint64
+
+	for rows.Next() {
+		var eventID uint64
+
+		if err = rows.Scan(&eventID); err != nil {
+			rows.Close()
+			return
+		}
+
+		eventIDs = append(eventIDs, eventID)
+	}
+
+	rows.Close()
+
+	for _, eventID := range eventIDs {
+		if _, err = tx.Exec(v.queryUpdateCompetitorsCount(), eventID, change); err != nil {
+			log.Printf("Video.updateCompetitorsCounts() event_id -> %v Exec() -> %v Error -> %v", eventID, v.queryUpdateCompetitorsCount(), err)
+			return
+		}
+	}
+
+	return
+}
+
+// Move a published video to the trash. It leaves its competitions
+// and can be restored by its owner until VideoTrashRetention passes.
+func (v *Video) Trash(db *system.DB) (err error) {
+
+	if v.ID == 0 {
+		return v.Errors(ErrorMissingID, "id")
+	}
+
+	tx, err := db.Begin()
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			tx.Rollback()
+			return
+		}
+	}()
+
+	if err != nil {
+		log.Println("Video.Trash() Begin() Error -> ", err)
+		return
+	}
+
+	now := time.Now()
+
+	res, err := tx.Exec(v.queryTrash(), v.ID, now)
+
+	if err != nil {
+		log.Printf("Video.Trash() id -> %v Exec() -> %v Error -> %v", v.ID, v.queryTrash(), err)
+		return
+	}
+
+	if count, _ := res.RowsAffected(); count == 0 {
+		return v.Errors(ErrorIncorrectValue, "id")
+	}
+
+	rows, err := tx.Query(v.queryDeactivateCompetitors(), v.ID, now)
+
+	if err != nil {
+		log.Printf("Video.Trash() id -> %v Query() -> %v Error -> %v", v.ID, v.queryDeactivateCompetitors(), err)
+		return
+	}
+
+	if err = v.updateCompetitorsCounts(tx, rows, -1); err != nil {
+		return
+	}
+
+	v.IsActive = false
+	v.DeletedAt = &now
+	v.UpdatedAt = now
+
+	return
+}
+
+// Take a video out of the trash. It is entered back in the
+// competitions it left only while their events are still open
+// and it is not held for a duplicate review.
+func (v *Video) Restore(db *system.DB, userID uint64) (err error) {
+
+	if v.ID == 0 {
+		return v.Errors(ErrorMissingID, "id")
+	}
+
+	if err = CheckSanction(db, userID, SanctionUploadSuspension, SanctionBan); err != nil {
+		return
+	}
+
+	held := false
+
+	if err = CheckFingerprint(db, v.ID); err == ErrorVideoUnderReview {
+		held = true
+		err = nil
+	} else if err != nil {
+		return
+	}
+
+	tx, err := db.Begin()
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			tx.Rollback()
+			return
+		}
+	}()
+
+	if err != nil {
+		log.Println("Video.Restore() Begin() Error -> ", err)
+		return
+	}
+
+	var deletedAt *time.Time
+	var takenDown bool
+
+	err = tx.QueryRow(v.queryGetTrashedForUpdate(), v.ID, userID).Scan(&deletedAt, &takenDown)
+
+	if err == sql.ErrNoRows || (err == nil && deletedAt == nil) {
+		return ErrorVideoNotInTrash
+	}
+
+	if err != nil {
+		log.Printf("Video.Restore() id -> %v QueryRow() -> %v Error -> %v", v.ID, v.queryGetTrashedForUpdate(), err)
+		return
+	}
+
+	if takenDown {
+		return ErrorVideoTakenDown
+	}
+
+	now := time.Now()
+
+	if now.Sub(*deletedAt) > VideoTrashRetention {
+		return ErrorTrashExpired
+	}
+
+	if _, err = tx.Exec(v.queryRestore(), v.ID, now); err != nil {
+		log.Printf("Video.Restore() id -> %v Exec() -> %v Error -> %v", v.ID, v.queryRestore(), err)
+		return
+	}
+
+	v.IsActive = true
+	v.DeletedAt = nil
+	v.UpdatedAt = now
+
+	if held {
+		return
+	}
+
+	rows, err := tx.Query(v.queryReactivateCompetitors(), v.ID, now)
+
+	if err != nil {
+		log.Printf("Video.Restore() id -> %v Query() -> %v Error -> %v", v.ID, v.queryReactivateCompetitors(), err)
+		return
+	}
+
+	err = v.updateCompetitorsCounts(tx, rows, 1)
+
+	return
+}
+
+// Retrieve the videos a user can still restore, most recently deleted first
+func (v *Video) GetTrash(db *system.DB, userID uint64, page int) (videos []Video, err error) {
+
+	if userID == 0 {
+		return videos, v.Errors(ErrorMissingValue, "user_id")
+	}
+
+	rows, err := db.Query(v.queryGetTrash(), userID, time.Now().Add(-VideoTrashRetention), LimitQueryPerRequest, OffSet(page))
+
+	if err != nil {
+		log.Printf("Video.GetTrash() user_id -> %v Query() -> %v Error -> %v", userID, v.queryGetTrash(), err)
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		video := Video{}
+
+		err = rows.Scan(
+			&video.ID,
+			&video.UserID,
+			&video.Categories,
+			&video.Thumbnail,
+			&video.Key,
+			&video.Title,
+			&video.Status,
+			&video.EventID,
+			&video.DeletedAt,
+			&video.CreatedAt,
+			&video.UpdatedAt,
+		)
+
+		if err != nil {
+			log.Println("Video.GetTrash() Error -> ", err)
+			return
+		}
+
+		purgeAt := video.DeletedAt.Add(VideoTrashRetention)
+		video.PurgeAt = &purgeAt
+
+		videos = append(videos, video)
+	}
+
+	setVideoListDetails(db, videos)
+
+	return
+}
+
+// Keys of every object stored for a video. Objects derived from the
+// upload are skipped when another video was posted with the same key.
+func (v *Video) storageKeys(db *system.DB, store storage.Storage) (keys []string, err error) {
+	var shared bool
+
+	for _, key := range []string{v.Key, v.Thumbnail} {
+		if key == "" {
+			continue
+		}
+
+		if err = db.QueryRow(v.queryKeyShared(), key, v.ID).Scan(&shared); err != nil {
+			log.Printf("Video.storageKeys() id -> %v QueryRow() -> %v Error -> %v", v.ID, v.queryKeyShared(), err)
+			return
+		}
+
+		if shared {
+			continue
+		}
+
+		keys = append(keys, key)
+
+		if key != v.Key {
+			continue
+		}
+
+		// a video that was never transcoded has no transcoded keys
+		transcoded := Transcoded{}
+
+		var exists bool
+
+		if exists, err = transcoded.Exists(db, v.ID); err != nil {
+			return
+		}
+
+		if exists {
+			if err = transcoded.GetByVideoID(db, v.ID); err != nil {
+				return
+			}
+
+			keys = append(keys, transcoded.TranscodedKey, transcoded.TranscodedWatermarkKey, transcoded.TranscodedThumbnailKey)
+
+			for i := 1; i <= trashPurgeThumbnails; i++ {
+				keys = append(keys, fmt.Sprintf("%s-%05d.png", v.Key, i), fmt.Sprintf("%s-%05d.jpg", v.Key, i))
+			}
+		}
+
+		var segments []string
+
+		if segments, err = v.renditionKeys(db, store); err != nil {
+			return
+		}
+
+		keys = append(keys, segments...)
+	}
+
+	var c Caption
+
+	captions, err := c.GetForVideo(db, v.ID)
+
+	if err != nil {
+		return
+	}
+
+	for _, caption := range captions {
+		keys = append(keys, caption.Key)
+	}
+
+	return
+}
+
+// The master playlist, rendition playlists and the segments they list
+func (v *Video) renditionKeys(db *system.DB, store storage.Storage) (keys []string, err error) {
+	var r Rendition
+
+	renditions, err := r.GetForVideo(db, v.ID)
+
+	if err != nil || len(renditions) == 0 {
+		return
+	}
+
+	prefix := strings.TrimSuffix(renditions[0].PlaylistKey, renditions[0].Name+".m3u8")
+
+	keys = append(keys, transcoder.RenditionPlaylistKey(prefix, transcoder.HLSMasterPlaylist))
+
+	for _, rendition := range renditions {
+		keys = append(keys, rendition.PlaylistKey)
+
+		body, _, err := store.Get(rendition.PlaylistKey)
+
+		if err == storage.ErrorNotFound {
+			continue
+		}
+
+		if err != nil {
+			return keys, err
+		}
+
+		playlist, err := ioutil.ReadAll(body)
+		body.Close()
+
+		if err != nil {
+			return keys, err
+		}
+
+		for _, line := range strings.Split(string(playlist), "\n") {
+			line = strings.TrimSpace(line)
+
+			if line != "" && !strings.HasPrefix(line, "#") {
+				keys = append(keys, prefix+line)
+			}
+		}
+	}
+
+	return
+}
+
+// Delete the rows of a video and then its stored objects, so a
+// failed purge never leaves rows pointing at deleted files
+func (v *Video) purge(db *system.DB, store storage.Storage) (err error) {
+
+	keys, err := v.storageKeys(db, store)
+
+	if err != nil {
+		return
+	}
+
+	if err = v.purgeRows(db); err != nil {
+		return
+	}
+
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+
+		// the rows are gone, an object left behind is only logged
+		if err := store.Delete(key); err != nil {
+			log.Printf("Video.purge() id -> %v key -> %v Delete() Error -> %v", v.ID, key, err)
+		}
+	}
+
+	log.Println("Video.purge() video -> ", v.ID)
+
+	return
+}
+
+func (v *Video) purgeRows(db *system.DB) (err error) {
+
+	tx, err := db.Begin()
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			tx.Rollback()
+			return
+		}
+	}()
+
+	if err != nil {
+		log.Println("Video.purgeRows() Begin() Error -> ", err)
+		return
+	}
+
+	for _, qry := range []string{v.queryPurgeNotifications(), v.queryPurgeComments(), v.queryPurge()} {
+		if _, err = tx.Exec(qry, v.ID); err != nil {
+			log.Printf("Video.purgeRows() id -> %v Exec() -> %v Error -> %v", v.ID, qry, err)
+			return
+		}
+	}
+
+	return
+}
+
+// Hard delete the videos that have been in the trash longer than
+// VideoTrashRetention, run by the worker on an interval
+func PurgeTrash(db *system.DB, store storage.Storage) (err error) {
+	var v Video
+
+	if store == nil {
+		return errors.New("storage is not set")
+	}
+
+	rows, err := db.Query(v.queryGetExpiredTrash(), time.Now().Add(-VideoTrashRetention), trashPurgeBatchSize)
+
+	if err != nil {
+		log.Printf("PurgeTrash() Query() -> %v Error -> %v", v.queryGetExpiredTrash(), err)
+		return
+	}
+
+	var videos []Video
+
+	for rows.Next() {
+		video := Video{}
+
+		if err = rows.Scan(&video.ID, &video.UserID, &video.Thumbnail, &video.Key); err != nil {
+			rows.Close()
+			log.Println("PurgeTrash() Error -> ", err)
+			return
+		}
+
+		videos = append(videos, video)
+	}
+
+	rows.Close()
+
+	// a video that fails goes to the back of the queue and is tried again
+	for _, video := range videos {
+		if err := video.purge(db, store); err != nil {
+			log.Printf("PurgeTrash() id -> %v Error -> %v", video.ID, err)
+
+			if _, err = db.Exec(v.queryTouchTrash(), video.ID, time.Now()); err != nil {
+				log.Printf("PurgeTrash() id -> %v Exec() -> %v Error -> %v", video.ID, v.queryTouchTrash(), err)
+			}
+		}
+	}
+
+	return
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTrashRetention(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 30 * 24 * time.Hour},
+		{"7", 7 * 24 * time.Hour},
+		{"0", 30 * 24 * time.Hour},
+		{"-3", 30 * 24 * time.Hour},
+		{"two", 30 * 24 * time.Hour},
+	}
+
+	for _, test := range tests {
+		if got := trashRetention(test.value, 30); got != test.want {
+			t.Errorf("trashRetention(%q) = %v, want %v", test.value, got, test.want)
+		}
+	}
+}
+
+// A ranked video can not be deleted while event_rankings points at its
+// competitor, it has to be left out of the purge or it fails every run
+func TestVideo_QueryGetExpiredTrashSkipsRankedVideos(t *testing.T) {
+	var v Video
+
+	tx, err := db.Begin()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer tx.Rollback()
+
+	setup := []string{
+		`CREATE TEMP TABLE videos (id INTEGER PRIMARY KEY, user_id INTEGER, thumbnail CHARACTER VARYING, key CHARACTER VARYING, deleted_at TIMESTAMP WITHOUT TIME ZONE, updated_at TIMESTAMP WITHOUT TIME ZONE) ON COMMIT DROP`,
+		`CREATE TEMP TABLE competitors (id INTEGER PRIMARY KEY, video_id INTEGER) ON COMMIT DROP`,
+		`CREATE TEMP TABLE event_rankings (id INTEGER PRIMARY KEY, competitor_id INTEGER) ON COMMIT DROP`,
+		`INSERT INTO videos VALUES (1, 1, '', 'ranked', now() - interval '60 days', now()), (2, 1, '', 'unranked', now() - interval '60 days', now()), (3, 1, '', 'recent', now(), now())`,
+		`INSERT INTO competitors VALUES (1, 1), (2, 2)`,
+		`INSERT INTO event_rankings VALUES (1, 1)`,
+	}
+
+	for _, qry := range setup {
+		if _, err = tx.Exec(qry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rows, err := tx.Query(v.queryGetExpiredTrash(), time.Now().Add(-30*24*time.Hour), trashPurgeBatchSize)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rows.Close()
+
+	var ids []uint64
+
+	for rows.Next() {
+		video := Video{}
+
+		if err = rows.Scan(&video.ID, &video.UserID, &video.Thumbnail, &video.Key); err != nil {
+			t.Fatal(err)
+		}
+
+		ids = append(ids, video.ID)
+	}
+
+	if !reflect.DeepEqual(ids, []uint64{2}) {
+		t.Errorf("expired trash = %v, want only the unranked video", ids)
+	}
+}
@@ -1,17 +1,75 @@
 package models
 
 import (
-	"github.com/rathvong/talentmob_server/system"
+	"database/sql"
 	"log"
+	"os"
+	"strconv"
 	"time"
+
+	"github.com/rathvong/talentmob_server/system"
+)
+
+// Qualification state of a view
+const (
+	ViewStatusPending   = "pending"
+	ViewStatusQualified = "qualified"
+	ViewStatusRejected  = "rejected"
+)
+
+// Reasons a view is not qualified
+const (
+	ViewReasonCreator        = "creator"
+	ViewReasonNewAccount     = "new_account"
+	ViewReasonDeviceVelocity = "device_velocity"
+	ViewReasonIPVelocity     = "ip_velocity"
+)
+
+const (
+	DefaultViewMinWatchSeconds    = 3
+	DefaultViewMinAccountAgeHours = 24
+	DefaultViewDeviceHourlyLimit  = 60
+	DefaultViewIPHourlyLimit      = 120
+)
+
+var (
+	// Seconds a video has to be watched before its view is checked
+	ViewMinWatchSeconds = viewLimit(os.Getenv("VIEW_MIN_WATCH_SECONDS"), DefaultViewMinWatchSeconds)
+
+	// Accounts younger than this never qualify a view
+	ViewMinAccountAgeHours = viewLimit(os.Getenv("VIEW_MIN_ACCOUNT_AGE_HOURS"), DefaultViewMinAccountAgeHours)
+
+	// Qualified views allowed from one device or ip address in an hour
+	ViewDeviceHourlyLimit = viewLimit(os.Getenv("VIEW_DEVICE_HOURLY_LIMIT"), DefaultViewDeviceHourlyLimit)
+	ViewIPHourlyLimit     = viewLimit(os.Getenv("VIEW_IP_HOURLY_LIMIT"), DefaultViewIPHourlyLimit)
 )
 
 // The view struct is to keep track of how many views
 // a video has accumulated.
+// Every view is counted in videos.views as soon as it is created.
+// A view only counts towards videos.qualified_views once the video has
+// been watched for ViewMinWatchSeconds by someone other than the creator
+// on an account older than ViewMinAccountAgeHours, and the device and ip
+// address are under their hourly limits. Badges and trending use
+// qualified views.
 type View struct {
 	BaseModel
-	UserID  uint64 `json:"user_id"`
-	VideoID uint64 `json:"video_id"`
+	UserID    uint64 `json:"user_id"`
+	VideoID   uint64 `json:"video_id"`
+	DeviceID  string `json:"-"`
+	IPAddress string `json:"-"`
+	Status    string `json:"status"`
+	Reason    string `json:"reason"`
+}
+
+func viewLimit(value string, fallback int) int {
+	limit, err := strconv.Atoi(value)
+
+	if err != nil || limit < 0 {
+		return fallback
+	}
+
+	return limit
 }
 
 // SQL query to create a new row
@@ -19,13 +77,49 @@ func (v *View) queryCreate() (qry string) {
 	return `INSERT INTO views
 				(user_id,
 				video_id,
+				device_id,
+				ip_address,
+				status,
 				created_at,
 				updated_at)
 			VALUES
-				($1, $2, $3, $4)
+				($1, $2, $3, $4, $5, $6, $7)
+			RETURNING id`
+}
+
+// SQL query for what a view is qualified against, the creator of
+// the video, the age of the viewers account and how many views the
+// device and ip address have qualified since $5
+func (v *View) queryQualifyChecks() (qry string) {
+	return `SELECT	videos.user_id,
+					users.created_at,
+					(SELECT COUNT(*) FROM views WHERE $3 != '' AND device_id = $3 AND status = 'qualified' AND updated_at > $5),
+					(SELECT COUNT(*) FROM views WHERE $4 != '' AND ip_address = $4 AND status = 'qualified' AND updated_at > $5)
+			FROM videos, users
+			WHERE videos.id = $2
+			AND users.id = $1`
+}
+
+// Only a pending view is decided so it is never counted twice
+func (v *View) queryDecide() (qry string) {
+	return `UPDATE views SET
+				device_id = $3,
+				ip_address = $4,
+				status = $5,
+				reason = $6,
+				updated_at = $7
+			WHERE user_id = $1
+			AND video_id = $2
+			AND status = 'pending'
 			RETURNING id`
 }
 
+func (v *View) queryAddQualifiedView() (qry string) {
+	return `UPDATE videos SET
+				qualified_views = qualified_views + 1
+			WHERE id = $1`
+}
+
 // SQL query to check if row exists
 func (v *View) queryExists() (qry string) {
 	return `SELECT EXISTS(select 1 from views where user_id = $1 and video_id = $2)`
@@ -71,12 +165,16 @@ func (v *View) Create(db *system.DB) (err error) {
 		return
 	}
 
+	v.Status = ViewStatusPending
 	v.CreatedAt = time.Now()
 	v.UpdatedAt = time.Now()
 
 	err = tx.QueryRow(v.queryCreate(),
 		v.UserID,
 		v.VideoID,
+		v.DeviceID,
+		v.IPAddress,
+		v.Status,
 		v.CreatedAt,
 		v.UpdatedAt).Scan(&v.ID)
 
@@ -109,3 +207,99 @@ func (v *View) Exists(db *system.DB, userID uint64, videoID uint64) (exists bool
 	log.Println("View.Exists() Exists -> ", exists)
 	return
 }
+
+// Decide if a pending view qualifies once the viewer has watched
+// the video long enough. Nothing happens before ViewMinWatchSeconds
+// or when the view has already been decided.
+func (v *View) Qualify(db *system.DB, watchedSeconds float64) (err error) {
+
+	if err = v.validateError(); err != nil {
+		return
+	}
+
+	if watchedSeconds < float64(ViewMinWatchSeconds) {
+		return
+	}
+
+	now := time.Now()
+
+	var creatorID uint64
+	var accountCreatedAt time.Time
+	var deviceViews int
+	var ipViews int
+
+	err = db.QueryRow(v.queryQualifyChecks(), v.UserID, v.VideoID, v.DeviceID, v.IPAddress, now.Add(-time.Hour)).Scan(
+		&creatorID,
+		&accountCreatedAt,
+		&deviceViews,
+		&ipViews,
+	)
+
+	if err != nil {
+		log.Printf("View.Qualify() user_id -> %v video_id -> %v QueryRow() -> %v Error -> %v", v.UserID, v.VideoID, v.queryQualifyChecks(), err)
+		return
+	}
+
+	v.Status = ViewStatusQualified
+	v.Reason = ""
+
+	switch {
+	case creatorID == v.UserID:
+		v.Reason = ViewReasonCreator
+	case now.Sub(accountCreatedAt) < time.Duration(ViewMinAccountAgeHours)*time.Hour:
+		v.Reason = ViewReasonNewAccount
+	case v.DeviceID != "" && deviceViews >= ViewDeviceHourlyLimit:
+		v.Reason = ViewReasonDeviceVelocity
+	case v.IPAddress != "" && ipViews >= ViewIPHourlyLimit:
+		v.Reason = ViewReasonIPVelocity
+	}
+
+	if v.Reason != "" {
+		v.Status = ViewStatusRejected
+	}
+
+	tx, err := db.Begin()
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			tx.Rollback()
+			return
+		}
+	}()
+
+	if err != nil {
+		log.Println("View.Qualify() Begin()", err)
+		return
+	}
+
+	v.UpdatedAt = now
+
+	err = tx.QueryRow(v.queryDecide(), v.UserID, v.VideoID, v.DeviceID, v.IPAddress, v.Status, v.Reason, v.UpdatedAt).Scan(&v.ID)
+
+	if err == sql.ErrNoRows {
+		// no view waiting on a decision
+		err = nil
+		return
+	}
+
+	if err != nil {
+		log.Printf("View.Qualify() QueryRow() -> %v Error -> %v", v.queryDecide(), err)
+		return
+	}
+
+	if v.Status != ViewStatusQualified {
+		log.Printf("View.Qualify() view -> %v rejected reason -> %v", v.ID, v.Reason)
+		return
+	}
+
+	if _, err = tx.Exec(v.queryAddQualifiedView(), v.VideoID); err != nil {
+		log.Printf("View.Qualify() video_id -> %v Exec() -> %v Error -> %v", v.VideoID, v.queryAddQualifiedView(), err)
+	}
+
+	return
+}
@@ -144,6 +144,10 @@ func (v *Vote) Create(db *system.DB) (err error) {
 
 		v.UpdatePoints(db)
 
+		// a first vote activates a referred user
+		ActivateReferral(db, v.UserID)
+		ActivateShare(db, v.UserID)
+
 	}()
 
 	if err != nil {
@@ -0,0 +1,385 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"time"
+
+	"github.com/rathvong/talentmob_server/system"
+)
+
+const (
+	// Completion percentage a session needs to count
+	// towards a videos completion rate
+	WatchCompletedPercent = 95.0
+
+	// Most seconds a session can report for a video whose
+	// length is not known until it has been transcoded
+	WatchUnknownDurationSeconds = 180.0
+
+	// Sessions a user can have open at once
+	WatchMaxOpenSessions = 2
+
+	// Extra seconds allowed over the video length and the time
+	// since the last report to cover buffering and clock drift
+	watchToleranceSeconds = 5.0
+
+	// Open sessions without a report for this long no longer
+	// count towards WatchMaxOpenSessions
+	watchSessionIdle = 5 * time.Minute
+)
+
+var (
+	ErrorWatchSessionFinished = errors.New("watch session has already finished")
+	ErrorWatchDuration        = errors.New("watched duration is not possible for this video")
+	ErrorWatchSessionLimit    = errors.New("too many videos are being watched at once")
+)
+
+// A watch session is one viewing of a video by a user.
+// Clients start a session when playback begins, send heartbeats with
+// the total seconds watched so far and close the session with a final
+// report. Each report moves the videos watch time and completion rate
+// and the users minutes watched by the difference from the last report
+// so nothing is counted twice.
+type WatchSession struct {
+	BaseModel
+	UserID         uint64  `json:"user_id"`
+	VideoID        uint64  `json:"video_id"`
+	WatchedSeconds float64 `json:"watched_seconds"`
+	Completion     float64 `json:"completion"`
+	IsFinished     bool    `json:"is_finished"`
+}
+
+func (w *WatchSession) queryCreate() (qry string) {
+	return `INSERT INTO watch_sessions
+						(user_id,
+						video_id,
+						watched_seconds,
+						completion,
+						is_finished,
+						created_at,
+						updated_at)
+				VALUES
+						($1, $2, $3, $4, $5, $6, $7)
+				RETURNING id`
+}
+
+func (w *WatchSession) queryUpdate() (qry string) {
+	return `UPDATE watch_sessions SET
+						watched_seconds = $2,
+						completion = $3,
+						is_finished = $4,
+						updated_at = $5
+				WHERE id = $1`
+}
+
+// Lock the user so concurrent sessions are counted in order
+func (w *WatchSession) queryLockUser() (qry string) {
+	return `SELECT id FROM users WHERE id = $1 FOR UPDATE`
+}
+
+func (w *WatchSession) queryCountOpen() (qry string) {
+	return `SELECT	COUNT(*)
+			FROM watch_sessions
+			WHERE user_id = $1
+			AND is_finished = false
+			AND updated_at > $2`
+}
+
+// Lock the session so concurrent heartbeats are applied in order
+func (w *WatchSession) queryGetForUpdate() (qry string) {
+	return `SELECT	id,
+					user_id,
+					video_id,
+					watched_seconds,
+					completion,
+					is_finished,
+					created_at,
+					updated_at
+			FROM watch_sessions
+			WHERE id = $1
+			FOR UPDATE`
+}
+
+// SQL query to move the watch metrics on a video,
+// the averages are kept on the row so feeds can read them
+func (w *WatchSession) queryUpdateVideo() (qry string) {
+	return `UPDATE videos SET
+						watch_sessions = watch_sessions + $2,
+						watch_seconds = watch_seconds + $3,
+						completed_views = completed_views + $4,
+						average_watch_time = (watch_seconds + $3) / GREATEST(watch_sessions + $2, 1),
+						completion_rate = (completed_views + $4) * 100.0 / GREATEST(watch_sessions + $2, 1)
+				WHERE id = $1`
+}
+
+func (w *WatchSession) queryUpdateUser() (qry string) {
+	return `UPDATE users SET
+						watch_seconds = watch_seconds + $2,
+						minutes_watched = FLOOR((watch_seconds + $2) / 60)
+				WHERE id = $1`
+}
+
+// Check a report against the video length and the time that has
+// passed since the previous report, or since the session started.
+// Videos without a known length are held to WatchUnknownDurationSeconds.
+// Completion is worked out from the video length when it is known,
+// otherwise the clients value is used.
+func (w *WatchSession) validateReport(previous WatchSession, duration float64, now time.Time) (err error) {
+
+	if w.WatchedSeconds < 0 || math.IsNaN(w.WatchedSeconds) || math.IsInf(w.WatchedSeconds, 0) {
+		return w.Errors(ErrorIncorrectValue, "watched_seconds")
+	}
+
+	if w.WatchedSeconds < previous.WatchedSeconds {
+		return w.Errors(ErrorIncorrectValue, "watched_seconds")
+	}
+
+	limit := duration
+
+	if limit <= 0 {
+		limit = WatchUnknownDurationSeconds
+	}
+
+	if w.WatchedSeconds > limit+watchToleranceSeconds {
+		return ErrorWatchDuration
+	}
+
+	// a report can not cover more time than has passed since the last one
+	if w.WatchedSeconds-previous.WatchedSeconds > now.Sub(previous.UpdatedAt).Seconds()+watchToleranceSeconds {
+		return ErrorWatchDuration
+	}
+
+	if duration > 0 {
+		w.Completion = math.Min(w.WatchedSeconds/duration*100, 100)
+		return
+	}
+
+	if w.Completion < 0 || w.Completion > 100 || math.IsNaN(w.Completion) {
+		return w.Errors(ErrorIncorrectValue, "completion")
+	}
+
+	if w.Completion < previous.Completion {
+		w.Completion = previous.Completion
+	}
+
+	return
+}
+
+// Start a watch session for a video when playback begins.
+// A user can only have WatchMaxOpenSessions open at once.
+func (w *WatchSession) Create(db *system.DB) (err error) {
+
+	if w.UserID == 0 {
+		return w.Errors(ErrorMissingValue, "user_id")
+	}
+
+	if w.VideoID == 0 {
+		return w.Errors(ErrorMissingValue, "video_id")
+	}
+
+	video := Video{}
+
+	if err = video.GetVideoByID(db, w.VideoID); err != nil {
+		return w.Errors(ErrorIncorrectValue, "video_id")
+	}
+
+	if !video.IsActive {
+		return w.Errors(ErrorIncorrectValue, "video_id")
+	}
+
+	now := time.Now()
+
+	// nothing can have been watched before the session started
+	if err = w.validateReport(WatchSession{BaseModel: BaseModel{UpdatedAt: now}}, video.Duration, now); err != nil {
+		return
+	}
+
+	tx, err := db.Begin()
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			tx.Rollback()
+			return
+		}
+	}()
+
+	if err != nil {
+		log.Println("WatchSession.Create() Begin() Error -> ", err)
+		return
+	}
+
+	if _, err = tx.Exec(w.queryLockUser(), w.UserID); err != nil {
+		log.Printf("WatchSession.Create() user_id -> %v Exec() -> %v Error -> %v", w.UserID, w.queryLockUser(), err)
+		return
+	}
+
+	var open int
+
+	if err = tx.QueryRow(w.queryCountOpen(), w.UserID, now.Add(-watchSessionIdle)).Scan(&open); err != nil {
+		log.Printf("WatchSession.Create() user_id -> %v QueryRow() -> %v Error -> %v", w.UserID, w.queryCountOpen(), err)
+		return
+	}
+
+	if open >= WatchMaxOpenSessions {
+		return ErrorWatchSessionLimit
+	}
+
+	w.CreatedAt = now
+	w.UpdatedAt = now
+
+	err = tx.QueryRow(w.queryCreate(),
+		w.UserID,
+		w.VideoID,
+		w.WatchedSeconds,
+		w.Completion,
+		w.IsFinished,
+		w.CreatedAt,
+		w.UpdatedAt,
+	).Scan(&w.ID)
+
+	if err != nil {
+		log.Printf("WatchSession.Create() user_id -> %v video_id -> %v QueryRow() -> %v Error -> %v", w.UserID, w.VideoID, w.queryCreate(), err)
+		return
+	}
+
+	return w.addMetrics(tx, WatchSession{}, 1)
+}
+
+// Record a heartbeat or the final report for a session
+func (w *WatchSession) Report(db *system.DB) (err error) {
+
+	if w.ID == 0 {
+		return w.Errors(ErrorMissingID, "id")
+	}
+
+	tx, err := db.Begin()
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		if err = tx.Commit(); err != nil {
+			tx.Rollback()
+			return
+		}
+	}()
+
+	if err != nil {
+		log.Println("WatchSession.Report() Begin() Error -> ", err)
+		return
+	}
+
+	previous := WatchSession{}
+
+	err = tx.QueryRow(w.queryGetForUpdate(), w.ID).Scan(
+		&previous.ID,
+		&previous.UserID,
+		&previous.VideoID,
+		&previous.WatchedSeconds,
+		&previous.Completion,
+		&previous.IsFinished,
+		&previous.CreatedAt,
+		&previous.UpdatedAt,
+	)
+
+	if err != nil {
+		log.Printf("WatchSession.Report() id -> %v QueryRow() -> %v Error -> %v", w.ID, w.queryGetForUpdate(), err)
+		return
+	}
+
+	if previous.UserID != w.UserID {
+		return w.Errors(ErrorIncorrectValue, "id")
+	}
+
+	if previous.IsFinished {
+		return ErrorWatchSessionFinished
+	}
+
+	video := Video{}
+
+	if err = video.GetVideoByID(db, previous.VideoID); err != nil {
+		return
+	}
+
+	now := time.Now()
+
+	if err = w.validateReport(previous, video.Duration, now); err != nil {
+		return
+	}
+
+	w.VideoID = previous.VideoID
+	w.CreatedAt = previous.CreatedAt
+	w.UpdatedAt = now
+
+	if _, err = tx.Exec(w.queryUpdate(), w.ID, w.WatchedSeconds, w.Completion, w.IsFinished, w.UpdatedAt); err != nil {
+		log.Printf("WatchSession.Report() id -> %v Exec() -> %v Error -> %v", w.ID, w.queryUpdate(), err)
+		return
+	}
+
+	return w.addMetrics(tx, previous, 0)
+}
+
+// Move the video and user metrics by the change since the last report
+func (w *WatchSession) addMetrics(tx *sql.Tx, previous WatchSession, sessions int) (err error) {
+
+	seconds := w.WatchedSeconds - previous.WatchedSeconds
+
+	completed := 0
+
+	if w.Completion >= WatchCompletedPercent && previous.Completion < WatchCompletedPercent {
+		completed = 1
+	}
+
+	if _, err = tx.Exec(w.queryUpdateVideo(), w.VideoID, sessions, seconds, completed); err != nil {
+		log.Printf("WatchSession.addMetrics() video_id -> %v Exec() -> %v Error -> %v", w.VideoID, w.queryUpdateVideo(), err)
+		return
+	}
+
+	if seconds == 0 {
+		return
+	}
+
+	if _, err = tx.Exec(w.queryUpdateUser(), w.UserID, seconds); err != nil {
+		log.Printf("WatchSession.addMetrics() user_id -> %v Exec() -> %v Error -> %v", w.UserID, w.queryUpdateUser(), err)
+	}
+
+	return
+}
+
+func (v *Video) querySetDuration() (qry string) {
+	return `UPDATE videos SET
+						duration = $2
+				WHERE id = $1`
+}
+
+// Store the length of a video in seconds once it is known
+// from transcoding, watch reports are checked against it
+func (v *Video) SetDuration(tx *sql.Tx, duration float64) (err error) {
+
+	if v.ID == 0 {
+		return v.Errors(ErrorMissingID, "id")
+	}
+
+	if duration <= 0 {
+		return v.Errors(ErrorIncorrectValue, "duration")
+	}
+
+	if _, err = tx.Exec(v.querySetDuration(), v.ID, duration); err != nil {
+		log.Printf("Video.SetDuration() id -> %v Exec() -> %v Error -> %v", v.ID, v.querySetDuration(), err)
+		return
+	}
+
+	v.Duration = duration
+
+	return
+}
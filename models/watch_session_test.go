@@ -0,0 +1,59 @@
+package models
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestWatchSession_ValidateReport(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		watched    float64
+		completion float64
+		previous   WatchSession
+		duration   float64
+		invalid    bool
+		err        error
+		want       float64
+	}{
+		{name: "first report", watched: 10, previous: WatchSession{BaseModel: BaseModel{UpdatedAt: now.Add(-20 * time.Second)}}, duration: 40, want: 25},
+		{name: "whole video", watched: 40, previous: WatchSession{BaseModel: BaseModel{UpdatedAt: now.Add(-time.Minute)}}, duration: 40, want: 100},
+		{name: "within the tolerance of the duration", watched: 44, previous: WatchSession{BaseModel: BaseModel{UpdatedAt: now.Add(-time.Minute)}}, duration: 40, want: 100},
+		{name: "past the duration", watched: 46, previous: WatchSession{BaseModel: BaseModel{UpdatedAt: now.Add(-time.Minute)}}, duration: 40, err: ErrorWatchDuration},
+		{name: "past the unknown duration limit", watched: WatchUnknownDurationSeconds + 6, previous: WatchSession{BaseModel: BaseModel{UpdatedAt: now.Add(-time.Hour)}}, err: ErrorWatchDuration},
+		{name: "more than the time passed", watched: 30, previous: WatchSession{WatchedSeconds: 10, BaseModel: BaseModel{UpdatedAt: now.Add(-10 * time.Second)}}, duration: 60, err: ErrorWatchDuration},
+		{name: "time passed within the tolerance", watched: 25, previous: WatchSession{WatchedSeconds: 10, BaseModel: BaseModel{UpdatedAt: now.Add(-10 * time.Second)}}, duration: 100, want: 25},
+		{name: "report at the same time", watched: 10, previous: WatchSession{BaseModel: BaseModel{UpdatedAt: now}}, duration: 60, err: ErrorWatchDuration},
+		{name: "going backwards", watched: 5, previous: WatchSession{WatchedSeconds: 10, BaseModel: BaseModel{UpdatedAt: now.Add(-time.Minute)}}, duration: 60, invalid: true},
+		{name: "negative", watched: -1, previous: WatchSession{BaseModel: BaseModel{UpdatedAt: now.Add(-time.Minute)}}, duration: 60, invalid: true},
+		{name: "not a number", watched: math.NaN(), previous: WatchSession{BaseModel: BaseModel{UpdatedAt: now.Add(-time.Minute)}}, duration: 60, invalid: true},
+		{name: "infinite", watched: math.Inf(1), previous: WatchSession{BaseModel: BaseModel{UpdatedAt: now.Add(-time.Minute)}}, duration: 60, invalid: true},
+		{name: "completion from the client", watched: 10, completion: 30, previous: WatchSession{BaseModel: BaseModel{UpdatedAt: now.Add(-time.Minute)}}, want: 30},
+		{name: "completion never goes down", watched: 20, completion: 10, previous: WatchSession{WatchedSeconds: 10, Completion: 30, BaseModel: BaseModel{UpdatedAt: now.Add(-time.Minute)}}, want: 30},
+		{name: "completion over 100", watched: 10, completion: 101, previous: WatchSession{BaseModel: BaseModel{UpdatedAt: now.Add(-time.Minute)}}, invalid: true},
+	}
+
+	for _, test := range tests {
+		w := WatchSession{WatchedSeconds: test.watched, Completion: test.completion}
+
+		err := w.validateReport(test.previous, test.duration, now)
+
+		switch {
+		case test.invalid:
+			if err == nil {
+				t.Errorf("%v: expected an error", test.name)
+			}
+		case test.err != nil:
+			if err != test.err {
+				t.Errorf("%v: error = %v, want %v", test.name, err, test.err)
+			}
+		case err != nil:
+			t.Errorf("%v: unexpected error %v", test.name, err)
+		case w.Completion != test.want:
+			t.Errorf("%v: completion = %v, want %v", test.name, w.Completion, test.want)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package sns
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message types posted by SNS to an http endpoint
+const (
+	TypeNotification             = "Notification"
+	TypeSubscriptionConfirmation = "SubscriptionConfirmation"
+	TypeUnsubscribeConfirmation  = "UnsubscribeConfirmation"
+)
+
+// Messages older than this are refused even with a valid signature
+const MaxMessageAge = time.Hour
+
+var (
+	ErrorCertURL          = errors.New("signing certificate url is not an amazon sns url")
+	ErrorSubscribeURL     = errors.New("subscribe url is not an amazon sns url")
+	ErrorSignatureVersion = errors.New("signature version is not supported")
+	ErrorSignature        = errors.New("message signature is not valid")
+	ErrorTopic            = errors.New("message topic is not allowed")
+	ErrorExpired          = errors.New("message is too old")
+	ErrorMessageType      = errors.New("message type is not supported")
+)
+
+// Only certificates and subscriptions served by sns are trusted
+var snsHost = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// A message posted by SNS. Type tells notifications
+// apart from subscription confirmations.
+type Message struct {
+	Type             string `json:"Type"`
+	MessageID        string `json:"MessageId"`
+	Token            string `json:"Token"`
+	TopicArn         string `json:"TopicArn"`
+	Subject          string `json:"Subject"`
+	Message          string `json:"Message"`
+	Timestamp        string `json:"Timestamp"`
+	SignatureVersion string `json:"SignatureVersion"`
+	Signature        string `json:"Signature"`
+	SigningCertURL   string `json:"SigningCertURL"`
+	SubscribeURL     string `json:"SubscribeURL"`
+	UnsubscribeURL   string `json:"UnsubscribeURL"`
+}
+
+// Verifier checks messages against the certificate sns signed them
+// with. Certificates are kept until they expire so each one is only
+// downloaded once.
+type Verifier struct {
+	client *http.Client
+	mutex  sync.Mutex
+	certs  map[string]*x509.Certificate
+
+	// Topics messages are accepted from, every message is refused when empty
+	Topics []string
+}
+
+// Comma separated topic arns set in SNS_TOPIC_ARNS
+func NewVerifier() *Verifier {
+	return &Verifier{
+		client: &http.Client{Timeout: 10 * time.Second},
+		certs:  make(map[string]*x509.Certificate),
+		Topics: splitList(os.Getenv("SNS_TOPIC_ARNS")),
+	}
+}
+
+func splitList(value string) (list []string) {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return
+}
+
+// Check a url points at an sns host over https
+func isSNSURL(raw string) bool {
+	u, err := url.Parse(raw)
+
+	if err != nil {
+		return false
+	}
+
+	return u.Scheme == "https" && snsHost.MatchString(u.Host)
+}
+
+// The text sns signs, the fields used depend on the message type
+func (m *Message) StringToSign() (string, error) {
+	var fields []string
+
+	switch m.Type {
+	case TypeNotification:
+		fields = append(fields, "Message", m.Message, "MessageId", m.MessageID)
+
+		if m.Subject != "" {
+			fields = append(fields, "Subject", m.Subject)
+		}
+
+		fields = append(fields, "Timestamp", m.Timestamp, "TopicArn", m.TopicArn, "Type", m.Type)
+	case TypeSubscriptionConfirmation, TypeUnsubscribeConfirmation:
+		fields = append(fields,
+			"Message", m.Message,
+			"MessageId", m.MessageID,
+			"SubscribeURL", m.SubscribeURL,
+			"Timestamp", m.Timestamp,
+			"Token", m.Token,
+			"TopicArn", m.TopicArn,
+			"Type", m.Type,
+		)
+	default:
+		return "", ErrorMessageType
+	}
+
+	return strings.Join(fields, "\n") + "\n", nil
+}
+
+// Verify the signature, topic and age of a message
+func (v *Verifier) Verify(m *Message) (err error) {
+
+	if !v.allowsTopic(m.TopicArn) {
+		return ErrorTopic
+	}
+
+	timestamp, err := time.Parse(time.RFC3339, m.Timestamp)
+
+	if err != nil {
+		return ErrorExpired
+	}
+
+	if time.Since(timestamp) > MaxMessageAge {
+		return ErrorExpired
+	}
+
+	var algorithm x509.SignatureAlgorithm
+
+	switch m.SignatureVersion {
+	case "1":
+		algorithm = x509.SHA1WithRSA
+	case "2":
+		algorithm = x509.SHA256WithRSA
+	default:
+		return ErrorSignatureVersion
+	}
+
+	text, err := m.StringToSign()
+
+	if err != nil {
+		return
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(m.Signature)
+
+	if err != nil {
+		return ErrorSignature
+	}
+
+	cert, err := v.certificate(m.SigningCertURL)
+
+	if err != nil {
+		return
+	}
+
+	if err = cert.CheckSignature(algorithm, []byte(text), signature); err != nil {
+		return ErrorSignature
+	}
+
+	return nil
+}
+
+// Retrieve a signing certificate from the cache or from sns
+func (v *Verifier) certificate(certURL string) (cert *x509.Certificate, err error) {
+
+	if !isSNSURL(certURL) || !strings.HasSuffix(certURL, ".pem") {
+		return nil, ErrorCertURL
+	}
+
+	v.mutex.Lock()
+	cert, ok := v.certs[certURL]
+	v.mutex.Unlock()
+
+	if ok && time.Now().Before(cert.NotAfter) {
+		return cert, nil
+	}
+
+	res, err := v.client.Get(certURL)
+
+	if err != nil {
+		return
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New("could not download signing certificate: " + res.Status)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+
+	if err != nil {
+		return
+	}
+
+	block, _ := pem.Decode(body)
+
+	if block == nil {
+		return nil, errors.New("signing certificate is not pem encoded")
+	}
+
+	if cert, err = x509.ParseCertificate(block.Bytes); err != nil {
+		return
+	}
+
+	v.AddCertificate(certURL, cert)
+
+	return
+}
+
+// Cache a certificate for a signing url
+func (v *Verifier) AddCertificate(certURL string, cert *x509.Certificate) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	v.certs[certURL] = cert
+}
+
+// Confirm a subscription by visiting its SubscribeURL,
+// only call this after the message has been verified
+func (v *Verifier) ConfirmSubscription(m *Message) (err error) {
+
+	if m.Type != TypeSubscriptionConfirmation {
+		return ErrorMessageType
+	}
+
+	if !v.allowsTopic(m.TopicArn) {
+		return ErrorTopic
+	}
+
+	if !isSNSURL(m.SubscribeURL) {
+		return ErrorSubscribeURL
+	}
+
+	res, err := v.client.Get(m.SubscribeURL)
+
+	if err != nil {
+		return
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return errors.New("could not confirm subscription: " + res.Status)
+	}
+
+	return
+}
+
+// Only topics listed in SNS_TOPIC_ARNS are trusted
+func (v *Verifier) allowsTopic(topicArn string) bool {
+	return topicArn != "" && contains(v.Topics, topicArn)
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,157 @@
+package sns
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"testing"
+	"time"
+)
+
+const (
+	testCertURL  = "https://sns.us-west-2.amazonaws.com/SimpleNotificationService-test.pem"
+	testTopicArn = "arn:aws:sns:us-west-2:123456789012:transcoding"
+)
+
+func signedMessage(t *testing.T) (*Verifier, *Message) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sns.amazonaws.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := NewVerifier()
+	v.Topics = []string{testTopicArn}
+	v.AddCertificate(testCertURL, cert)
+
+	m := &Message{
+		Type:             TypeNotification,
+		MessageID:        "message-1",
+		TopicArn:         testTopicArn,
+		Message:          `{"state":"COMPLETED"}`,
+		Timestamp:        time.Now().UTC().Format(time.RFC3339),
+		SignatureVersion: "2",
+		SigningCertURL:   testCertURL,
+	}
+
+	text, err := m.StringToSign()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := sha256.Sum256([]byte(text))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.Signature = base64.StdEncoding.EncodeToString(signature)
+
+	return v, m
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	v, m := signedMessage(t)
+
+	if err := v.Verify(m); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifier_VerifyTampered(t *testing.T) {
+	v, m := signedMessage(t)
+
+	m.Message = `{"state":"ERROR"}`
+
+	if err := v.Verify(m); err != ErrorSignature {
+		t.Errorf("expected ErrorSignature, got %v", err)
+	}
+}
+
+func TestVerifier_VerifyTopic(t *testing.T) {
+	v, m := signedMessage(t)
+
+	v.Topics = []string{"arn:aws:sns:us-west-2:123456789012:other"}
+
+	if err := v.Verify(m); err != ErrorTopic {
+		t.Errorf("expected ErrorTopic, got %v", err)
+	}
+}
+
+func TestVerifier_VerifyNoTopics(t *testing.T) {
+	v, m := signedMessage(t)
+
+	v.Topics = nil
+
+	if err := v.Verify(m); err != ErrorTopic {
+		t.Errorf("expected ErrorTopic, got %v", err)
+	}
+}
+
+func TestVerifier_ConfirmSubscriptionTopic(t *testing.T) {
+	v, m := signedMessage(t)
+
+	m.Type = TypeSubscriptionConfirmation
+	m.SubscribeURL = "https://sns.us-west-2.amazonaws.com/?Action=ConfirmSubscription"
+	m.TopicArn = "arn:aws:sns:us-west-2:123456789012:other"
+
+	if err := v.ConfirmSubscription(m); err != ErrorTopic {
+		t.Errorf("expected ErrorTopic, got %v", err)
+	}
+}
+
+func TestVerifier_VerifyCertURL(t *testing.T) {
+	v, m := signedMessage(t)
+
+	urls := []string{
+		"http://sns.us-west-2.amazonaws.com/cert.pem",
+		"https://sns.us-west-2.amazonaws.com.example.com/cert.pem",
+		"https://example.com/sns.us-west-2.amazonaws.com/cert.pem",
+		"https://sns.us-west-2.amazonaws.com/cert.txt",
+	}
+
+	for _, certURL := range urls {
+		m.SigningCertURL = certURL
+
+		if err := v.Verify(m); err != ErrorCertURL {
+			t.Errorf("%v: expected ErrorCertURL, got %v", certURL, err)
+		}
+	}
+}
+
+func TestVerifier_VerifyExpired(t *testing.T) {
+	v, m := signedMessage(t)
+
+	m.Timestamp = time.Now().Add(-2 * MaxMessageAge).UTC().Format(time.RFC3339)
+
+	if err := v.Verify(m); err != ErrorExpired {
+		t.Errorf("expected ErrorExpired, got %v", err)
+	}
+}
@@ -0,0 +1,301 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Objects are kept out of the working directory by default
+var DefaultLocalPath = filepath.Join(os.TempDir(), "talentmob_storage")
+
+const (
+	DefaultLocalURL = "http://localhost:8080"
+
+	// Path the api serves local objects under
+	LocalURLPath = "/storage/"
+
+	// Content types are kept beside the objects in this folder
+	localMetaDir = ".meta"
+)
+
+var (
+	ErrorInvalidKey       = errors.New("object key is not valid")
+	ErrorInvalidSignature = errors.New("url signature is not valid")
+	ErrorURLExpired       = errors.New("url has expired")
+)
+
+// Store on the local disk for development and tests. Presigned urls
+// point back at the api, which serves them through ServeHTTP.
+type Local struct {
+	Root    string
+	BaseURL string
+	secret  []byte
+}
+
+// A random secret is used when none is set,
+// urls signed before a restart stop working
+func NewLocal(root string, baseURL string, secret string) (*Local, error) {
+
+	if baseURL == "" {
+		baseURL = DefaultLocalURL
+	}
+
+	key := []byte(secret)
+
+	if secret == "" {
+		key = make([]byte, 32)
+
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+
+	return &Local{Root: root, BaseURL: strings.TrimRight(baseURL, "/"), secret: key}, nil
+}
+
+// Path of an object on disk, keys can not leave the root
+func (l *Local) path(key string) (string, error) {
+
+	if key == "" {
+		return "", ErrorMissingKey
+	}
+
+	clean := path.Clean("/" + key)
+
+	if clean != "/"+key || strings.HasPrefix(key, localMetaDir) {
+		return "", ErrorInvalidKey
+	}
+
+	return filepath.Join(l.Root, filepath.FromSlash(clean)), nil
+}
+
+func (l *Local) metaPath(key string) string {
+	return filepath.Join(l.Root, localMetaDir, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+func (l *Local) Put(key string, body io.ReadSeeker, contentType string) (err error) {
+	name, err := l.path(key)
+
+	if err != nil {
+		return
+	}
+
+	if err = os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return
+	}
+
+	file, err := os.Create(name)
+
+	if err != nil {
+		return
+	}
+
+	if _, err = io.Copy(file, body); err != nil {
+		file.Close()
+		return
+	}
+
+	if err = file.Close(); err != nil {
+		return
+	}
+
+	meta := l.metaPath(key)
+
+	if err = os.MkdirAll(filepath.Dir(meta), 0755); err != nil {
+		return
+	}
+
+	return ioutil.WriteFile(meta, []byte(contentType), 0644)
+}
+
+func (l *Local) Get(key string) (body io.ReadCloser, object Object, err error) {
+
+	if object, err = l.Stat(key); err != nil {
+		return
+	}
+
+	name, _ := l.path(key)
+
+	file, err := os.Open(name)
+
+	if err != nil {
+		return
+	}
+
+	return file, object, nil
+}
+
+func (l *Local) Stat(key string) (object Object, err error) {
+	name, err := l.path(key)
+
+	if err != nil {
+		return
+	}
+
+	info, err := os.Stat(name)
+
+	if os.IsNotExist(err) {
+		return object, ErrorNotFound
+	}
+
+	if err != nil {
+		return
+	}
+
+	object.Key = key
+	object.Size = info.Size()
+	object.ModifiedAt = info.ModTime()
+
+	if contentType, err := ioutil.ReadFile(l.metaPath(key)); err == nil {
+		object.ContentType = string(contentType)
+	} else {
+		object.ContentType = mime.TypeByExtension(path.Ext(key))
+	}
+
+	return
+}
+
+func (l *Local) Delete(key string) (err error) {
+	name, err := l.path(key)
+
+	if err != nil {
+		return
+	}
+
+	if err = os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return
+	}
+
+	if err = os.Remove(l.metaPath(key)); err != nil && !os.IsNotExist(err) {
+		return
+	}
+
+	return nil
+}
+
+func (l *Local) PresignUpload(key string, contentType string, expires time.Duration) (string, error) {
+	return l.presign(http.MethodPut, key, contentType, expires)
+}
+
+func (l *Local) PresignDownload(key string, expires time.Duration) (string, error) {
+	return l.presign(http.MethodGet, key, "", expires)
+}
+
+func (l *Local) signature(method string, key string, contentType string, expires int64) string {
+	mac := hmac.New(sha256.New, l.secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%d", method, key, contentType, expires)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (l *Local) presign(method string, key string, contentType string, expires time.Duration) (string, error) {
+
+	if _, err := l.path(key); err != nil {
+		return "", err
+	}
+
+	expiresAt := time.Now().Add(expires).Unix()
+
+	values := url.Values{}
+	values.Set("expires", strconv.FormatInt(expiresAt, 10))
+	values.Set("signature", l.signature(method, key, contentType, expiresAt))
+
+	return l.BaseURL + LocalURLPath + key + "?" + values.Encode(), nil
+}
+
+// Check a request against the url it was presigned with
+func (l *Local) verify(r *http.Request, key string) error {
+	expires, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+
+	if err != nil {
+		return ErrorInvalidSignature
+	}
+
+	if time.Now().Unix() > expires {
+		return ErrorURLExpired
+	}
+
+	contentType := ""
+
+	if r.Method == http.MethodPut {
+		contentType = r.Header.Get("Content-Type")
+	}
+
+	expected := l.signature(r.Method, key, contentType, expires)
+
+	if !hmac.Equal([]byte(expected), []byte(r.URL.Query().Get("signature"))) {
+		return ErrorInvalidSignature
+	}
+
+	return nil
+}
+
+// Serve the presigned uploads and downloads under LocalURLPath
+func (l *Local) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, LocalURLPath)
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := l.verify(r, key); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		body, err := ioutil.ReadAll(r.Body)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := l.Put(key, bytes.NewReader(body), r.Header.Get("Content-Type")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	body, object, err := l.Get(key)
+
+	if err == ErrorNotFound {
+		http.NotFound(w, r)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defer body.Close()
+
+	w.Header().Set("Content-Type", object.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(object.Size, 10))
+	io.Copy(w, body)
+}
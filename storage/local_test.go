@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLocal(t *testing.T) (*Local, func()) {
+	root, err := ioutil.TempDir("", "storage")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := NewLocal(root, "http://localhost", "secret")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return l, func() { os.RemoveAll(root) }
+}
+
+func TestLocal_PutGetDelete(t *testing.T) {
+	l, done := newTestLocal(t)
+	defer done()
+
+	if err := l.Put("videos/1.mp4", strings.NewReader("video"), "video/mp4"); err != nil {
+		t.Fatal(err)
+	}
+
+	object, err := l.Stat("videos/1.mp4")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if object.Size != 5 || object.ContentType != "video/mp4" {
+		t.Errorf("unexpected object %+v", object)
+	}
+
+	body, _, err := l.Get("videos/1.mp4")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := ioutil.ReadAll(body)
+	body.Close()
+
+	if string(data) != "video" {
+		t.Errorf("unexpected body %q", data)
+	}
+
+	if err := l.Delete("videos/1.mp4"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := l.Stat("videos/1.mp4"); err != ErrorNotFound {
+		t.Errorf("expected ErrorNotFound, got %v", err)
+	}
+}
+
+func TestLocal_InvalidKey(t *testing.T) {
+	l, done := newTestLocal(t)
+	defer done()
+
+	for _, key := range []string{"", "../secret", "videos/../../secret", ".meta/videos/1.mp4"} {
+		if err := l.Put(key, strings.NewReader("video"), "video/mp4"); err == nil {
+			t.Errorf("%q: expected an error", key)
+		}
+	}
+}
+
+func TestLocal_PresignedUpload(t *testing.T) {
+	l, done := newTestLocal(t)
+	defer done()
+
+	upload, err := l.PresignUpload("videos/2.mp4", "video/mp4", time.Minute)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPut, upload, bytes.NewBufferString("video"))
+	req.Header.Set("Content-Type", "video/mp4")
+
+	res := httptest.NewRecorder()
+	l.ServeHTTP(res, req)
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("upload failed %v %v", res.Code, res.Body.String())
+	}
+
+	// the content type is part of the signature
+	req = httptest.NewRequest(http.MethodPut, upload, bytes.NewBufferString("video"))
+	req.Header.Set("Content-Type", "text/html")
+
+	res = httptest.NewRecorder()
+	l.ServeHTTP(res, req)
+
+	if res.Code != http.StatusForbidden {
+		t.Errorf("expected forbidden, got %v", res.Code)
+	}
+
+	download, err := l.PresignDownload("videos/2.mp4", time.Minute)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res = httptest.NewRecorder()
+	l.ServeHTTP(res, httptest.NewRequest(http.MethodGet, download, nil))
+
+	if res.Code != http.StatusOK || res.Body.String() != "video" {
+		t.Errorf("download failed %v %v", res.Code, res.Body.String())
+	}
+}
+
+func TestLocal_PresignedExpired(t *testing.T) {
+	l, done := newTestLocal(t)
+	defer done()
+
+	download, err := l.PresignDownload("videos/3.mp4", -time.Minute)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := httptest.NewRecorder()
+	l.ServeHTTP(res, httptest.NewRequest(http.MethodGet, download, nil))
+
+	if res.Code != http.StatusForbidden {
+		t.Errorf("expected forbidden, got %v", res.Code)
+	}
+}
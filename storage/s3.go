@@ -0,0 +1,224 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+)
+
+const (
+	DefaultS3Region = "us-west-2"
+	DefaultS3Bucket = "talentmob"
+)
+
+// Store backed by an S3 bucket. Requests are signed with
+// signature version 4, set S3_BUCKET and S3_REGION to change
+// the bucket.
+type S3 struct {
+	client *http.Client
+	signer *v4.Signer
+	Bucket string
+	Region string
+}
+
+func NewS3(accessKey string, secretKey string) (*S3, error) {
+	signer := v4.NewSigner(credentials.NewStaticCredentials(accessKey, secretKey, ""), func(s *v4.Signer) {
+		s.DisableURIPathEscaping = true
+	})
+
+	return &S3{
+		client: &http.Client{Timeout: 5 * time.Minute},
+		signer: signer,
+		Bucket: envOrDefault("S3_BUCKET", DefaultS3Bucket),
+		Region: envOrDefault("S3_REGION", DefaultS3Region),
+	}, nil
+}
+
+// Virtual hosted url of an object
+func (s *S3) objectURL(key string) *url.URL {
+	return &url.URL{
+		Scheme: "https",
+		Host:   fmt.Sprintf("%s.s3.%s.amazonaws.com", s.Bucket, s.Region),
+		Path:   "/" + key,
+	}
+}
+
+func (s *S3) newRequest(method string, key string, body io.ReadSeeker) (req *http.Request, err error) {
+
+	if key == "" {
+		return nil, ErrorMissingKey
+	}
+
+	req, err = http.NewRequest(method, s.objectURL(key).String(), nil)
+
+	if err != nil {
+		return
+	}
+
+	if body != nil {
+		req.Body = readSeekCloser{body}
+	}
+
+	return
+}
+
+func (s *S3) do(req *http.Request, body io.ReadSeeker) (res *http.Response, err error) {
+
+	if _, err = s.signer.Sign(req, body, "s3", s.Region, time.Now()); err != nil {
+		return
+	}
+
+	if res, err = s.client.Do(req); err != nil {
+		return
+	}
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		res.Body.Close()
+		return nil, ErrorNotFound
+	case res.StatusCode >= 300:
+		res.Body.Close()
+		return nil, fmt.Errorf("s3 %s %s: %s", req.Method, req.URL.Path, res.Status)
+	}
+
+	return
+}
+
+func (s *S3) Put(key string, body io.ReadSeeker, contentType string) (err error) {
+	req, err := s.newRequest(http.MethodPut, key, body)
+
+	if err != nil {
+		return
+	}
+
+	size, err := body.Seek(0, io.SeekEnd)
+
+	if err != nil {
+		return
+	}
+
+	if _, err = body.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+
+	res, err := s.do(req, body)
+
+	if err != nil {
+		return
+	}
+
+	return res.Body.Close()
+}
+
+func (s *S3) Get(key string) (body io.ReadCloser, object Object, err error) {
+	req, err := s.newRequest(http.MethodGet, key, nil)
+
+	if err != nil {
+		return
+	}
+
+	res, err := s.do(req, nil)
+
+	if err != nil {
+		return
+	}
+
+	return res.Body, s.object(key, res), nil
+}
+
+func (s *S3) PresignUpload(key string, contentType string, expires time.Duration) (string, error) {
+	req, err := s.newRequest(http.MethodPut, key, nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	// clients have to upload with the same content type
+	req.Header.Set("Content-Type", contentType)
+
+	if _, err = s.signer.Presign(req, nil, "s3", s.Region, expires, time.Now()); err != nil {
+		return "", err
+	}
+
+	return req.URL.String(), nil
+}
+
+func (s *S3) PresignDownload(key string, expires time.Duration) (string, error) {
+	req, err := s.newRequest(http.MethodGet, key, nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	if _, err = s.signer.Presign(req, nil, "s3", s.Region, expires, time.Now()); err != nil {
+		return "", err
+	}
+
+	return req.URL.String(), nil
+}
+
+func (s *S3) Delete(key string) (err error) {
+	req, err := s.newRequest(http.MethodDelete, key, nil)
+
+	if err != nil {
+		return
+	}
+
+	res, err := s.do(req, nil)
+
+	if err == ErrorNotFound {
+		return nil
+	}
+
+	if err != nil {
+		return
+	}
+
+	return res.Body.Close()
+}
+
+func (s *S3) Stat(key string) (object Object, err error) {
+	req, err := s.newRequest(http.MethodHead, key, nil)
+
+	if err != nil {
+		return
+	}
+
+	res, err := s.do(req, nil)
+
+	if err != nil {
+		return
+	}
+
+	res.Body.Close()
+
+	return s.object(key, res), nil
+}
+
+func (s *S3) object(key string, res *http.Response) (object Object) {
+	object.Key = key
+	object.ContentType = res.Header.Get("Content-Type")
+	object.Size, _ = strconv.ParseInt(res.Header.Get("Content-Length"), 10, 64)
+	object.ModifiedAt, _ = http.ParseTime(res.Header.Get("Last-Modified"))
+
+	return
+}
+
+// Request bodies are read by the signer to hash them
+// and by the client to send them
+type readSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (readSeekCloser) Close() error {
+	return nil
+}
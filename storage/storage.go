@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// Backends that can be selected with STORAGE_BACKEND
+const (
+	BackendS3    = "s3"
+	BackendLocal = "local"
+)
+
+var (
+	ErrorNotFound   = errors.New("object does not exist")
+	ErrorMissingKey = errors.New("object key is missing")
+)
+
+// Details of a stored object
+type Object struct {
+	Key         string    `json:"key"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type"`
+	ModifiedAt  time.Time `json:"modified_at"`
+}
+
+// Storage keeps the files for videos, thumbnails and watermarks.
+// Clients upload and download through presigned urls so they
+// never need credentials for the store.
+type Storage interface {
+	Put(key string, body io.ReadSeeker, contentType string) error
+	Get(key string) (io.ReadCloser, Object, error)
+	PresignUpload(key string, contentType string, expires time.Duration) (url string, err error)
+	PresignDownload(key string, expires time.Duration) (url string, err error)
+	Delete(key string) error
+	Stat(key string) (Object, error)
+}
+
+// Create the store set in STORAGE_BACKEND, S3 is used by default
+func New() (Storage, error) {
+	switch os.Getenv("STORAGE_BACKEND") {
+	case BackendLocal:
+		return NewLocal(envOrDefault("STORAGE_LOCAL_PATH", DefaultLocalPath), os.Getenv("STORAGE_LOCAL_URL"), os.Getenv("STORAGE_LOCAL_SECRET"))
+	default:
+		return NewS3(os.Getenv("AWS_ACCESS_KEY"), os.Getenv("AWS_SECRET_KEY"))
+	}
+}
+
+func envOrDefault(key string, value string) string {
+	if env := os.Getenv(key); env != "" {
+		return env
+	}
+
+	return value
+}
@@ -0,0 +1,231 @@
+package transcoder
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/elastictranscoder"
+)
+
+// Defaults for the pipelines and presets created in the aws console
+const (
+	DefaultRegion              = "us-west-2"
+	DefaultPipelineID          = "1529303979535-ru9lk4"
+	DefaultWatermarkPipelineID = "1528550420987-fmmf1s"
+	DefaultPresetID            = "1529819336285-0bgk6m"
+	DefaultWatermarkPresetID   = "1530091735460-a9qb9y"
+	DefaultWatermarkInputKey   = "large_watermark.png"
+	DefaultWatermarkPosition   = "BottomRight"
+)
+
+// Default presets for the HLS renditions, the Elastic Transcoder system
+// HLS presets HLSRenditions is sized from. Set TRANSCODER_HLS_PRESET_<NAME>
+// (for example TRANSCODER_HLS_PRESET_1M) to use a custom preset, it must
+// not write a larger frame or bitrate than its rendition advertises.
+var defaultHLSPresets = map[string]string{
+	"400k": "1351620000001-200050",
+	"600k": "1351620000001-200040",
+	"1m":   "1351620000001-200030",
+	"2m":   "1351620000001-200010",
+}
+
+// Job states used by Elastic Transcoder
+const (
+	elasticStateSubmitted   = "Submitted"
+	elasticStateProgressing = "Progressing"
+	elasticStateComplete    = "Complete"
+	elasticStateCanceled    = "Canceled"
+	elasticStateError       = "Error"
+)
+
+// Transcoder backed by AWS Elastic Transcoder.
+// Every setting can be changed through the environment.
+type ElasticTranscoder struct {
+	client              *elastictranscoder.ElasticTranscoder
+	PipelineID          string
+	WatermarkPipelineID string
+	PresetID            string
+	WatermarkPresetID   string
+	WatermarkInputKey   string
+	WatermarkPosition   string
+	HLSPresets          map[string]string
+}
+
+func envOrDefault(key string, value string) string {
+	if env := os.Getenv(key); env != "" {
+		return env
+	}
+
+	return value
+}
+
+func NewElasticTranscoder(accessKey string, secretKey string) (*ElasticTranscoder, error) {
+	creds := credentials.NewStaticCredentials(accessKey, secretKey, "")
+
+	region := envOrDefault("TRANSCODER_REGION", DefaultRegion)
+
+	sess, err := session.NewSession(aws.NewConfig().WithCredentials(creds).WithRegion(region))
+
+	if err != nil {
+		return nil, err
+	}
+
+	hlsPresets := make(map[string]string)
+
+	for _, rendition := range HLSRenditions {
+		hlsPresets[rendition.Name] = envOrDefault("TRANSCODER_HLS_PRESET_"+strings.ToUpper(rendition.Name), defaultHLSPresets[rendition.Name])
+	}
+
+	return &ElasticTranscoder{
+		client:              elastictranscoder.New(sess),
+		PipelineID:          envOrDefault("TRANSCODER_PIPELINE_ID", DefaultPipelineID),
+		WatermarkPipelineID: envOrDefault("TRANSCODER_WATERMARK_PIPELINE_ID", DefaultWatermarkPipelineID),
+		PresetID:            envOrDefault("TRANSCODER_PRESET_ID", DefaultPresetID),
+		WatermarkPresetID:   envOrDefault("TRANSCODER_WATERMARK_PRESET_ID", DefaultWatermarkPresetID),
+		WatermarkInputKey:   envOrDefault("TRANSCODER_WATERMARK_INPUT_KEY", DefaultWatermarkInputKey),
+		WatermarkPosition:   envOrDefault("TRANSCODER_WATERMARK_POSITION", DefaultWatermarkPosition),
+		HLSPresets:          hlsPresets,
+	}, nil
+}
+
+func (e *ElasticTranscoder) Submit(job Job) (externalID string, err error) {
+
+	if job.HLS {
+		return e.submitHLS(job)
+	}
+
+	pipelineID := e.PipelineID
+	presetID := e.PresetID
+
+	output := &elastictranscoder.CreateJobOutput{
+		Key:              aws.String(job.OutputKey),
+		Rotate:           aws.String("auto"),
+		ThumbnailPattern: aws.String(job.ThumbnailPattern),
+	}
+
+	if job.Watermark {
+		pipelineID = e.WatermarkPipelineID
+		presetID = e.WatermarkPresetID
+
+		output.Watermarks = []*elastictranscoder.JobWatermark{
+			{InputKey: aws.String(e.WatermarkInputKey), PresetWatermarkId: aws.String(e.WatermarkPosition)},
+		}
+	}
+
+	output.PresetId = aws.String(presetID)
+
+	params := &elastictranscoder.CreateJobInput{
+		Input: &elastictranscoder.JobInput{
+			AspectRatio: aws.String("auto"),
+			Container:   aws.String("auto"),
+			FrameRate:   aws.String("auto"),
+			Interlaced:  aws.String("auto"),
+			Key:         aws.String(job.InputKey), // the "filename" in S3
+			Resolution:  aws.String("auto"),
+		},
+		PipelineId: aws.String(pipelineID),
+		Output:     output,
+	}
+
+	if err = params.Validate(); err != nil {
+		return
+	}
+
+	res, err := e.client.CreateJob(params)
+
+	if err != nil {
+		return
+	}
+
+	return aws.StringValue(res.Job.Id), nil
+}
+
+// Write every HLS rendition and a master playlist under the output key
+func (e *ElasticTranscoder) submitHLS(job Job) (externalID string, err error) {
+	var outputs []*elastictranscoder.CreateJobOutput
+	var keys []*string
+
+	for _, rendition := range HLSRenditions {
+		outputs = append(outputs, &elastictranscoder.CreateJobOutput{
+			Key:             aws.String(rendition.Name),
+			PresetId:        aws.String(e.HLSPresets[rendition.Name]),
+			Rotate:          aws.String("auto"),
+			SegmentDuration: aws.String(strconv.Itoa(HLSSegmentSeconds)),
+		})
+
+		keys = append(keys, aws.String(rendition.Name))
+	}
+
+	params := &elastictranscoder.CreateJobInput{
+		Input: &elastictranscoder.JobInput{
+			AspectRatio: aws.String("auto"),
+			Container:   aws.String("auto"),
+			FrameRate:   aws.String("auto"),
+			Interlaced:  aws.String("auto"),
+			Key:         aws.String(job.InputKey),
+			Resolution:  aws.String("auto"),
+		},
+		PipelineId:      aws.String(e.PipelineID),
+		OutputKeyPrefix: aws.String(job.OutputKey),
+		Outputs:         outputs,
+		Playlists: []*elastictranscoder.CreateJobPlaylist{
+			{Format: aws.String("HLSv3"), Name: aws.String(HLSMasterPlaylist), OutputKeys: keys},
+		},
+	}
+
+	if err = params.Validate(); err != nil {
+		return
+	}
+
+	res, err := e.client.CreateJob(params)
+
+	if err != nil {
+		return
+	}
+
+	return aws.StringValue(res.Job.Id), nil
+}
+
+func (e *ElasticTranscoder) Status(externalID string) (status Status, err error) {
+	res, err := e.client.ReadJob(&elastictranscoder.ReadJobInput{Id: aws.String(externalID)})
+
+	if err != nil {
+		return
+	}
+
+	status.State = ElasticState(aws.StringValue(res.Job.Status))
+
+	output := res.Job.Output
+
+	if output == nil && len(res.Job.Outputs) > 0 {
+		output = res.Job.Outputs[0]
+	}
+
+	if output != nil {
+		status.Duration = aws.Int64Value(output.Duration)
+		status.Detail = aws.StringValue(output.StatusDetail)
+	}
+
+	return
+}
+
+// Convert an Elastic Transcoder job state, it is also used
+// for the states sent in Elastic Transcoder notifications
+func ElasticState(state string) string {
+	switch state {
+	case elasticStateSubmitted:
+		return StateSubmitted
+	case elasticStateProgressing, "PROGRESSING":
+		return StateProgressing
+	case elasticStateComplete, "COMPLETED":
+		return StateCompleted
+	case elasticStateCanceled, elasticStateError, "ERROR", "WARNING":
+		return StateError
+	default:
+		return StateSubmitted
+	}
+}
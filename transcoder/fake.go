@@ -0,0 +1,84 @@
+package transcoder
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Local transcoder that keeps jobs in memory. Jobs complete as soon
+// as they are submitted unless a state is set, so development and tests
+// can run without aws.
+type Fake struct {
+	mutex     sync.Mutex
+	count     int
+	jobs      map[string]Job
+	states    map[string]Status
+	SubmitErr error
+	Duration  int64
+}
+
+func NewFake() *Fake {
+	return &Fake{
+		jobs:     make(map[string]Job),
+		states:   make(map[string]Status),
+		Duration: 30,
+	}
+}
+
+func (f *Fake) Submit(job Job) (externalID string, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.SubmitErr != nil {
+		return "", f.SubmitErr
+	}
+
+	if job.InputKey == "" || job.OutputKey == "" {
+		return "", errors.New("missing input or output key")
+	}
+
+	f.count++
+
+	externalID = fmt.Sprintf("local-%d", f.count)
+
+	f.jobs[externalID] = job
+	f.states[externalID] = Status{State: StateCompleted, Duration: f.Duration}
+
+	return
+}
+
+func (f *Fake) Status(externalID string) (status Status, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	status, ok := f.states[externalID]
+
+	if !ok {
+		return status, ErrorUnknownJob
+	}
+
+	return
+}
+
+// Move a submitted job to another state
+func (f *Fake) SetStatus(externalID string, status Status) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.states[externalID] = status
+}
+
+// Jobs submitted so far by their id
+func (f *Fake) Jobs() map[string]Job {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	jobs := make(map[string]Job, len(f.jobs))
+
+	for id, job := range f.jobs {
+		jobs[id] = job
+	}
+
+	return jobs
+}
@@ -0,0 +1,62 @@
+package transcoder
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFake_SubmitCompletes(t *testing.T) {
+	f := NewFake()
+
+	id, err := f.Submit(Job{InputKey: "video", OutputKey: "video.mp4", Watermark: true})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := f.Status(id)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status.State != StateCompleted || status.Duration != f.Duration {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	if job := f.Jobs()[id]; !job.Watermark {
+		t.Errorf("job was not stored %+v", job)
+	}
+}
+
+func TestFake_SubmitError(t *testing.T) {
+	f := NewFake()
+	f.SubmitErr = errors.New("unavailable")
+
+	if _, err := f.Submit(Job{InputKey: "video", OutputKey: "video.mp4"}); err == nil {
+		t.Error("expected submit error")
+	}
+}
+
+func TestFake_UnknownJob(t *testing.T) {
+	if _, err := NewFake().Status("missing"); err != ErrorUnknownJob {
+		t.Errorf("expected ErrorUnknownJob, got %v", err)
+	}
+}
+
+func TestElasticState(t *testing.T) {
+	states := map[string]string{
+		"Submitted":   StateSubmitted,
+		"PROGRESSING": StateProgressing,
+		"Complete":    StateCompleted,
+		"COMPLETED":   StateCompleted,
+		"ERROR":       StateError,
+		"Canceled":    StateError,
+	}
+
+	for state, expected := range states {
+		if got := ElasticState(state); got != expected {
+			t.Errorf("ElasticState(%v) = %v, expected %v", state, got, expected)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package transcoder
+
+import (
+	"errors"
+	"os"
+)
+
+// States reported by a transcoding backend
+const (
+	StateSubmitted   = "submitted"
+	StateProgressing = "progressing"
+	StateCompleted   = "completed"
+	StateError       = "error"
+)
+
+// Backends that can be selected with TRANSCODER_BACKEND
+const (
+	BackendElastic = "elastic"
+	BackendLocal   = "local"
+)
+
+var ErrorUnknownJob = errors.New("transcoding job does not exist")
+
+// Name of the master playlist written beside the HLS renditions
+const HLSMasterPlaylist = "master"
+
+// Length of each HLS segment in seconds
+const HLSSegmentSeconds = 6
+
+// An HLS rendition, Bandwidth is the peak bits per
+// second advertised in the master playlist
+type Rendition struct {
+	Name      string `json:"name"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Bandwidth int    `json:"bandwidth"`
+}
+
+// Renditions written by an HLS job, lowest first. The sizes and
+// bandwidths are the largest frame and the total video and audio
+// bitrate of the Elastic Transcoder system HLS preset of the same
+// name, so the master playlist advertises what the presets write.
+var HLSRenditions = []Rendition{
+	{Name: "400k", Width: 400, Height: 288, Bandwidth: 400000},
+	{Name: "600k", Width: 480, Height: 320, Bandwidth: 600000},
+	{Name: "1m", Width: 640, Height: 432, Bandwidth: 1000000},
+	{Name: "2m", Width: 1024, Height: 768, Bandwidth: 2000000},
+}
+
+// Key of the playlist of a rendition under an HLS output prefix
+func RenditionPlaylistKey(prefix string, name string) string {
+	return prefix + name + ".m3u8"
+}
+
+// A video to transcode. The watermark job stamps the
+// talent mob logo on the video for sharing outside the app.
+// An HLS job writes every rendition and a master playlist
+// under OutputKey, which is used as a prefix.
+type Job struct {
+	InputKey         string `json:"input_key"`
+	OutputKey        string `json:"output_key"`
+	ThumbnailPattern string `json:"thumbnail_pattern"`
+	Watermark        bool   `json:"watermark"`
+	HLS              bool   `json:"hls"`
+}
+
+// Status of a submitted job, Duration is the length
+// of the output in seconds once it is completed
+type Status struct {
+	State    string `json:"state"`
+	Duration int64  `json:"duration"`
+	Detail   string `json:"detail"`
+}
+
+// A Transcoder submits jobs to a transcoding service and
+// reports their status by the id the service gave the job
+type Transcoder interface {
+	Submit(job Job) (externalID string, err error)
+	Status(externalID string) (status Status, err error)
+}
+
+// Create the transcoder set in TRANSCODER_BACKEND,
+// Elastic Transcoder is used by default
+func New() (Transcoder, error) {
+	switch os.Getenv("TRANSCODER_BACKEND") {
+	case BackendLocal:
+		return NewFake(), nil
+	default:
+		return NewElasticTranscoder(os.Getenv("AWS_ACCESS_KEY"), os.Getenv("AWS_SECRET_KEY"))
+	}
+}